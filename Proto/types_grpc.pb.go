@@ -21,6 +21,11 @@ const _ = grpc.SupportPackageIsVersion7
 const (
 	Node_Handshake_FullMethodName         = "/Node/Handshake"
 	Node_HandleTransaction_FullMethodName = "/Node/HandleTransaction"
+	Node_HandleInventory_FullMethodName   = "/Node/HandleInventory"
+	Node_GetData_FullMethodName           = "/Node/GetData"
+	Node_HandleProposal_FullMethodName    = "/Node/HandleProposal"
+	Node_HandleVote_FullMethodName        = "/Node/HandleVote"
+	Node_HandleEvidence_FullMethodName    = "/Node/HandleEvidence"
 )
 
 // NodeClient is the client API for Node service.
@@ -29,6 +34,11 @@ const (
 type NodeClient interface {
 	Handshake(ctx context.Context, in *Version, opts ...grpc.CallOption) (*Version, error)
 	HandleTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Ack, error)
+	HandleInventory(ctx context.Context, in *Inventory, opts ...grpc.CallOption) (*Ack, error)
+	GetData(ctx context.Context, in *Inventory, opts ...grpc.CallOption) (*Data, error)
+	HandleProposal(ctx context.Context, in *Proposal, opts ...grpc.CallOption) (*Ack, error)
+	HandleVote(ctx context.Context, in *Vote, opts ...grpc.CallOption) (*Ack, error)
+	HandleEvidence(ctx context.Context, in *Evidence, opts ...grpc.CallOption) (*Ack, error)
 }
 
 type nodeClient struct {
@@ -57,12 +67,62 @@ func (c *nodeClient) HandleTransaction(ctx context.Context, in *Transaction, opt
 	return out, nil
 }
 
+func (c *nodeClient) HandleInventory(ctx context.Context, in *Inventory, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, Node_HandleInventory_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) GetData(ctx context.Context, in *Inventory, opts ...grpc.CallOption) (*Data, error) {
+	out := new(Data)
+	err := c.cc.Invoke(ctx, Node_GetData_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) HandleProposal(ctx context.Context, in *Proposal, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, Node_HandleProposal_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) HandleVote(ctx context.Context, in *Vote, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, Node_HandleVote_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) HandleEvidence(ctx context.Context, in *Evidence, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, Node_HandleEvidence_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // NodeServer is the server API for Node service.
 // All implementations must embed UnimplementedNodeServer
 // for forward compatibility
 type NodeServer interface {
 	Handshake(context.Context, *Version) (*Version, error)
 	HandleTransaction(context.Context, *Transaction) (*Ack, error)
+	HandleInventory(context.Context, *Inventory) (*Ack, error)
+	GetData(context.Context, *Inventory) (*Data, error)
+	HandleProposal(context.Context, *Proposal) (*Ack, error)
+	HandleVote(context.Context, *Vote) (*Ack, error)
+	HandleEvidence(context.Context, *Evidence) (*Ack, error)
 	mustEmbedUnimplementedNodeServer()
 }
 
@@ -76,6 +136,21 @@ func (UnimplementedNodeServer) Handshake(context.Context, *Version) (*Version, e
 func (UnimplementedNodeServer) HandleTransaction(context.Context, *Transaction) (*Ack, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method HandleTransaction not implemented")
 }
+func (UnimplementedNodeServer) HandleInventory(context.Context, *Inventory) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HandleInventory not implemented")
+}
+func (UnimplementedNodeServer) GetData(context.Context, *Inventory) (*Data, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetData not implemented")
+}
+func (UnimplementedNodeServer) HandleProposal(context.Context, *Proposal) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HandleProposal not implemented")
+}
+func (UnimplementedNodeServer) HandleVote(context.Context, *Vote) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HandleVote not implemented")
+}
+func (UnimplementedNodeServer) HandleEvidence(context.Context, *Evidence) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HandleEvidence not implemented")
+}
 func (UnimplementedNodeServer) mustEmbedUnimplementedNodeServer() {}
 
 // UnsafeNodeServer may be embedded to opt out of forward compatibility for this service.
@@ -125,6 +200,96 @@ func _Node_HandleTransaction_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Node_HandleInventory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Inventory)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).HandleInventory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Node_HandleInventory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).HandleInventory(ctx, req.(*Inventory))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_GetData_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Inventory)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).GetData(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Node_GetData_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).GetData(ctx, req.(*Inventory))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_HandleProposal_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Proposal)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).HandleProposal(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Node_HandleProposal_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).HandleProposal(ctx, req.(*Proposal))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_HandleVote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Vote)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).HandleVote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Node_HandleVote_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).HandleVote(ctx, req.(*Vote))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_HandleEvidence_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Evidence)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).HandleEvidence(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Node_HandleEvidence_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).HandleEvidence(ctx, req.(*Evidence))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Node_ServiceDesc is the grpc.ServiceDesc for Node service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -140,7 +305,27 @@ var Node_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "HandleTransaction",
 			Handler:    _Node_HandleTransaction_Handler,
 		},
+		{
+			MethodName: "HandleInventory",
+			Handler:    _Node_HandleInventory_Handler,
+		},
+		{
+			MethodName: "GetData",
+			Handler:    _Node_GetData_Handler,
+		},
+		{
+			MethodName: "HandleProposal",
+			Handler:    _Node_HandleProposal_Handler,
+		},
+		{
+			MethodName: "HandleVote",
+			Handler:    _Node_HandleVote_Handler,
+		},
+		{
+			MethodName: "HandleEvidence",
+			Handler:    _Node_HandleEvidence_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/types.proto",
-}
\ No newline at end of file
+}
@@ -0,0 +1,57 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+// SingleAuthority accepts only blocks signed by one fixed key. Without an
+// authority it rejects every block.
+type SingleAuthority struct {
+	authority []byte
+}
+
+func NewSingleAuthority(authority *encrypted.PublicKey) *SingleAuthority {
+	if authority == nil {
+		return &SingleAuthority{}
+	}
+
+	return &SingleAuthority{authority: authority.Bytes()}
+}
+
+func (a *SingleAuthority) SelectProposer(chain ChainReader, height int32, timestamp int64) ([]byte, error) {
+	return a.authority, nil
+}
+
+func (a *SingleAuthority) Propose(ctx context.Context, chain ChainReader, block *proto.Block, key *encrypted.PrivateKey) error {
+	if a.authority == nil || !bytes.Equal(key.Public().Bytes(), a.authority) {
+		return errors.Wrap(errors.ErrUnauthorized, "only the authority can propose blocks")
+	}
+
+	types.SignBlock(key, block)
+
+	return nil
+}
+
+func (a *SingleAuthority) ValidateHeader(chain ChainReader, block *proto.Block) error {
+	if a.authority == nil {
+		return errors.Wrap(errors.ErrUnauthorized, "no authority configured")
+	}
+	if !bytes.Equal(block.PublicKey, a.authority) {
+		return errors.Wrapf(errors.ErrUnauthorized, "block signed by %x instead of the authority", block.PublicKey)
+	}
+	if err := types.CheckBlock(block); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (a *SingleAuthority) Finalize(chain ChainReader, block *proto.Block) error {
+	return nil
+}
@@ -0,0 +1,49 @@
+package consensus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/util"
+)
+
+func TestSingleAuthority(t *testing.T) {
+	var (
+		authority = encrypted.GeneratePrivateKey()
+		other     = encrypted.GeneratePrivateKey()
+		engine    = NewSingleAuthority(authority.Public())
+	)
+
+	proposer, err := engine.SelectProposer(nil, 1, 0)
+	require.Nil(t, err)
+	assert.Equal(t, authority.Public().Bytes(), proposer)
+
+	block := util.RandomBlock()
+	require.Nil(t, engine.Propose(context.Background(), nil, block, authority))
+	assert.Nil(t, engine.ValidateHeader(nil, block))
+
+	block.Header.Height++
+	assert.True(t, errors.IsOf(engine.ValidateHeader(nil, block), errors.ErrUnauthorized))
+
+	forged := util.RandomBlock()
+	assert.True(t, errors.IsOf(engine.Propose(context.Background(), nil, forged, other), errors.ErrUnauthorized))
+
+	forged.PublicKey = authority.Public().Bytes()
+	assert.NotNil(t, engine.ValidateHeader(nil, forged))
+}
+
+func TestSingleAuthorityWithoutAuthority(t *testing.T) {
+	var (
+		key    = encrypted.GeneratePrivateKey()
+		engine = NewSingleAuthority(nil)
+		block  = &proto.Block{Header: &proto.Header{Version: 1, Height: 1}}
+	)
+
+	assert.NotNil(t, engine.Propose(context.Background(), nil, block, key))
+	assert.NotNil(t, engine.ValidateHeader(nil, block))
+}
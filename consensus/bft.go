@@ -0,0 +1,232 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+// BFT is a Tendermint-like engine: a block is final once validators holding
+// more than two thirds of the voting power precommitted it in the same
+// round. Every validator holds one vote. The rounds themselves are run by
+// the node; the engine only knows the validator set and checks the commit
+// certificate each block carries, so a block without one is never accepted
+// and a committed block is never replaced.
+type BFT struct {
+	validators [][]byte
+}
+
+func NewBFT(validators []*encrypted.PublicKey) *BFT {
+	b := &BFT{}
+	for _, validator := range validators {
+		b.validators = append(b.validators, validator.Bytes())
+	}
+
+	return b
+}
+
+func (b *BFT) Validators() [][]byte {
+	return b.validators
+}
+
+func (b *BFT) IsValidator(publicKey []byte) bool {
+	for _, validator := range b.validators {
+		if bytes.Equal(validator, publicKey) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Quorum is the number of votes making up more than two thirds of the
+// voting power.
+func (b *BFT) Quorum() int {
+	return len(b.validators)*2/3 + 1
+}
+
+// Proposer returns the validator proposing in the given round of height.
+func (b *BFT) Proposer(height, round int32) []byte {
+	if len(b.validators) == 0 {
+		return nil
+	}
+
+	return b.validators[(int64(height)+int64(round))%int64(len(b.validators))]
+}
+
+// SelectProposer returns the proposer of the first round of height; later
+// rounds are selected with Proposer.
+func (b *BFT) SelectProposer(chain ChainReader, height int32, timestamp int64) ([]byte, error) {
+	if len(b.validators) == 0 {
+		return nil, errors.Wrap(errors.ErrUnauthorized, "empty validator set")
+	}
+
+	return b.Proposer(height, 0), nil
+}
+
+func (b *BFT) Propose(ctx context.Context, chain ChainReader, block *proto.Block, key *encrypted.PrivateKey) error {
+	if !b.IsValidator(key.Public().Bytes()) {
+		return errors.Wrap(errors.ErrUnauthorized, "only validators can propose blocks")
+	}
+
+	types.SignBlock(key, block)
+
+	return nil
+}
+
+// ValidateProposal checks a block proposed for voting, which does not carry
+// a commit yet.
+func (b *BFT) ValidateProposal(chain ChainReader, block *proto.Block) error {
+	parent, err := chain.GetBlockByHeight(int(block.Header.Height) - 1)
+	if err != nil {
+		return err
+	}
+	if block.Header.Timestamp <= parent.Header.Timestamp {
+		return fmt.Errorf("block timestamp (%d) not after parent timestamp (%d)", block.Header.Timestamp, parent.Header.Timestamp)
+	}
+
+	if !b.IsValidator(block.PublicKey) {
+		return errors.Wrapf(errors.ErrUnauthorized, "block signed by %x which is not a validator", block.PublicKey)
+	}
+	if err := types.CheckBlock(block); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (b *BFT) ValidateHeader(chain ChainReader, block *proto.Block) error {
+	if err := b.ValidateProposal(chain, block); err != nil {
+		return err
+	}
+
+	return b.VerifyCommit(block)
+}
+
+// VerifyCommit checks that the block carries precommits for it from a
+// quorum of distinct validators.
+func (b *BFT) VerifyCommit(block *proto.Block) error {
+	commit := block.Commit
+	if commit == nil {
+		return errors.Wrapf(errors.ErrUnauthorized, "block at height %d has no commit", block.Header.Height)
+	}
+
+	var (
+		hash   = types.HashBlock(block)
+		signed = make(map[string]bool)
+	)
+	for _, vote := range commit.Precommits {
+		if vote.Type != proto.VoteType_VOTE_PRECOMMIT || vote.Height != block.Header.Height || vote.Round != commit.Round {
+			return fmt.Errorf("commit contains a vote for another step")
+		}
+		if !bytes.Equal(vote.BlockHash, hash) {
+			return fmt.Errorf("commit contains a precommit for another block")
+		}
+		if err := b.VerifyVote(vote); err != nil {
+			return err
+		}
+		signed[hex.EncodeToString(vote.PublicKey)] = true
+	}
+
+	if len(signed) < b.Quorum() {
+		return errors.Wrapf(errors.ErrUnauthorized, "commit has %d of %d required precommits", len(signed), b.Quorum())
+	}
+
+	return nil
+}
+
+// VerifyVote checks that the vote is signed by a validator.
+func (b *BFT) VerifyVote(vote *proto.Vote) error {
+	if !b.IsValidator(vote.PublicKey) {
+		return errors.Wrapf(errors.ErrUnauthorized, "vote from %x which is not a validator", vote.PublicKey)
+	}
+	if !types.VerifyVote(vote) {
+		return errors.Wrap(errors.ErrUnauthorized, "invalid vote signature")
+	}
+
+	return nil
+}
+
+func (b *BFT) Finalize(chain ChainReader, block *proto.Block) error {
+	return nil
+}
+
+// VoteSet collects the votes of one type cast in one round of a height,
+// keeping the first vote of every validator.
+type VoteSet struct {
+	votes  map[string]*proto.Vote
+	counts map[string]int
+}
+
+func NewVoteSet() *VoteSet {
+	return &VoteSet{
+		votes:  make(map[string]*proto.Vote),
+		counts: make(map[string]int),
+	}
+}
+
+// Add records the vote and reports whether the validator had not voted yet.
+func (s *VoteSet) Add(vote *proto.Vote) bool {
+	validator := hex.EncodeToString(vote.PublicKey)
+	if _, ok := s.votes[validator]; ok {
+		return false
+	}
+
+	s.votes[validator] = vote
+	s.counts[hex.EncodeToString(vote.BlockHash)]++
+
+	return true
+}
+
+func (s *VoteSet) Len() int {
+	return len(s.votes)
+}
+
+// Count returns the number of votes for the block hash, nil counting the
+// votes for no block.
+func (s *VoteSet) Count(blockHash []byte) int {
+	return s.counts[hex.EncodeToString(blockHash)]
+}
+
+// Majority returns the block hash that at least quorum votes agree on, nil
+// meaning a quorum voted for no block.
+func (s *VoteSet) Majority(quorum int) ([]byte, bool) {
+	for hash, count := range s.counts {
+		if count >= quorum {
+			b, _ := hex.DecodeString(hash)
+			if len(b) == 0 {
+				return nil, true
+			}
+			return b, true
+		}
+	}
+
+	return nil, false
+}
+
+func (s *VoteSet) List() []*proto.Vote {
+	votes := make([]*proto.Vote, 0, len(s.votes))
+	for _, vote := range s.votes {
+		votes = append(votes, vote)
+	}
+
+	return votes
+}
+
+// Votes returns the votes for the block hash.
+func (s *VoteSet) Votes(blockHash []byte) []*proto.Vote {
+	var votes []*proto.Vote
+	for _, vote := range s.votes {
+		if bytes.Equal(vote.BlockHash, blockHash) {
+			votes = append(votes, vote)
+		}
+	}
+
+	return votes
+}
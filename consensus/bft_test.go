@@ -0,0 +1,127 @@
+package consensus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+func precommit(key *encrypted.PrivateKey, block *proto.Block, round int32) *proto.Vote {
+	vote := &proto.Vote{
+		Type:      proto.VoteType_VOTE_PRECOMMIT,
+		Height:    block.Header.Height,
+		Round:     round,
+		BlockHash: types.HashBlock(block),
+	}
+	types.SignVote(key, vote)
+
+	return vote
+}
+
+func newBFT(n int) (*BFT, []*encrypted.PrivateKey) {
+	var (
+		keys []*encrypted.PrivateKey
+		pubs []*encrypted.PublicKey
+	)
+	for i := 0; i < n; i++ {
+		keys = append(keys, encrypted.GeneratePrivateKey())
+		pubs = append(pubs, keys[i].Public())
+	}
+
+	return NewBFT(pubs), keys
+}
+
+func TestBFTQuorum(t *testing.T) {
+	for validators, quorum := range map[int]int{1: 1, 3: 3, 4: 3, 7: 5, 10: 7} {
+		engine, _ := newBFT(validators)
+		assert.Equal(t, quorum, engine.Quorum(), "validators %d", validators)
+	}
+}
+
+func TestBFTVerifyCommit(t *testing.T) {
+	var (
+		engine, keys = newBFT(4)
+		chain        = newTestChain()
+		block        = nextBlock(chain, time.Second)
+	)
+	require.Nil(t, engine.Propose(context.Background(), chain, block, keys[0]))
+	require.Nil(t, engine.ValidateProposal(chain, block))
+
+	// a proposal is not final until it carries a commit
+	assert.True(t, errors.IsOf(engine.ValidateHeader(chain, block), errors.ErrUnauthorized))
+
+	block.Commit = &proto.Commit{Round: 1}
+	for _, key := range keys[:2] {
+		block.Commit.Precommits = append(block.Commit.Precommits, precommit(key, block, 1))
+	}
+	assert.NotNil(t, engine.ValidateHeader(chain, block))
+
+	// the same validator twice does not make a quorum
+	block.Commit.Precommits = append(block.Commit.Precommits, block.Commit.Precommits[0])
+	assert.NotNil(t, engine.ValidateHeader(chain, block))
+
+	block.Commit.Precommits[2] = precommit(keys[2], block, 1)
+	assert.Nil(t, engine.ValidateHeader(chain, block))
+}
+
+func TestBFTVerifyCommitRejectsForeignVotes(t *testing.T) {
+	var (
+		engine, keys = newBFT(4)
+		chain        = newTestChain()
+		block        = nextBlock(chain, time.Second)
+		other        = nextBlock(chain, 2*time.Second)
+	)
+	require.Nil(t, engine.Propose(context.Background(), chain, block, keys[0]))
+
+	commit := func(votes ...*proto.Vote) error {
+		block.Commit = &proto.Commit{Round: 0, Precommits: votes}
+		return engine.VerifyCommit(block)
+	}
+
+	outsider := encrypted.GeneratePrivateKey()
+	assert.NotNil(t, commit(precommit(keys[0], block, 0), precommit(keys[1], block, 0), precommit(outsider, block, 0)))
+	assert.NotNil(t, commit(precommit(keys[0], block, 0), precommit(keys[1], block, 0), precommit(keys[2], other, 0)))
+	assert.NotNil(t, commit(precommit(keys[0], block, 0), precommit(keys[1], block, 0), precommit(keys[2], block, 1)))
+
+	prevote := precommit(keys[2], block, 0)
+	prevote.Type = proto.VoteType_VOTE_PREVOTE
+	types.SignVote(keys[2], prevote)
+	assert.NotNil(t, commit(precommit(keys[0], block, 0), precommit(keys[1], block, 0), prevote))
+
+	assert.Nil(t, commit(precommit(keys[0], block, 0), precommit(keys[1], block, 0), precommit(keys[2], block, 0)))
+}
+
+func TestVoteSet(t *testing.T) {
+	var (
+		_, keys = newBFT(4)
+		block   = nextBlock(newTestChain(), time.Second)
+		set     = NewVoteSet()
+	)
+
+	assert.True(t, set.Add(precommit(keys[0], block, 0)))
+	assert.False(t, set.Add(precommit(keys[0], block, 0)))
+	assert.True(t, set.Add(precommit(keys[1], block, 0)))
+
+	nilVote := &proto.Vote{Type: proto.VoteType_VOTE_PRECOMMIT, Height: 1}
+	types.SignVote(keys[2], nilVote)
+	assert.True(t, set.Add(nilVote))
+
+	_, ok := set.Majority(3)
+	assert.False(t, ok)
+	assert.Equal(t, 2, set.Count(types.HashBlock(block)))
+	assert.Equal(t, 1, set.Count(nil))
+
+	set.Add(precommit(keys[3], block, 0))
+	hash, ok := set.Majority(3)
+	require.True(t, ok)
+	assert.Equal(t, types.HashBlock(block), hash)
+	assert.Len(t, set.Votes(hash), 3)
+	assert.Len(t, set.List(), 4)
+}
@@ -0,0 +1,107 @@
+// Package consensus defines how blocks are proposed and which blocks a
+// chain accepts, so nodes can swap consensus rules by configuration.
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+)
+
+// ChainReader is the read-only view of the chain an engine works against.
+type ChainReader interface {
+	Height() int
+	GetBlockByHeight(height int) (*proto.Block, error)
+	// GetBlockByHash also finds blocks off the best branch.
+	GetBlockByHash(hash []byte) (*proto.Block, error)
+}
+
+// Engine is a set of consensus rules. The chain calls ValidateHeader before
+// adding a block and Finalize after; the node calls SelectProposer and
+// Propose to produce blocks.
+type Engine interface {
+	// SelectProposer returns the public key of the validator expected to
+	// propose the block at height carrying timestamp, or nil if anybody may
+	// propose it.
+	SelectProposer(chain ChainReader, height int32, timestamp int64) ([]byte, error)
+	// Propose seals a block the node assembled on top of the chain tip,
+	// giving up when ctx is done.
+	Propose(ctx context.Context, chain ChainReader, block *proto.Block, key *encrypted.PrivateKey) error
+	// ValidateHeader checks the header and seal of a block extending the
+	// chain tip.
+	ValidateHeader(chain ChainReader, block *proto.Block) error
+	// Finalize is called once the block has been added to the chain.
+	Finalize(chain ChainReader, block *proto.Block) error
+}
+
+// ProposalValidator is implemented by engines that vote on blocks before
+// they are sealed. ValidateProposal checks a block that is still missing
+// its seal.
+type ProposalValidator interface {
+	ValidateProposal(chain ChainReader, block *proto.Block) error
+}
+
+// ForkChooser is implemented by engines that let competing branches exist.
+// The chain follows the branch with the most cumulative work and switches
+// branches when another one overtakes it. Chains of other engines only ever
+// extend their tip, so their blocks are never reorganised.
+type ForkChooser interface {
+	Work(header *proto.Header) *big.Int
+}
+
+// Staking is implemented by engines that take the validator set from the
+// stake bonded on chain rather than from configuration. The chain snapshots
+// the bonded stake at the end of every epoch, starting with the stake the
+// genesis block bonds.
+type Staking interface {
+	Params() PosParams
+}
+
+// StakeReader is implemented by chains that track bonded stake.
+type StakeReader interface {
+	// ValidatorSet returns the validator set of the epoch of height.
+	ValidatorSet(height int32) (*ValidatorSet, error)
+}
+
+// MaxFutureDrift is how far ahead of the local clock a header may be dated.
+// Engines derive proposer turns from timestamps, so without the bound a
+// validator could date its block into a turn of its own choosing. It
+// tolerates a block time of clock skew, a third of the default proposer
+// timeout, and genesis rejects timeouts that are not well above it.
+const MaxFutureDrift = 5 * time.Second
+
+// CheckTimestamp rejects a header dated more than MaxFutureDrift after now.
+func CheckTimestamp(header *proto.Header, now time.Time) error {
+	if limit := now.Add(MaxFutureDrift).UnixNano(); header.Timestamp > limit {
+		return fmt.Errorf("block timestamp (%d) too far ahead of local time (%d)", header.Timestamp, now.UnixNano())
+	}
+
+	return nil
+}
+
+// MedianTimeBlocks is the number of blocks the median time past is taken
+// over.
+const MedianTimeBlocks = 11
+
+// MedianTimePast returns the median timestamp of header and the
+// MedianTimeBlocks-1 blocks before it. Unlike a single timestamp it only
+// moves forward, and a minority of blocks cannot drag it back.
+func MedianTimePast(chain ChainReader, header *proto.Header) (int64, error) {
+	timestamps := []int64{header.Timestamp}
+	for len(timestamps) < MedianTimeBlocks && header.Height > 0 {
+		block, err := chain.GetBlockByHash(header.PrevHash)
+		if err != nil {
+			return 0, err
+		}
+		header = block.Header
+		timestamps = append(timestamps, header.Timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2], nil
+}
@@ -0,0 +1,120 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+// ProofOfAuthority rotates block production over a fixed validator set by
+// height. When the proposer of a height has not produced a block within
+// Timeout of its parent, the turn passes to the next validator, and so on
+// for every further Timeout that passes.
+type ProofOfAuthority struct {
+	validators [][]byte
+	timeout    time.Duration
+}
+
+func NewProofOfAuthority(validators []*encrypted.PublicKey, timeout time.Duration) *ProofOfAuthority {
+	p := &ProofOfAuthority{timeout: timeout}
+	for _, validator := range validators {
+		p.validators = append(p.validators, validator.Bytes())
+	}
+
+	return p
+}
+
+// Validators returns the public keys of the validator set in proposer order.
+func (p *ProofOfAuthority) Validators() [][]byte {
+	return p.validators
+}
+
+func (p *ProofOfAuthority) SelectProposer(chain ChainReader, height int32, timestamp int64) ([]byte, error) {
+	if len(p.validators) == 0 {
+		return nil, errors.Wrap(errors.ErrUnauthorized, "empty validator set")
+	}
+
+	parent, err := chain.GetBlockByHeight(int(height) - 1)
+	if err != nil {
+		return nil, err
+	}
+
+	round := proposerRound(parent, timestamp, p.timeout)
+	index := (int64(height) + round) % int64(len(p.validators))
+
+	return p.validators[index], nil
+}
+
+func (p *ProofOfAuthority) Propose(ctx context.Context, chain ChainReader, block *proto.Block, key *encrypted.PrivateKey) error {
+	return proposeInTurn(p, chain, block, key)
+}
+
+func (p *ProofOfAuthority) ValidateHeader(chain ChainReader, block *proto.Block) error {
+	return validateInTurn(p, chain, block)
+}
+
+func (p *ProofOfAuthority) Finalize(chain ChainReader, block *proto.Block) error {
+	return nil
+}
+
+// proposerRound returns how many full timeouts have passed between the
+// parent and timestamp; every one of them skips one more proposer.
+func proposerRound(parent *proto.Block, timestamp int64, timeout time.Duration) int64 {
+	elapsed := timestamp - parent.Header.Timestamp
+	if elapsed <= 0 || timeout <= 0 {
+		return 0
+	}
+
+	return elapsed / int64(timeout)
+}
+
+// proposerSelector is an engine that names a single proposer per turn.
+type proposerSelector interface {
+	SelectProposer(chain ChainReader, height int32, timestamp int64) ([]byte, error)
+}
+
+// proposeInTurn signs the block if key is the proposer of its turn.
+func proposeInTurn(engine proposerSelector, chain ChainReader, block *proto.Block, key *encrypted.PrivateKey) error {
+	proposer, err := engine.SelectProposer(chain, block.Header.Height, block.Header.Timestamp)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(key.Public().Bytes(), proposer) {
+		return errors.Wrapf(errors.ErrUnauthorized, "not the proposer of height %d", block.Header.Height)
+	}
+
+	types.SignBlock(key, block)
+
+	return nil
+}
+
+// validateInTurn checks that the block follows its parent in time and is
+// signed by the proposer of its turn.
+func validateInTurn(engine proposerSelector, chain ChainReader, block *proto.Block) error {
+	parent, err := chain.GetBlockByHeight(int(block.Header.Height) - 1)
+	if err != nil {
+		return err
+	}
+	if block.Header.Timestamp <= parent.Header.Timestamp {
+		return fmt.Errorf("block timestamp (%d) not after parent timestamp (%d)", block.Header.Timestamp, parent.Header.Timestamp)
+	}
+
+	proposer, err := engine.SelectProposer(chain, block.Header.Height, block.Header.Timestamp)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(block.PublicKey, proposer) {
+		return errors.Wrapf(errors.ErrUnauthorized, "block at height %d signed by %x instead of proposer %x", block.Header.Height, block.PublicKey, proposer)
+	}
+	if err := types.CheckBlock(block); err != nil {
+		return err
+	}
+
+	return nil
+}
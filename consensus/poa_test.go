@@ -0,0 +1,145 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+type testChain []*proto.Block
+
+func (c testChain) Height() int {
+	return len(c) - 1
+}
+
+func (c testChain) GetBlockByHeight(height int) (*proto.Block, error) {
+	if height < 0 || height >= len(c) {
+		return nil, fmt.Errorf("no block at height %d", height)
+	}
+
+	return c[height], nil
+}
+
+func (c testChain) GetBlockByHash(hash []byte) (*proto.Block, error) {
+	for _, block := range c {
+		if bytes.Equal(types.HashBlock(block), hash) {
+			return block, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no block with hash %x", hash)
+}
+
+func newTestChain() testChain {
+	return testChain{{Header: &proto.Header{Version: 1}}}
+}
+
+func nextBlock(chain testChain, timestamp time.Duration) *proto.Block {
+	parent := chain[len(chain)-1]
+
+	return &proto.Block{
+		Header: &proto.Header{
+			Version:   1,
+			Height:    parent.Header.Height + 1,
+			PrevHash:  types.HashBlock(parent),
+			Timestamp: int64(timestamp),
+		},
+	}
+}
+
+func TestProofOfAuthorityRotatesProposers(t *testing.T) {
+	var (
+		keys   []*encrypted.PrivateKey
+		pubs   []*encrypted.PublicKey
+		chain  = newTestChain()
+		engine *ProofOfAuthority
+	)
+	for i := 0; i < 3; i++ {
+		keys = append(keys, encrypted.GeneratePrivateKey())
+		pubs = append(pubs, keys[i].Public())
+	}
+	engine = NewProofOfAuthority(pubs, time.Minute)
+
+	for height := 1; height <= 6; height++ {
+		block := nextBlock(chain, time.Duration(height)*time.Second)
+		proposer := keys[height%len(keys)]
+
+		other := keys[(height+1)%len(keys)]
+		assert.True(t, errors.IsOf(engine.Propose(context.Background(), chain, block, other), errors.ErrUnauthorized))
+
+		require.Nil(t, engine.Propose(context.Background(), chain, block, proposer))
+		require.Nil(t, engine.ValidateHeader(chain, block))
+		chain = append(chain, block)
+	}
+}
+
+func TestProofOfAuthorityRejectsWrongSigner(t *testing.T) {
+	var (
+		proposer = encrypted.GeneratePrivateKey()
+		other    = encrypted.GeneratePrivateKey()
+		chain    = newTestChain()
+		engine   = NewProofOfAuthority([]*encrypted.PublicKey{other.Public(), proposer.Public()}, time.Minute)
+		block    = nextBlock(chain, time.Second)
+	)
+
+	types.SignBlock(other, block)
+	assert.True(t, errors.IsOf(engine.ValidateHeader(chain, block), errors.ErrUnauthorized))
+
+	outsider := encrypted.GeneratePrivateKey()
+	types.SignBlock(outsider, block)
+	assert.True(t, errors.IsOf(engine.ValidateHeader(chain, block), errors.ErrUnauthorized))
+
+	types.SignBlock(proposer, block)
+	assert.Nil(t, engine.ValidateHeader(chain, block))
+}
+
+func TestProofOfAuthorityTimeoutSkipsAbsentProposer(t *testing.T) {
+	var (
+		keys  []*encrypted.PrivateKey
+		pubs  []*encrypted.PublicKey
+		chain = newTestChain()
+	)
+	for i := 0; i < 3; i++ {
+		keys = append(keys, encrypted.GeneratePrivateKey())
+		pubs = append(pubs, keys[i].Public())
+	}
+	engine := NewProofOfAuthority(pubs, 10*time.Second)
+
+	// keys[1] is due at height 1 but stays silent
+	early := nextBlock(chain, 5*time.Second)
+	assert.NotNil(t, engine.Propose(context.Background(), chain, early, keys[2]))
+
+	late := nextBlock(chain, 12*time.Second)
+	proposer, err := engine.SelectProposer(chain, 1, late.Header.Timestamp)
+	require.Nil(t, err)
+	assert.Equal(t, keys[2].Public().Bytes(), proposer)
+
+	require.Nil(t, engine.Propose(context.Background(), chain, late, keys[2]))
+	require.Nil(t, engine.ValidateHeader(chain, late))
+
+	// a block claiming a later round must carry a matching timestamp
+	types.SignBlock(keys[0], late)
+	assert.NotNil(t, engine.ValidateHeader(chain, late))
+}
+
+func TestProofOfAuthorityRejectsTimestampBeforeParent(t *testing.T) {
+	var (
+		key    = encrypted.GeneratePrivateKey()
+		chain  = newTestChain()
+		engine = NewProofOfAuthority([]*encrypted.PublicKey{key.Public()}, time.Minute)
+	)
+	chain[0].Header.Timestamp = int64(time.Minute)
+
+	block := nextBlock(chain, time.Second)
+	types.SignBlock(key, block)
+	assert.NotNil(t, engine.ValidateHeader(chain, block))
+}
@@ -0,0 +1,163 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+// PosParams are the staking rules of a network.
+type PosParams struct {
+	// EpochLength is the number of blocks a validator set stays in charge.
+	// The set of an epoch is the stake bonded at the end of the previous one.
+	EpochLength int32 `json:"epochLength"`
+	// UnbondingPeriod is the number of blocks unbonded stake stays frozen.
+	UnbondingPeriod int32 `json:"unbondingPeriod"`
+}
+
+var DefaultPosParams = PosParams{
+	EpochLength:     10,
+	UnbondingPeriod: 20,
+}
+
+// Validator is a public key with the voting power bonded to it.
+type Validator struct {
+	PublicKey []byte
+	Power     int64
+}
+
+// ValidatorSet is the validator set of an epoch, ordered by public key so
+// every node walks it the same way.
+type ValidatorSet struct {
+	validators []Validator
+	total      int64
+}
+
+// NewValidatorSet drops validators without power and orders the others.
+func NewValidatorSet(validators []Validator) *ValidatorSet {
+	s := &ValidatorSet{}
+	for _, validator := range validators {
+		if validator.Power <= 0 {
+			continue
+		}
+		s.validators = append(s.validators, validator)
+		s.total += validator.Power
+	}
+	sort.Slice(s.validators, func(i, j int) bool {
+		return bytes.Compare(s.validators[i].PublicKey, s.validators[j].PublicKey) < 0
+	})
+
+	return s
+}
+
+func (s *ValidatorSet) Validators() []Validator {
+	return s.validators
+}
+
+func (s *ValidatorSet) TotalPower() int64 {
+	return s.total
+}
+
+// Power returns the voting power of publicKey, zero if it is no validator.
+func (s *ValidatorSet) Power(publicKey []byte) int64 {
+	for _, validator := range s.validators {
+		if bytes.Equal(validator.PublicKey, publicKey) {
+			return validator.Power
+		}
+	}
+
+	return 0
+}
+
+// Proposer picks a validator with a probability proportional to its power.
+// The pick only depends on seed, so it is the same on every node.
+func (s *ValidatorSet) Proposer(seed []byte) []byte {
+	if s.total == 0 {
+		return nil
+	}
+
+	hash := sha256.Sum256(seed)
+	target := binary.BigEndian.Uint64(hash[:8]) % uint64(s.total)
+	for _, validator := range s.validators {
+		if target < uint64(validator.Power) {
+			return validator.PublicKey
+		}
+		target -= uint64(validator.Power)
+	}
+
+	return nil
+}
+
+// ProofOfStake lets validators propose blocks in proportion to the stake
+// bonded to them. The proposer of a height is drawn from the validator set
+// of its epoch; like ProofOfAuthority, every full timeout without a block
+// draws the next proposer. The draw is seeded with the hash of the last
+// block of the previous epoch, the height and the round: the seed changes
+// every epoch, but is fixed before the epoch starts, so a proposer cannot
+// grind its block for turns in the same epoch, and the round follows from
+// timestamps the chain bounds by its clock.
+type ProofOfStake struct {
+	params  PosParams
+	timeout time.Duration
+}
+
+func NewProofOfStake(params PosParams, timeout time.Duration) *ProofOfStake {
+	return &ProofOfStake{
+		params:  params,
+		timeout: timeout,
+	}
+}
+
+func (p *ProofOfStake) Params() PosParams {
+	return p.params
+}
+
+func (p *ProofOfStake) SelectProposer(chain ChainReader, height int32, timestamp int64) ([]byte, error) {
+	stakes, ok := chain.(StakeReader)
+	if !ok {
+		return nil, errors.Wrap(errors.ErrUnauthorized, "chain does not track stake")
+	}
+	set, err := stakes.ValidatorSet(height)
+	if err != nil {
+		return nil, err
+	}
+
+	// the first epoch is seeded by the genesis block
+	epochStart, err := chain.GetBlockByHeight(int((height - 1) / p.params.EpochLength * p.params.EpochLength))
+	if err != nil {
+		return nil, err
+	}
+	parent, err := chain.GetBlockByHeight(int(height) - 1)
+	if err != nil {
+		return nil, err
+	}
+
+	seed := binary.BigEndian.AppendUint32(types.HashBlock(epochStart), uint32(height))
+	seed = binary.BigEndian.AppendUint64(seed, uint64(proposerRound(parent, timestamp, p.timeout)))
+	proposer := set.Proposer(seed)
+	if proposer == nil {
+		return nil, errors.Wrapf(errors.ErrUnauthorized, "no stake bonded for height %d", height)
+	}
+
+	return proposer, nil
+}
+
+func (p *ProofOfStake) Propose(ctx context.Context, chain ChainReader, block *proto.Block, key *encrypted.PrivateKey) error {
+	return proposeInTurn(p, chain, block, key)
+}
+
+func (p *ProofOfStake) ValidateHeader(chain ChainReader, block *proto.Block) error {
+	return validateInTurn(p, chain, block)
+}
+
+func (p *ProofOfStake) Finalize(chain ChainReader, block *proto.Block) error {
+	return nil
+}
@@ -0,0 +1,125 @@
+package consensus
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// stakeChain is a testChain with a fixed validator set.
+type stakeChain struct {
+	testChain
+	set *ValidatorSet
+}
+
+func (c stakeChain) ValidatorSet(height int32) (*ValidatorSet, error) {
+	return c.set, nil
+}
+
+func TestValidatorSetProposerFollowsStake(t *testing.T) {
+	var (
+		small = encrypted.GeneratePrivateKey().Public().Bytes()
+		large = encrypted.GeneratePrivateKey().Public().Bytes()
+		none  = encrypted.GeneratePrivateKey().Public().Bytes()
+		set   = NewValidatorSet([]Validator{
+			{PublicKey: small, Power: 1},
+			{PublicKey: large, Power: 3},
+			{PublicKey: none, Power: 0},
+		})
+	)
+	require.Len(t, set.Validators(), 2)
+	assert.Equal(t, int64(4), set.TotalPower())
+	assert.Equal(t, int64(3), set.Power(large))
+	assert.Equal(t, int64(0), set.Power(none))
+
+	picks := make(map[string]int)
+	for i := uint64(0); i < 4000; i++ {
+		picks[string(set.Proposer(binary.BigEndian.AppendUint64(nil, i)))]++
+	}
+	assert.Zero(t, picks[string(none)])
+	assert.InDelta(t, 1000, picks[string(small)], 150)
+	assert.InDelta(t, 3000, picks[string(large)], 150)
+
+	// the pick is deterministic
+	seed := []byte("seed")
+	assert.Equal(t, set.Proposer(seed), set.Proposer(seed))
+
+	assert.Nil(t, NewValidatorSet(nil).Proposer(seed))
+}
+
+func TestProofOfStakeProposer(t *testing.T) {
+	var (
+		keys       = make(map[string]*encrypted.PrivateKey)
+		validators []Validator
+	)
+	for i := 0; i < 3; i++ {
+		key := encrypted.GeneratePrivateKey()
+		keys[string(key.Public().Bytes())] = key
+		validators = append(validators, Validator{PublicKey: key.Public().Bytes(), Power: int64(i + 1)})
+	}
+
+	var (
+		chain  = stakeChain{testChain: newTestChain(), set: NewValidatorSet(validators)}
+		engine = NewProofOfStake(DefaultPosParams, time.Minute)
+	)
+
+	for height := 1; height <= 6; height++ {
+		block := nextBlock(chain.testChain, time.Duration(height)*time.Second)
+		proposer, err := engine.SelectProposer(chain, block.Header.Height, block.Header.Timestamp)
+		require.Nil(t, err)
+
+		for publicKey, key := range keys {
+			if publicKey != string(proposer) {
+				assert.True(t, errors.IsOf(engine.Propose(context.Background(), chain, block, key), errors.ErrUnauthorized))
+			}
+		}
+
+		require.Nil(t, engine.Propose(context.Background(), chain, block, keys[string(proposer)]))
+		require.Nil(t, engine.ValidateHeader(chain, block))
+		chain.testChain = append(chain.testChain, block)
+	}
+
+	// the contents of the parent do not change the draw, so its proposer
+	// cannot grind them
+	parent := chain.testChain[len(chain.testChain)-1]
+	want, err := engine.SelectProposer(chain, 7, parent.Header.Timestamp+1)
+	require.Nil(t, err)
+	for nonce := uint64(0); nonce < 10; nonce++ {
+		parent.Header.Nonce = nonce
+		proposer, err := engine.SelectProposer(chain, 7, parent.Header.Timestamp+1)
+		require.Nil(t, err)
+		assert.Equal(t, want, proposer)
+	}
+
+	// the draws of an epoch are seeded by the last block of the previous
+	// one, here block 3 for heights 4 to 6
+	engine = NewProofOfStake(PosParams{EpochLength: 3}, time.Minute)
+	timestamp := chain.testChain[5].Header.Timestamp + 1
+	want, err = engine.SelectProposer(chain, 6, timestamp)
+	require.Nil(t, err)
+	for nonce := uint64(0); nonce < 10; nonce++ {
+		chain.testChain[5].Header.Nonce = nonce
+		proposer, err := engine.SelectProposer(chain, 6, timestamp)
+		require.Nil(t, err)
+		assert.Equal(t, want, proposer)
+	}
+
+	proposers := make(map[string]bool)
+	for nonce := uint64(0); nonce < 50; nonce++ {
+		chain.testChain[3].Header.Nonce = nonce
+		proposer, err := engine.SelectProposer(chain, 6, timestamp)
+		require.Nil(t, err)
+		proposers[string(proposer)] = true
+	}
+	assert.Greater(t, len(proposers), 1)
+
+	// the chain reader has to track stake
+	_, err = engine.SelectProposer(newTestChain(), 1, 0)
+	assert.True(t, errors.IsOf(err, errors.ErrUnauthorized))
+}
@@ -0,0 +1,294 @@
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"runtime"
+	"time"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+	pb "google.golang.org/protobuf/proto"
+)
+
+// PowParams are the proof of work rules of a network.
+type PowParams struct {
+	// LimitBits is the easiest target allowed, in compact form. It is also
+	// the target of the first block.
+	LimitBits uint32 `json:"limitBits"`
+	// TargetSpacing is the block time the difficulty is adjusted towards.
+	TargetSpacing time.Duration `json:"targetSpacing"`
+	// RetargetInterval is the number of blocks between adjustments.
+	RetargetInterval int32 `json:"retargetInterval"`
+}
+
+var DefaultPowParams = PowParams{
+	LimitBits:        0x1f00ffff,
+	TargetSpacing:    5 * time.Second,
+	RetargetInterval: 10,
+}
+
+// maxRetargetFactor bounds how much a single adjustment changes the target.
+const maxRetargetFactor = 4
+
+// ProofOfWork accepts blocks whose header hash is below a target that is
+// retargeted from the header timestamps. Anybody may mine, and competing
+// branches are resolved by cumulative work.
+type ProofOfWork struct {
+	params  PowParams
+	limit   *big.Int
+	workers int
+}
+
+func NewProofOfWork(params PowParams) *ProofOfWork {
+	return &ProofOfWork{
+		params:  params,
+		limit:   CompactToBig(params.LimitBits),
+		workers: runtime.GOMAXPROCS(0),
+	}
+}
+
+func (p *ProofOfWork) SelectProposer(chain ChainReader, height int32, timestamp int64) ([]byte, error) {
+	return nil, nil
+}
+
+// Propose mines the block, which is cancelled with ctx, and signs it with
+// the miner's key.
+func (p *ProofOfWork) Propose(ctx context.Context, chain ChainReader, block *proto.Block, key *encrypted.PrivateKey) error {
+	parent, err := chain.GetBlockByHash(block.Header.PrevHash)
+	if err != nil {
+		return err
+	}
+
+	bits, err := p.NextBits(chain, parent.Header)
+	if err != nil {
+		return err
+	}
+	block.Header.Bits = bits
+	mtp, err := MedianTimePast(chain, parent.Header)
+	if err != nil {
+		return err
+	}
+	if block.Header.Timestamp <= mtp {
+		block.Header.Timestamp = mtp + 1
+	}
+	if len(block.Transactions) > 0 {
+		tree, err := types.GetMerkleTree(block)
+		if err != nil {
+			return err
+		}
+		block.Header.RootHash = tree.MerkleRoot()
+	}
+	block.Header.EvidenceHash = types.HashEvidenceList(block.Evidence)
+
+	if !Mine(ctx, block.Header, CompactToBig(bits), p.workers) {
+		return ctx.Err()
+	}
+
+	types.SignBlock(key, block)
+
+	return nil
+}
+
+func (p *ProofOfWork) ValidateHeader(chain ChainReader, block *proto.Block) error {
+	parent, err := chain.GetBlockByHash(block.Header.PrevHash)
+	if err != nil {
+		return err
+	}
+	// bounded by the median time past here and by the local clock in the
+	// chain, so miners cannot warp the timestamps NextBits retargets from
+	mtp, err := MedianTimePast(chain, parent.Header)
+	if err != nil {
+		return err
+	}
+	if block.Header.Timestamp <= mtp {
+		return fmt.Errorf("block timestamp (%d) not after median time past (%d)", block.Header.Timestamp, mtp)
+	}
+
+	bits, err := p.NextBits(chain, parent.Header)
+	if err != nil {
+		return err
+	}
+	if block.Header.Bits != bits {
+		return fmt.Errorf("block target %08x instead of %08x", block.Header.Bits, bits)
+	}
+	if !CheckProofOfWork(block.Header) {
+		return fmt.Errorf("block hash above target %08x", bits)
+	}
+
+	if err := types.CheckBlock(block); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *ProofOfWork) Finalize(chain ChainReader, block *proto.Block) error {
+	return nil
+}
+
+// Work is the expected number of hashes needed to mine the header.
+func (p *ProofOfWork) Work(header *proto.Header) *big.Int {
+	bits := header.Bits
+	if bits == 0 {
+		bits = p.params.LimitBits
+	}
+
+	return Work(bits)
+}
+
+// NextBits returns the target of the block following parent. It changes
+// every RetargetInterval blocks by how far the timestamps of the last
+// interval are off TargetSpacing.
+func (p *ProofOfWork) NextBits(chain ChainReader, parent *proto.Header) (uint32, error) {
+	bits := parent.Bits
+	if bits == 0 {
+		bits = p.params.LimitBits
+	}
+
+	height := parent.Height + 1
+	if p.params.RetargetInterval <= 0 || height%p.params.RetargetInterval != 0 || height < p.params.RetargetInterval {
+		return bits, nil
+	}
+
+	first := parent
+	for i := int32(0); i < p.params.RetargetInterval-1; i++ {
+		block, err := chain.GetBlockByHash(first.PrevHash)
+		if err != nil {
+			return 0, err
+		}
+		first = block.Header
+	}
+
+	var (
+		expected = int64(p.params.TargetSpacing) * int64(p.params.RetargetInterval-1)
+		actual   = parent.Timestamp - first.Timestamp
+	)
+	if actual < expected/maxRetargetFactor {
+		actual = expected / maxRetargetFactor
+	}
+	if actual > expected*maxRetargetFactor {
+		actual = expected * maxRetargetFactor
+	}
+
+	target := CompactToBig(bits)
+	target.Mul(target, big.NewInt(actual))
+	target.Div(target, big.NewInt(expected))
+	if target.Cmp(p.limit) > 0 {
+		target.Set(p.limit)
+	}
+
+	return BigToCompact(target), nil
+}
+
+// CheckProofOfWork reports whether the header hash is at or below the
+// header's target.
+func CheckProofOfWork(header *proto.Header) bool {
+	target := CompactToBig(header.Bits)
+	if target.Sign() <= 0 {
+		return false
+	}
+
+	return new(big.Int).SetBytes(types.HashHeader(header)).Cmp(target) <= 0
+}
+
+// Mine searches the nonce space for a header hash at or below target,
+// spreading the search over workers goroutines. It sets the nonce found and
+// reports false if ctx is done first.
+func Mine(ctx context.Context, header *proto.Header, target *big.Int, workers int) bool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	found := make(chan uint64, workers)
+	for i := 0; i < workers; i++ {
+		go func(start uint64) {
+			var (
+				candidate = pb.Clone(header).(*proto.Header)
+				hash      = new(big.Int)
+			)
+
+			for i := uint64(0); ; i++ {
+				// checking ctx on every hash would dominate the work
+				if i%1024 == 0 && ctx.Err() != nil {
+					return
+				}
+
+				nonce := start + i*uint64(workers)
+				candidate.Nonce = nonce
+				if hash.SetBytes(types.HashHeader(candidate)).Cmp(target) <= 0 {
+					found <- nonce
+					return
+				}
+			}
+		}(uint64(i))
+	}
+
+	select {
+	case nonce := <-found:
+		header.Nonce = nonce
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// CompactToBig decodes a target in the compact form used in headers: the
+// high byte is the length of the number in bytes, the low three bytes its
+// most significant bytes.
+func CompactToBig(compact uint32) *big.Int {
+	var (
+		mantissa = int64(compact & 0x007fffff)
+		exponent = uint(compact >> 24)
+		target   = big.NewInt(mantissa)
+	)
+	if exponent <= 3 {
+		return target.Rsh(target, 8*(3-exponent))
+	}
+
+	return target.Lsh(target, 8*(exponent-3))
+}
+
+// BigToCompact encodes a target in compact form, dropping the bytes below
+// the three most significant ones.
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+
+	var (
+		exponent = uint((target.BitLen() + 7) / 8)
+		mantissa uint32
+	)
+	if exponent <= 3 {
+		mantissa = uint32(target.Uint64() << (8 * (3 - exponent)))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(target, 8*(exponent-3)).Uint64())
+	}
+
+	// the sign bit of the mantissa is not part of the number
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	return uint32(exponent)<<24 | mantissa
+}
+
+// Work returns 2^256 / (target+1), the expected number of hashes needed to
+// meet the target.
+func Work(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), denominator)
+}
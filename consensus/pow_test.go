@@ -0,0 +1,133 @@
+package consensus
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+// testPowParams make blocks cheap to mine.
+var testPowParams = PowParams{
+	LimitBits:        0x207fffff,
+	TargetSpacing:    time.Second,
+	RetargetInterval: 4,
+}
+
+func TestCompactEncoding(t *testing.T) {
+	for _, compact := range []uint32{0x1d00ffff, 0x1f00ffff, 0x207fffff, 0x1b0404cb, 0x03123456} {
+		assert.Equal(t, compact, BigToCompact(CompactToBig(compact)), "%08x", compact)
+	}
+
+	target := CompactToBig(0x1d00ffff)
+	assert.Equal(t, "ffff0000000000000000000000000000000000000000000000000000", target.Text(16))
+
+	assert.Equal(t, 0, Work(0x1d00ffff).Cmp(big.NewInt(0x100010001)))
+	assert.Equal(t, 1, Work(0x1b0404cb).Cmp(Work(0x1d00ffff)))
+}
+
+func TestMine(t *testing.T) {
+	header := &proto.Header{Version: 1, Height: 1, Bits: 0x1f00ffff}
+
+	require.True(t, Mine(context.Background(), header, CompactToBig(header.Bits), 4))
+	assert.True(t, CheckProofOfWork(header))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, Mine(ctx, &proto.Header{Bits: 0x03000001}, CompactToBig(0x03000001), 4))
+}
+
+func mineChain(t *testing.T, engine *ProofOfWork, key *encrypted.PrivateKey, spacing time.Duration, n int) testChain {
+	chain := newTestChain()
+	for i := 0; i < n; i++ {
+		block := nextBlock(chain, time.Duration(i+1)*spacing)
+		require.Nil(t, engine.Propose(context.Background(), chain, block, key))
+		require.Nil(t, engine.ValidateHeader(chain, block))
+		chain = append(chain, block)
+	}
+
+	return chain
+}
+
+func TestProofOfWorkRetarget(t *testing.T) {
+	var (
+		key    = encrypted.GeneratePrivateKey()
+		engine = NewProofOfWork(PowParams{
+			LimitBits:        0x1f00ffff,
+			TargetSpacing:    time.Second,
+			RetargetInterval: 4,
+		})
+	)
+
+	// blocks twice as fast as the spacing halve the target
+	fast := mineChain(t, engine, key, 500*time.Millisecond, 4)
+	assert.Equal(t, uint32(0x1f00ffff), fast[3].Header.Bits)
+	assert.Equal(t, BigToCompact(new(big.Int).Rsh(CompactToBig(0x1f00ffff), 1)), fast[4].Header.Bits)
+
+	// blocks slower than the spacing cannot go above the limit
+	slow := mineChain(t, engine, key, 10*time.Second, 4)
+	assert.Equal(t, uint32(0x1f00ffff), slow[4].Header.Bits)
+}
+
+func TestProofOfWorkValidateHeader(t *testing.T) {
+	var (
+		key    = encrypted.GeneratePrivateKey()
+		engine = NewProofOfWork(testPowParams)
+		chain  = newTestChain()
+		block  = nextBlock(chain, time.Second)
+	)
+
+	proposer, err := engine.SelectProposer(chain, 1, 0)
+	require.Nil(t, err)
+	assert.Nil(t, proposer)
+
+	require.Nil(t, engine.Propose(context.Background(), chain, block, key))
+	require.Nil(t, engine.ValidateHeader(chain, block))
+
+	// a harder target than required is still the wrong one
+	block.Header.Bits = 0x1f00ffff
+	types.SignBlock(key, block)
+	assert.NotNil(t, engine.ValidateHeader(chain, block))
+
+	// a block that does not meet its target
+	strict := NewProofOfWork(PowParams{LimitBits: 0x03000001})
+	block.Header.Bits = 0x03000001
+	types.SignBlock(key, block)
+	assert.NotNil(t, strict.ValidateHeader(chain, block))
+}
+
+func TestProofOfWorkRejectsTimestampBeforeMedianTimePast(t *testing.T) {
+	var (
+		key    = encrypted.GeneratePrivateKey()
+		engine = NewProofOfWork(testPowParams)
+		chain  = mineChain(t, engine, key, time.Second, 12)
+	)
+
+	mtp, err := MedianTimePast(chain, chain[12].Header)
+	require.Nil(t, err)
+	assert.Equal(t, int64(7*time.Second), mtp)
+
+	// after the median, although before its parent
+	block := nextBlock(chain, 8*time.Second)
+	require.Nil(t, engine.Propose(context.Background(), chain, block, key))
+	assert.Nil(t, engine.ValidateHeader(chain, block))
+
+	// a timestamp at the median is warped back
+	block = nextBlock(chain, 7*time.Second)
+	block.Header.Bits, err = engine.NextBits(chain, chain[12].Header)
+	require.Nil(t, err)
+	require.True(t, Mine(context.Background(), block.Header, CompactToBig(block.Header.Bits), 1))
+	types.SignBlock(key, block)
+	assert.NotNil(t, engine.ValidateHeader(chain, block))
+
+	// Propose moves such a timestamp past the median
+	require.Nil(t, engine.Propose(context.Background(), chain, block, key))
+	assert.Equal(t, mtp+1, block.Header.Timestamp)
+	assert.Nil(t, engine.ValidateHeader(chain, block))
+}
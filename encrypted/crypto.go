@@ -5,6 +5,8 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"io"
+
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
 )
 
 const (
@@ -19,30 +21,47 @@ type PrivateKey struct {
 	key ed25519.PrivateKey
 }
 
-func NewPrivateKeyFromString(s string) *PrivateKey {
-	b, err := hex.DecodeString(s)
-	if err != nil {
-		panic(err)
-	}
+// The New and FromBytes constructors panic on malformed input and are meant
+// for keys known to be valid. Input from files or peers goes through the
+// Parse functions instead.
 
-	return NewPrivateKeyFromSeed(b)
+func NewPrivateKeyFromString(s string) *PrivateKey {
+	return must(ParsePrivateKeyString(s))
 }
 
 func NewPrivateKeyFromSeedString(seed string) *PrivateKey {
-	seedBytes, err := hex.DecodeString(seed)
+	return must(ParsePrivateKeyString(seed))
+}
+
+func NewPrivateKeyFromSeed(seed []byte) *PrivateKey {
+	return must(ParsePrivateKeySeed(seed))
+}
+
+// ParsePrivateKeyString returns the key of a hex encoded seed.
+func ParsePrivateKeyString(seed string) (*PrivateKey, error) {
+	b, err := hex.DecodeString(seed)
 	if err != nil {
-		panic(err)
+		return nil, errors.Wrap(errors.ErrInvalidRequest, err.Error())
 	}
 
-	return NewPrivateKeyFromSeed(seedBytes)
+	return ParsePrivateKeySeed(b)
 }
 
-func NewPrivateKeyFromSeed(seed []byte) *PrivateKey {
+// ParsePrivateKeySeed returns the key derived from seed.
+func ParsePrivateKeySeed(seed []byte) (*PrivateKey, error) {
 	if len(seed) != SeedLen {
-		panic("invalid seed length")
+		return nil, errors.Wrapf(errors.ErrInvalidRequest, "invalid seed length %d", len(seed))
 	}
 
-	return &PrivateKey{key: ed25519.NewKeyFromSeed(seed)}
+	return &PrivateKey{key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
 }
 
 func GeneratePrivateKey() *PrivateKey {
@@ -59,6 +78,12 @@ func (p *PrivateKey) Bytes() []byte {
 	return p.key
 }
 
+// Seed returns the seed the key derives from, which NewPrivateKeyFromSeed
+// turns back into the key.
+func (p *PrivateKey) Seed() []byte {
+	return p.key.Seed()
+}
+
 func (p *PrivateKey) Sign(msg []byte) *Signature {
 	return &Signature{value: ed25519.Sign(p.key, msg)}
 }
@@ -75,11 +100,16 @@ type PublicKey struct {
 }
 
 func PublicKeyFromBytes(b []byte) *PublicKey {
+	return must(ParsePublicKey(b))
+}
+
+// ParsePublicKey returns the public key encoded in b.
+func ParsePublicKey(b []byte) (*PublicKey, error) {
 	if len(b) != PublicKeyLen {
-		panic("invalid public key length")
+		return nil, errors.Wrapf(errors.ErrInvalidPubKey, "invalid public key length %d", len(b))
 	}
 
-	return &PublicKey{key: b}
+	return &PublicKey{key: b}, nil
 }
 
 func (p *PublicKey) Address() Address {
@@ -90,16 +120,44 @@ func (p *PublicKey) Bytes() []byte {
 	return p.key
 }
 
+func (p *PublicKey) String() string {
+	return hex.EncodeToString(p.key)
+}
+
+// MarshalText encodes the key in hex, so keys read well in JSON.
+func (p *PublicKey) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *PublicKey) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	key, err := ParsePublicKey(b)
+	if err != nil {
+		return err
+	}
+	*p = *key
+
+	return nil
+}
+
 type Signature struct {
 	value []byte
 }
 
 func SignatureFromBytes(b []byte) *Signature {
+	return must(ParseSignature(b))
+}
+
+// ParseSignature returns the signature encoded in b.
+func ParseSignature(b []byte) (*Signature, error) {
 	if len(b) != SignatureLen {
-		panic("invalid signature length")
+		return nil, errors.Wrapf(errors.ErrUnauthorized, "invalid signature length %d", len(b))
 	}
 
-	return &Signature{value: b}
+	return &Signature{value: b}, nil
 }
 
 func (s *Signature) Bytes() []byte {
@@ -115,11 +173,16 @@ type Address struct {
 }
 
 func AddressFromBytes(b []byte) Address {
+	return must(ParseAddress(b))
+}
+
+// ParseAddress returns the address encoded in b.
+func ParseAddress(b []byte) (Address, error) {
 	if len(b) != AddressLen {
-		panic("invalid address length")
+		return Address{}, errors.Wrapf(errors.ErrInvalidAddress, "invalid address length %d", len(b))
 	}
 
-	return Address{value: b}
+	return Address{value: b}, nil
 }
 
 func (a Address) Bytes() []byte {
@@ -46,3 +46,44 @@ func TestNewPrivateKeyFromString(t *testing.T) {
 	address := privateKey.Public().Address()
 	assert.Equal(t, addressStr, address.String())
 }
+
+func TestPublicKeyText(t *testing.T) {
+	var (
+		publicKey = GeneratePrivateKey().Public()
+		decoded   PublicKey
+	)
+
+	text, err := publicKey.MarshalText()
+	assert.Nil(t, err)
+	assert.Nil(t, decoded.UnmarshalText(text))
+	assert.Equal(t, publicKey.Bytes(), decoded.Bytes())
+
+	assert.NotNil(t, decoded.UnmarshalText([]byte("abcd")))
+	assert.NotNil(t, decoded.UnmarshalText([]byte("not hex")))
+}
+
+func TestPrivateKeySeed(t *testing.T) {
+	privateKey := GeneratePrivateKey()
+
+	assert.Equal(t, privateKey.Bytes(), NewPrivateKeyFromSeed(privateKey.Seed()).Bytes())
+}
+
+func TestParseRejectsMalformedInput(t *testing.T) {
+	_, err := ParsePrivateKeySeed(make([]byte, SeedLen-1))
+	assert.NotNil(t, err)
+	_, err = ParsePrivateKeyString("not hex")
+	assert.NotNil(t, err)
+	_, err = ParsePublicKey(make([]byte, PublicKeyLen+1))
+	assert.NotNil(t, err)
+	_, err = ParseSignature(nil)
+	assert.NotNil(t, err)
+	_, err = ParseAddress(make([]byte, AddressLen-1))
+	assert.NotNil(t, err)
+
+	privateKey := GeneratePrivateKey()
+	publicKey, err := ParsePublicKey(privateKey.Public().Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, privateKey.Public().Address(), publicKey.Address())
+
+	assert.Panics(t, func() { PublicKeyFromBytes(nil) })
+}
@@ -158,6 +158,14 @@ var (
 	// supplied.
 	ErrInvalidGasLimit = Register(Codespace, 41, "invalid gas limit")
 
+	// ErrTxNotFinal defines an error when a transaction is time locked past
+	// the block it would be included in.
+	ErrTxNotFinal = Register(Codespace, 42, "transaction not final")
+
+	// ErrScript defines an error when a script is malformed or does not
+	// unlock the output it spends.
+	ErrScript = Register(Codespace, 43, "script failed")
+
 	// ErrPanic is only set when we recover from a panic, so we know to
 	// redact potentially sensitive system info
 	ErrPanic = sdkerrors.ErrPanic
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/nodes"
+)
+
+// allocations collects repeated -alloc address=amount flags.
+type allocations map[string]int64
+
+func (a allocations) String() string {
+	var pairs []string
+	for address, amount := range a {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", address, amount))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (a allocations) Set(value string) error {
+	address, amount, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("allocation %q is not address=amount", value)
+	}
+
+	n, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil {
+		return fmt.Errorf("allocation %q: %w", value, err)
+	}
+	a[address] += n
+
+	return nil
+}
+
+// genesisInit implements `genesis init`: it generates the validator keys of
+// a new network and writes its genesis file.
+func genesisInit(args []string) error {
+	var (
+		fs         = flag.NewFlagSet("genesis init", flag.ExitOnError)
+		out        = fs.String("out", "genesis.json", "genesis file to write")
+		keysDir    = fs.String("keys", "keys", "directory to write the validator keys to")
+		chainID    = fs.String("chain-id", "local", "chain ID of the network")
+		engine     = fs.String("engine", nodes.EnginePoA, "consensus engine: poa, bft, pos or pow")
+		validators = fs.Int("validators", 3, "number of validators to generate")
+		allocs     = allocations{}
+	)
+	fs.Var(allocs, "alloc", "genesis allocation as address=amount, repeatable")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	genesis := nodes.Genesis{
+		ChainID:     *chainID,
+		Time:        time.Now().UTC().Truncate(time.Second),
+		Allocations: allocs,
+		Engine:      *engine,
+	}.WithDefaults()
+
+	if err := os.MkdirAll(*keysDir, 0o700); err != nil {
+		return err
+	}
+	for i := 0; i < *validators; i++ {
+		key := encrypted.GeneratePrivateKey()
+		if err := os.WriteFile(keyPath(*keysDir, i), []byte(hex.EncodeToString(key.Seed())+"\n"), 0o600); err != nil {
+			return err
+		}
+		genesis.Validators = append(genesis.Validators, key.Public())
+	}
+
+	if _, err := genesis.Block(); err != nil {
+		return err
+	}
+	if err := genesis.Save(*out); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s and %d validator keys to %s\n", *out, *validators, *keysDir)
+
+	return nil
+}
+
+func keyPath(dir string, i int) string {
+	return filepath.Join(dir, fmt.Sprintf("validator-%d.key", i))
+}
+
+func loadKey(path string) (*encrypted.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := encrypted.ParsePrivateKeyString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+
+	return key, nil
+}
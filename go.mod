@@ -4,6 +4,7 @@ go 1.22.3
 
 require (
 	cosmossdk.io/errors v1.0.1
+	github.com/cbergoon/merkletree v0.2.0
 	github.com/stretchr/testify v1.9.0
 	go.uber.org/zap v1.27.0
 	google.golang.org/grpc v1.60.1
@@ -11,7 +12,6 @@ require (
 )
 
 require (
-	github.com/cbergoon/merkletree v0.2.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
@@ -2,62 +2,132 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
-	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/nodes"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/util"
 	"google.golang.org/grpc"
 )
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
-	validatorIndex := rand.Intn(3)
+	if len(os.Args) > 2 && os.Args[1] == "genesis" && os.Args[2] == "init" {
+		if err := genesisInit(os.Args[3:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var (
+		genesisPath = flag.String("genesis", "", "genesis file; without one a throwaway network is created")
+		keysDir     = flag.String("keys", "keys", "directory holding the validator keys of the genesis file")
+	)
+	flag.Parse()
+
+	genesis, keys, err := loadNetwork(*genesisPath, *keysDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	makeNode("localhost:3000", []string{}, validatorIndex == 0)
-	time.Sleep(time.Second)
-	makeNode("localhost:3001", []string{"localhost:3000"}, validatorIndex == 1)
-	time.Sleep(time.Second)
-	makeNode("localhost:3002", []string{"localhost:3001"}, validatorIndex == 2)
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		var (
+			addr      = fmt.Sprintf("localhost:%d", 3000+i)
+			bootstrap []string
+		)
+		if i > 0 {
+			bootstrap = []string{fmt.Sprintf("localhost:%d", 3000+i-1)}
+			time.Sleep(time.Second)
+		}
+		makeNode(ctx, &wg, addr, bootstrap, genesis, key)
+	}
 
 	for {
-		time.Sleep(time.Second)
-		makeTransaction()
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-time.After(time.Second):
+			makeTransaction(genesis.ChainID)
+		}
+	}
+}
+
+// loadNetwork loads the genesis file and a node key for every validator, or
+// generates a network of three validators if there is no genesis file.
+func loadNetwork(genesisPath, keysDir string) (nodes.Genesis, []*encrypted.PrivateKey, error) {
+	var keys []*encrypted.PrivateKey
+	if genesisPath == "" {
+		genesis := nodes.Genesis{ChainID: "local"}
+		for i := 0; i < 3; i++ {
+			key := encrypted.GeneratePrivateKey()
+			keys = append(keys, key)
+			genesis.Validators = append(genesis.Validators, key.Public())
+		}
+		return genesis, keys, nil
+	}
+
+	genesis, err := nodes.LoadGenesis(genesisPath)
+	if err != nil {
+		return genesis, nil, err
+	}
+	for i := range genesis.Validators {
+		key, err := loadKey(keyPath(keysDir, i))
+		if err != nil {
+			return genesis, nil, err
+		}
+		keys = append(keys, key)
 	}
+
+	return genesis, keys, nil
 }
 
-func makeNode(listenAddr string, bootstrapNodes []string, isValidator bool) *nodes.Node {
+func makeNode(ctx context.Context, wg *sync.WaitGroup, listenAddr string, bootstrapNodes []string, genesis nodes.Genesis, privKey *encrypted.PrivateKey) *nodes.Node {
 	cfg := nodes.ServerConfig{
-		Version:    "0.0.1",
-		ListenAddr: listenAddr,
+		Version:        "0.0.1",
+		ListenAddr:     listenAddr,
+		BootstrapNodes: bootstrapNodes,
+		Genesis:        genesis,
+		PrivateKey:     privKey,
 	}
-	// if isValidator {
-	// 	privKey := encrypted.GeneratePrivateKey()
-	// 	cfg.PrivateKey = privKey
-	// }
 
 	n := nodes.NewNode(cfg)
+	wg.Add(1)
 	go func() {
-		log.Fatal(n.Start(listenAddr, bootstrapNodes))
+		defer wg.Done()
+		if err := n.Start(ctx); err != nil {
+			log.Fatal(err)
+		}
 	}()
 
 	return n
 }
 
-func makeTransaction() {
+func makeTransaction(chainID string) {
 	client, err := grpc.Dial("localhost:3000", grpc.WithInsecure())
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer client.Close()
 
 	c := proto.NewNodeClient(client)
 	privKey := encrypted.GeneratePrivateKey()
 
 	tx := &proto.Transaction{
 		Version: 1,
+		ChainId: chainID,
 		Inputs: []*proto.TxInput{
 			{
 				PrevTxHash:   util.RandomHash(),
@@ -73,6 +143,12 @@ func makeTransaction() {
 		},
 	}
 
+	sig, err := types.SignTransaction(privKey, tx, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tx.Inputs[0].Signature = sig.Bytes()
+
 	_, err = c.HandleTransaction(context.TODO(), tx)
 	if err != nil {
 		log.Fatal(err)
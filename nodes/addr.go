@@ -0,0 +1,179 @@
+package nodes
+
+import (
+	"context"
+	"net"
+
+	grpcpeer "google.golang.org/grpc/peer"
+)
+
+// advertisedAddr is the address we tell peers to reach us on: AdvertiseAddr
+// when configured, otherwise the listen address, with an unspecified host
+// replaced by the one peers observed us on.
+func (n *Node) advertisedAddr() string {
+	if n.AdvertiseAddr != "" {
+		return n.AdvertiseAddr
+	}
+
+	host, port, err := net.SplitHostPort(n.ListenAddr)
+	if err != nil || !isUnspecifiedHost(host) {
+		return n.ListenAddr
+	}
+
+	n.addrLock.RLock()
+	defer n.addrLock.RUnlock()
+
+	if n.observedHost == "" {
+		return n.ListenAddr
+	}
+
+	return net.JoinHostPort(n.observedHost, port)
+}
+
+const (
+	// observedAddrQuorum is how many peers, on hosts of their own, have to
+	// see us on a host before we advertise it.
+	observedAddrQuorum = 2
+	// maxObservedVoters bounds the peers whose observations we keep.
+	maxObservedVoters = 64
+)
+
+// learnObservedAddr records the host the peer on host from reached us on,
+// once the handshake with it completed. We advertise the host most peers
+// agree on, once at least observedAddrQuorum do, while we do not know our
+// own external address; every peer host counts once, for the last host it
+// saw us on.
+func (n *Node) learnObservedAddr(observed, from string) {
+	host, _, err := net.SplitHostPort(observed)
+	if err != nil || !n.isRoutable(observed) {
+		return
+	}
+	if fromHost, _, err := net.SplitHostPort(from); err == nil {
+		from = fromHost
+	}
+
+	n.addrLock.Lock()
+	defer n.addrLock.Unlock()
+
+	if previous, ok := n.observedBy[from]; ok {
+		delete(n.observedVotes[previous], from)
+		if len(n.observedVotes[previous]) == 0 {
+			delete(n.observedVotes, previous)
+		}
+	} else if len(n.observedBy) >= maxObservedVoters {
+		return
+	}
+	n.observedBy[from] = host
+	if n.observedVotes[host] == nil {
+		n.observedVotes[host] = make(map[string]bool)
+	}
+	n.observedVotes[host][from] = true
+
+	votes := len(n.observedVotes[host])
+	if host == n.observedHost || votes < observedAddrQuorum || votes <= len(n.observedVotes[n.observedHost]) {
+		return
+	}
+	n.logger.Debugw("Learned observed address", "ourNode", n.ListenAddr, "host", host, "peers", votes)
+	n.observedHost = host
+}
+
+// isSelf reports whether addr is one of the addresses we are known by,
+// including those a single peer saw us on.
+func (n *Node) isSelf(addr string) bool {
+	if addr == n.ListenAddr || addr == n.advertisedAddr() {
+		return true
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if _, ourPort, err := net.SplitHostPort(n.ListenAddr); err != nil || port != ourPort {
+		return false
+	}
+
+	n.addrLock.RLock()
+	defer n.addrLock.RUnlock()
+
+	return len(n.observedVotes[host]) > 0
+}
+
+// isRoutable reports whether peers could reach addr. Loopback addresses
+// only count when we are on loopback ourselves, as on a local test network.
+func (n *Node) isRoutable(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || port == "" || port == "0" {
+		return false
+	}
+	if isUnspecifiedHost(host) {
+		return false
+	}
+
+	if isLoopbackHost(host) {
+		ourHost, _, err := net.SplitHostPort(n.advertisedAddr())
+		return err == nil && isLoopbackHost(ourHost)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return true
+	}
+
+	return !ip.IsMulticast() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast()
+}
+
+// remoteAddr is the listen address of the peer calling us: the host we see
+// the call coming from with the port it says it listens on.
+func remoteAddr(ctx context.Context, listenAddr string) string {
+	_, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return ""
+	}
+
+	p, ok := grpcpeer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return ""
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// withHost replaces an unspecified host in addr with the host of fallback.
+func withHost(addr, fallback string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || !isUnspecifiedHost(host) {
+		return addr
+	}
+
+	fallbackHost, _, err := net.SplitHostPort(fallback)
+	if err != nil {
+		return addr
+	}
+
+	return net.JoinHostPort(fallbackHost, port)
+}
+
+func isUnspecifiedHost(host string) bool {
+	if host == "" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsUnspecified()
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,106 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestIsRoutable(t *testing.T) {
+	n := NewNode(ServerConfig{ListenAddr: "10.0.0.1:3000"})
+
+	assert.True(t, n.isRoutable("10.0.0.2:3000"))
+	assert.True(t, n.isRoutable("seed.example.org:3000"))
+	assert.False(t, n.isRoutable("0.0.0.0:3000"))
+	assert.False(t, n.isRoutable("[::]:3000"))
+	assert.False(t, n.isRoutable(":3000"))
+	assert.False(t, n.isRoutable("10.0.0.2:0"))
+	assert.False(t, n.isRoutable("169.254.0.1:3000"))
+	assert.False(t, n.isRoutable("10.0.0.2"))
+	assert.False(t, n.isRoutable("127.0.0.1:3000"))
+	assert.False(t, n.isRoutable("localhost:3000"))
+
+	// a node on loopback is on a local test network
+	local := NewNode(ServerConfig{ListenAddr: "127.0.0.1:3000"})
+	assert.True(t, local.isRoutable("127.0.0.1:3001"))
+	assert.True(t, local.isRoutable("localhost:3001"))
+}
+
+func TestAdvertisedAddr(t *testing.T) {
+	n := NewNode(ServerConfig{ListenAddr: "0.0.0.0:3000"})
+	assert.Equal(t, "0.0.0.0:3000", n.advertisedAddr())
+
+	n.learnObservedAddr("0.0.0.0:1234", "198.51.100.2:3000")
+	n.learnObservedAddr("0.0.0.0:1234", "198.51.100.3:3000")
+	assert.Equal(t, "0.0.0.0:3000", n.advertisedAddr())
+
+	// one peer is not enough, however often it tells us
+	n.learnObservedAddr("203.0.113.7:1234", "198.51.100.2:3000")
+	n.learnObservedAddr("203.0.113.7:1234", "198.51.100.2:4000")
+	assert.Equal(t, "0.0.0.0:3000", n.advertisedAddr())
+
+	n.learnObservedAddr("203.0.113.7:1234", "198.51.100.3:3000")
+	assert.Equal(t, "203.0.113.7:3000", n.advertisedAddr())
+	assert.True(t, n.isSelf("203.0.113.7:3000"))
+
+	// later observations replace it once more peers agree on them
+	n.learnObservedAddr("203.0.113.8:1234", "198.51.100.4:3000")
+	n.learnObservedAddr("203.0.113.8:1234", "198.51.100.5:3000")
+	assert.Equal(t, "203.0.113.7:3000", n.advertisedAddr())
+	n.learnObservedAddr("203.0.113.8:1234", "198.51.100.2:3000")
+	assert.Equal(t, "203.0.113.8:3000", n.advertisedAddr())
+
+	configured := NewNode(ServerConfig{ListenAddr: "0.0.0.0:3000", AdvertiseAddr: "198.51.100.1:4000"})
+	configured.learnObservedAddr("203.0.113.7:1234", "198.51.100.2:3000")
+	configured.learnObservedAddr("203.0.113.7:1234", "198.51.100.3:3000")
+	assert.Equal(t, "198.51.100.1:4000", configured.advertisedAddr())
+}
+
+func TestWildcardNodesAdvertiseReachableAddresses(t *testing.T) {
+	var (
+		network = NewMemoryNetwork()
+		machine = []string{"10.0.0.1:3000", "10.0.0.2:3000", "10.0.0.3:3000"}
+		nodes   []*Node
+	)
+	for i, addr := range machine {
+		cfg := ServerConfig{
+			ListenAddr: "0.0.0.0:3000",
+			Transport:  network.Transport(addr),
+			Logger:     zap.NewNop().Sugar(),
+		}
+		if i > 0 {
+			cfg.BootstrapNodes = []string{machine[i-1]}
+		}
+
+		n := NewNode(cfg)
+		go n.Start(context.Background())
+		t.Cleanup(n.Stop)
+		nodes = append(nodes, n)
+
+		require.Eventually(t, func() bool {
+			return network.Listening(addr) && len(n.Peers()) >= min(i, 1)
+		}, 5*time.Second, time.Millisecond)
+	}
+
+	// the last node only learns about the first one through gossip
+	require.Eventually(t, func() bool {
+		for _, n := range nodes {
+			if len(n.Peers()) != len(nodes)-1 {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for i, n := range nodes {
+		assert.Equal(t, machine[i], n.advertisedAddr())
+		for _, addr := range n.Peers() {
+			assert.NotEqual(t, "0.0.0.0:3000", addr)
+			assert.NotEqual(t, machine[i], addr)
+		}
+	}
+}
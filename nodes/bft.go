@@ -0,0 +1,615 @@
+package nodes
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/consensus"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+	pb "google.golang.org/protobuf/proto"
+)
+
+const (
+	proposeTimeout   = 3 * time.Second
+	prevoteTimeout   = time.Second
+	precommitTimeout = time.Second
+	// roundTimeoutDelta grows every timeout with the round so validators
+	// with slow links eventually get to vote in time.
+	roundTimeoutDelta = 500 * time.Millisecond
+	// rebroadcastInterval is how often a validator stuck in a round sends its
+	// proposal and votes again, so peers that missed them catch up once
+	// links recover.
+	rebroadcastInterval = 2 * time.Second
+	// maxPendingBytes bounds the encoded size of the votes and proposals for
+	// the next height kept while we still wait for the current one to
+	// commit, a few times the largest message gRPC accepts.
+	maxPendingBytes = 16 << 20
+)
+
+type roundStep int
+
+const (
+	stepPropose roundStep = iota
+	stepPrevote
+	stepPrecommit
+	stepCommit
+)
+
+type timeoutEvent struct {
+	height int32
+	round  int32
+	step   roundStep
+}
+
+type proposalEvent struct {
+	round int32
+	block *proto.Block
+}
+
+// heightEvent tells the consensus loop the chain moved on without it.
+type heightEvent struct{}
+
+// roundState is the state of a validator voting on one height.
+type roundState struct {
+	height int32
+	round  int32
+	step   roundStep
+
+	proposals  map[int32]*proto.Block
+	prevotes   map[int32]*consensus.VoteSet
+	precommits map[int32]*consensus.VoteSet
+	// timeouts holds the timeouts already scheduled.
+	timeouts map[timeoutEvent]bool
+
+	lockedBlock *proto.Block
+	lockedRound int32
+	validBlock  *proto.Block
+	validRound  int32
+
+	// our proposal and votes of the current round
+	ownProposal *proto.Proposal
+	ownVotes    []*proto.Vote
+
+	pending      []any
+	pendingBytes int
+}
+
+func newRoundState(height int32) *roundState {
+	return &roundState{
+		height:      height,
+		proposals:   make(map[int32]*proto.Block),
+		prevotes:    make(map[int32]*consensus.VoteSet),
+		precommits:  make(map[int32]*consensus.VoteSet),
+		timeouts:    make(map[timeoutEvent]bool),
+		lockedRound: -1,
+		validRound:  -1,
+	}
+}
+
+func (rs *roundState) votes(voteType proto.VoteType, round int32) *consensus.VoteSet {
+	sets := rs.prevotes
+	if voteType == proto.VoteType_VOTE_PRECOMMIT {
+		sets = rs.precommits
+	}
+
+	set, ok := sets[round]
+	if !ok {
+		set = consensus.NewVoteSet()
+		sets[round] = set
+	}
+
+	return set
+}
+
+// proposal returns the block with the given hash proposed in any round.
+func (rs *roundState) proposal(hash []byte) *proto.Block {
+	for _, block := range rs.proposals {
+		if bytes.Equal(types.HashBlock(block), hash) {
+			return block
+		}
+	}
+
+	return nil
+}
+
+func (n *Node) HandleProposal(ctx context.Context, proposal *proto.Proposal) (*proto.Ack, error) {
+	if n.bft == nil {
+		return &proto.Ack{}, nil
+	}
+
+	block := proposal.Block
+	if block == nil || block.Header == nil {
+		return nil, fmt.Errorf("proposal without block")
+	}
+	// only the next two heights are of use to the consensus loop
+	if block.Header.Height <= int32(n.chain.Height()) || block.Header.Height > int32(n.chain.Height())+2 {
+		return &proto.Ack{}, nil
+	}
+
+	key := fmt.Sprintf("proposal/%x/%d", types.HashBlock(block), proposal.Round)
+	if !n.seen.Add(key) {
+		return &proto.Ack{}, nil
+	}
+	// proposals for the height after the next one cannot be validated
+	// against the chain before we get there; they are kept for then but not
+	// relayed, once their proposer and signature check out
+	next := block.Header.Height == int32(n.chain.Height())+1
+	validate := n.validateProposal
+	if !next {
+		validate = n.checkProposer
+	}
+	if err := validate(proposal.Round, block); err != nil {
+		// the key only covers the header, which anybody can sign
+		n.seen.Remove(key)
+		return nil, err
+	}
+	if next {
+		n.broadcastProposal(key, proposal)
+	}
+	n.deliver(proposalEvent{round: proposal.Round, block: block})
+
+	return &proto.Ack{}, nil
+}
+
+func (n *Node) HandleVote(ctx context.Context, vote *proto.Vote) (*proto.Ack, error) {
+	if n.bft == nil {
+		return &proto.Ack{}, nil
+	}
+	if vote.Height <= int32(n.chain.Height()) {
+		return &proto.Ack{}, nil
+	}
+	if err := n.bft.VerifyVote(vote); err != nil {
+		return nil, err
+	}
+
+	key := "vote/" + hex.EncodeToString(types.HashVote(vote))
+	if !n.seen.Add(key) {
+		return &proto.Ack{}, nil
+	}
+	n.broadcastVote(key, vote)
+	n.deliver(vote)
+
+	return &proto.Ack{}, nil
+}
+
+// validateProposal checks that block was proposed by the proposer of round
+// and extends the chain tip.
+func (n *Node) validateProposal(round int32, block *proto.Block) error {
+	if err := n.checkProposer(round, block); err != nil {
+		return err
+	}
+
+	return n.chain.ValidateProposal(block)
+}
+
+// checkProposer checks that block is signed by the proposer of round,
+// without looking at the chain.
+func (n *Node) checkProposer(round int32, block *proto.Block) error {
+	if proposer := n.bft.Proposer(block.Header.Height, round); !bytes.Equal(block.PublicKey, proposer) {
+		return errors.Wrapf(errors.ErrUnauthorized, "proposal of round %d signed by %x instead of proposer %x", round, block.PublicKey, proposer)
+	}
+
+	return types.CheckBlock(block)
+}
+
+// deliver hands a message from a peer to the consensus loop if this node
+// runs one. A message that does not fit in the queue is dropped rather than
+// stalling the handler; proposals and votes are rebroadcast until they are
+// acted on. Timeouts are never dropped, see scheduleTimeout.
+func (n *Node) deliver(msg any) {
+	if n.consensusMsgs == nil {
+		return
+	}
+
+	select {
+	case n.consensusMsgs <- msg:
+	default:
+		n.logger.Debugw("Dropped consensus message", "type", fmt.Sprintf("%T", msg))
+	}
+}
+
+func (n *Node) broadcastProposal(key string, proposal *proto.Proposal) {
+	n.broadcast(key, func(ctx context.Context, p *peer) error {
+		_, err := p.client.HandleProposal(ctx, proposal)
+		return err
+	})
+}
+
+func (n *Node) broadcastVote(key string, vote *proto.Vote) {
+	n.broadcast(key, func(ctx context.Context, p *peer) error {
+		_, err := p.client.HandleVote(ctx, vote)
+		return err
+	})
+}
+
+// broadcast sends a consensus message to every peer we have not sent it to.
+// Votes and proposals are small and urgent, so they are pushed rather than
+// announced.
+func (n *Node) broadcast(key string, send func(context.Context, *peer) error) {
+	for _, p := range n.getPeers() {
+		if !p.known.Add(key) {
+			continue
+		}
+		n.send(p, send)
+	}
+}
+
+func (n *Node) send(p *peer, send func(context.Context, *peer) error) {
+	n.spawn(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		defer cancel()
+
+		if err := send(ctx, p); err != nil {
+			n.logger.Debugw("Broadcast error", "remoteNode", p.version.ListenAddr, "error", err)
+		}
+	})
+}
+
+// rebroadcast sends our proposal and votes of the current round to every
+// peer again.
+func (n *Node) rebroadcast(rs *roundState) {
+	if rs.step == stepCommit {
+		return
+	}
+
+	for _, p := range n.getPeers() {
+		if proposal := rs.ownProposal; proposal != nil {
+			n.send(p, func(ctx context.Context, p *peer) error {
+				_, err := p.client.HandleProposal(ctx, proposal)
+				return err
+			})
+		}
+		for _, vote := range rs.ownVotes {
+			n.send(p, func(ctx context.Context, p *peer) error {
+				_, err := p.client.HandleVote(ctx, vote)
+				return err
+			})
+		}
+	}
+}
+
+// consensusLoop takes part in the BFT rounds of every height.
+func (n *Node) consensusLoop() {
+	n.logger.Infow("Starting consensus loop...", "publicKey", n.PrivateKey.Public().Address())
+
+	ticker := n.Clock.NewTicker(rebroadcastInterval)
+	defer ticker.Stop()
+
+	rs := n.startHeight(nil)
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C():
+			n.rebroadcast(rs)
+		case msg := <-n.consensusMsgs:
+			rs = n.handleConsensusMsg(rs, msg)
+		case timeout := <-n.timeouts:
+			rs = n.handleConsensusMsg(rs, timeout)
+		}
+
+		// wait a block time after every commit, whether we committed the
+		// block ourselves or received it from a peer
+		if int32(n.chain.Height()) >= rs.height {
+			rs.step = stepCommit
+			n.scheduleTimeout(rs, stepCommit, blockTime)
+		}
+	}
+}
+
+func (n *Node) handleConsensusMsg(rs *roundState, msg any) *roundState {
+	switch msg := msg.(type) {
+	case proposalEvent:
+		if msg.block.Header.Height != rs.height {
+			rs.addPending(msg, msg.block.Header.Height)
+			return rs
+		}
+		n.addProposal(rs, msg.round, msg.block)
+	case *proto.Vote:
+		if msg.Height != rs.height {
+			rs.addPending(msg, msg.Height)
+			return rs
+		}
+		n.addVote(rs, msg)
+	case timeoutEvent:
+		if msg.height != rs.height {
+			return rs
+		}
+		if msg.step == stepCommit {
+			return n.startHeight(rs)
+		}
+		n.handleTimeout(rs, msg)
+	case heightEvent:
+		return rs
+	}
+
+	n.advance(rs)
+
+	return rs
+}
+
+// addPending keeps messages for the next height until we get there.
+func (rs *roundState) addPending(msg any, height int32) {
+	if height != rs.height+1 {
+		return
+	}
+
+	var size int
+	switch msg := msg.(type) {
+	case proposalEvent:
+		size = pb.Size(msg.block)
+	case *proto.Vote:
+		size = pb.Size(msg)
+	}
+	if rs.pendingBytes+size > maxPendingBytes {
+		return
+	}
+	rs.pending = append(rs.pending, msg)
+	rs.pendingBytes += size
+}
+
+// startHeight begins voting on the block after the chain tip, replaying the
+// messages for it that arrived early.
+func (n *Node) startHeight(prev *roundState) *roundState {
+	rs := newRoundState(int32(n.chain.Height()) + 1)
+	n.enterRound(rs, 0)
+
+	if prev != nil {
+		for _, msg := range prev.pending {
+			n.handleConsensusMsg(rs, msg)
+		}
+	}
+	n.advance(rs)
+
+	return rs
+}
+
+func (n *Node) enterRound(rs *roundState, round int32) {
+	rs.round = round
+	rs.step = stepPropose
+	rs.ownProposal = nil
+	rs.ownVotes = nil
+	n.scheduleTimeout(rs, stepPropose, proposeTimeout)
+
+	if !bytes.Equal(n.bft.Proposer(rs.height, round), n.PrivateKey.Public().Bytes()) {
+		return
+	}
+
+	// a block a quorum prevoted for is proposed again, so that validators
+	// locked on it can vote for it; its hash only covers the header, so
+	// signing it again does not change it
+	var (
+		block *proto.Block
+		err   error
+	)
+	if rs.validBlock != nil {
+		block = pb.Clone(rs.validBlock).(*proto.Block)
+		err = n.Consensus.Propose(n.ctx, n.chain, block, n.PrivateKey)
+	} else {
+		block, err = n.createBlock(n.ctx, n.Clock.Now())
+	}
+	if err != nil {
+		n.logger.Errorw("Proposing block failed", "error", err)
+		return
+	}
+	n.logger.Debugw("Proposing block", "height", rs.height, "round", round, "lenTx", len(block.Transactions))
+
+	proposal := &proto.Proposal{Round: round, Block: block}
+	rs.ownProposal = proposal
+	key := fmt.Sprintf("proposal/%x/%d", types.HashBlock(block), round)
+	n.seen.Add(key)
+	n.broadcastProposal(key, proposal)
+	n.addProposal(rs, round, block)
+}
+
+func (n *Node) addProposal(rs *roundState, round int32, block *proto.Block) {
+	if _, ok := rs.proposals[round]; ok {
+		return
+	}
+	if err := n.validateProposal(round, block); err != nil {
+		n.logger.Debugw("Rejected proposal", "height", rs.height, "round", round, "error", err)
+		return
+	}
+
+	rs.proposals[round] = block
+}
+
+func (n *Node) addVote(rs *roundState, vote *proto.Vote) {
+	if vote.Round < 0 {
+		return
+	}
+	rs.votes(vote.Type, vote.Round).Add(vote)
+}
+
+// vote signs a vote of our own, counts it and sends it to our peers.
+func (n *Node) vote(rs *roundState, voteType proto.VoteType, block *proto.Block) {
+	vote := &proto.Vote{
+		Type:   voteType,
+		Height: rs.height,
+		Round:  rs.round,
+	}
+	if block != nil {
+		vote.BlockHash = types.HashBlock(block)
+	}
+	types.SignVote(n.PrivateKey, vote)
+
+	key := "vote/" + hex.EncodeToString(types.HashVote(vote))
+	n.seen.Add(key)
+	n.broadcastVote(key, vote)
+	n.addVote(rs, vote)
+	rs.ownVotes = append(rs.ownVotes, vote)
+}
+
+func (n *Node) handleTimeout(rs *roundState, timeout timeoutEvent) {
+	if timeout.round != rs.round {
+		return
+	}
+
+	switch {
+	case timeout.step == stepPropose && rs.step == stepPropose:
+		rs.step = stepPrevote
+		n.vote(rs, proto.VoteType_VOTE_PREVOTE, nil)
+	case timeout.step == stepPrevote && rs.step == stepPrevote:
+		rs.step = stepPrecommit
+		n.vote(rs, proto.VoteType_VOTE_PRECOMMIT, nil)
+	case timeout.step == stepPrecommit && rs.step < stepCommit:
+		n.enterRound(rs, rs.round+1)
+	}
+}
+
+// advance applies every rule of the round whose condition now holds.
+func (n *Node) advance(rs *roundState) {
+	quorum := n.bft.Quorum()
+
+	// a quorum precommitting a block in any round commits it
+	for round, precommits := range rs.precommits {
+		hash, ok := precommits.Majority(quorum)
+		if !ok || hash == nil {
+			continue
+		}
+		if block := rs.proposal(hash); block != nil {
+			n.commit(rs, round, block, precommits.Votes(hash))
+			return
+		}
+	}
+	if rs.step == stepCommit {
+		return
+	}
+
+	// skip ahead to a later round more than a third of validators are in
+	skipTo := rs.round
+	for round := range rs.prevotes {
+		if round > skipTo && n.votersIn(rs, round) > len(n.bft.Validators())-quorum {
+			skipTo = round
+		}
+	}
+	for round := range rs.precommits {
+		if round > skipTo && n.votersIn(rs, round) > len(n.bft.Validators())-quorum {
+			skipTo = round
+		}
+	}
+	if skipTo > rs.round {
+		n.enterRound(rs, skipTo)
+	}
+
+	prevotes := rs.votes(proto.VoteType_VOTE_PREVOTE, rs.round)
+	precommits := rs.votes(proto.VoteType_VOTE_PRECOMMIT, rs.round)
+
+	if rs.step == stepPropose {
+		if block, ok := rs.proposals[rs.round]; ok {
+			rs.step = stepPrevote
+			if n.canPrevote(rs, block) {
+				n.vote(rs, proto.VoteType_VOTE_PREVOTE, block)
+			} else {
+				n.vote(rs, proto.VoteType_VOTE_PREVOTE, nil)
+			}
+		}
+	}
+
+	if rs.step >= stepPrevote && prevotes.Len() >= quorum {
+		n.scheduleTimeout(rs, stepPrevote, prevoteTimeout)
+	}
+
+	if hash, ok := prevotes.Majority(quorum); ok && rs.step >= stepPrevote {
+		block := rs.proposal(hash)
+		if hash != nil && block != nil {
+			rs.validBlock, rs.validRound = block, rs.round
+		}
+		if rs.step == stepPrevote && (hash == nil || block != nil) {
+			if block != nil {
+				rs.lockedBlock, rs.lockedRound = block, rs.round
+			}
+			rs.step = stepPrecommit
+			n.vote(rs, proto.VoteType_VOTE_PRECOMMIT, block)
+		}
+	}
+
+	if precommits.Len() >= quorum {
+		n.scheduleTimeout(rs, stepPrecommit, precommitTimeout)
+	}
+}
+
+// canPrevote reports whether we may prevote for the proposed block: we are
+// not locked on another block, or a quorum prevoted for this one in a round
+// after we locked.
+func (n *Node) canPrevote(rs *roundState, block *proto.Block) bool {
+	hash := types.HashBlock(block)
+	if rs.lockedBlock == nil || bytes.Equal(types.HashBlock(rs.lockedBlock), hash) {
+		return true
+	}
+
+	for round, prevotes := range rs.prevotes {
+		if round <= rs.lockedRound || round >= rs.round {
+			continue
+		}
+		if majority, ok := prevotes.Majority(n.bft.Quorum()); ok && bytes.Equal(majority, hash) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// votersIn counts the validators that cast any vote in round.
+func (n *Node) votersIn(rs *roundState, round int32) int {
+	voters := make(map[string]bool)
+	for _, sets := range []map[int32]*consensus.VoteSet{rs.prevotes, rs.precommits} {
+		if set, ok := sets[round]; ok {
+			for _, vote := range set.List() {
+				voters[string(vote.PublicKey)] = true
+			}
+		}
+	}
+
+	return len(voters)
+}
+
+// commit adds the block with its commit certificate to the chain and waits
+// a block time before voting on the next height.
+func (n *Node) commit(rs *roundState, round int32, block *proto.Block, precommits []*proto.Vote) {
+	rs.step = stepCommit
+
+	// the proposal may still be sent to peers, so the commit goes on a copy
+	committed := pb.Clone(block).(*proto.Block)
+	committed.Commit = &proto.Commit{Round: round, Precommits: precommits}
+
+	if !n.chain.HasBlock(types.HashBlock(committed)) {
+		if err := n.addBlock(committed); err != nil {
+			n.logger.Errorw("Adding committed block failed", "height", rs.height, "error", err)
+			return
+		}
+		n.logger.Debugw("Committed block", "height", rs.height, "round", round, "we", n.ListenAddr)
+		n.relayBlock(committed, nil)
+	}
+}
+
+// scheduleTimeout delivers a timeout for the current step of the round once
+// it expires, at most once per step and round. Timeouts have a channel of
+// their own and wait for room in it: a dropped timeout would leave the
+// validator in its round for good.
+func (n *Node) scheduleTimeout(rs *roundState, step roundStep, base time.Duration) {
+	timeout := timeoutEvent{height: rs.height, round: rs.round, step: step}
+	if rs.timeouts[timeout] {
+		return
+	}
+	rs.timeouts[timeout] = true
+
+	after := n.Clock.After(base + time.Duration(rs.round)*roundTimeoutDelta)
+	n.spawn(func() {
+		select {
+		case <-after:
+		case <-n.ctx.Done():
+			return
+		}
+
+		select {
+		case n.timeouts <- timeout:
+		case <-n.ctx.Done():
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/util"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestHandleProposalRejectsOtherProposer(t *testing.T) {
+	var (
+		a, b = encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey()
+		n    = NewNode(ServerConfig{
+			ListenAddr: "127.0.0.1:0",
+			PrivateKey: a,
+			Genesis: Genesis{
+				Validators: []*encrypted.PublicKey{a.Public(), b.Public()},
+				Engine:     EngineBFT,
+			},
+		})
+	)
+	genesis, err := n.chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	proposal := func(key *encrypted.PrivateKey) *proto.Proposal {
+		block := &proto.Block{
+			Header: &proto.Header{
+				Version:   1,
+				Height:    1,
+				PrevHash:  types.HashBlock(genesis),
+				Timestamp: genesis.Header.Timestamp + int64(time.Second),
+			},
+		}
+		types.SignBlock(key, block)
+
+		return &proto.Proposal{Block: block}
+	}
+
+	// b proposes the first round of height 1
+	_, err = n.HandleProposal(context.Background(), proposal(a))
+	assert.True(t, errors.IsOf(err, errors.ErrUnauthorized))
+	assert.Empty(t, n.consensusMsgs)
+
+	_, err = n.HandleProposal(context.Background(), proposal(b))
+	require.Nil(t, err)
+	assert.Len(t, n.consensusMsgs, 1)
+
+	// a full queue drops messages instead of blocking the handler
+	for i := 0; i < 2*cap(n.consensusMsgs); i++ {
+		n.deliver(heightEvent{})
+	}
+	assert.Len(t, n.consensusMsgs, cap(n.consensusMsgs))
+}
+
+func TestHandleProposalChecksFutureProposals(t *testing.T) {
+	var (
+		a, b = encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey()
+		n    = NewNode(ServerConfig{
+			ListenAddr: "127.0.0.1:0",
+			PrivateKey: a,
+			Genesis: Genesis{
+				Validators: []*encrypted.PublicKey{a.Public(), b.Public()},
+				Engine:     EngineBFT,
+			},
+		})
+	)
+
+	proposal := func(key *encrypted.PrivateKey, height int32) *proto.Proposal {
+		block := &proto.Block{Header: &proto.Header{Version: 1, Height: height, PrevHash: util.RandomHash()}}
+		types.SignBlock(key, block)
+
+		return &proto.Proposal{Block: block}
+	}
+
+	// a proposes the first round of height 2, which cannot be checked
+	// against the chain yet
+	_, err := n.HandleProposal(context.Background(), proposal(b, 2))
+	assert.True(t, errors.IsOf(err, errors.ErrUnauthorized))
+	assert.Empty(t, n.consensusMsgs)
+
+	forged := proposal(a, 2)
+	forged.Block.Signature = util.RandomHash()
+	_, err = n.HandleProposal(context.Background(), forged)
+	assert.NotNil(t, err)
+	assert.Empty(t, n.consensusMsgs)
+
+	_, err = n.HandleProposal(context.Background(), proposal(a, 3))
+	require.Nil(t, err)
+	assert.Empty(t, n.consensusMsgs)
+
+	_, err = n.HandleProposal(context.Background(), proposal(a, 2))
+	require.Nil(t, err)
+	assert.Len(t, n.consensusMsgs, 1)
+}
+
+func TestPendingMessagesAreBoundedBySize(t *testing.T) {
+	var (
+		rs    = newRoundState(1)
+		block = &proto.Block{
+			Header:       &proto.Header{Height: 2},
+			Transactions: []*proto.Transaction{{Outputs: []*proto.TxOutput{{Address: make([]byte, 1<<20)}}}},
+		}
+	)
+
+	for i := 0; i < 2*maxPendingBytes/pb.Size(block); i++ {
+		rs.addPending(proposalEvent{block: block}, 2)
+	}
+	assert.Len(t, rs.pending, maxPendingBytes/pb.Size(block))
+	assert.LessOrEqual(t, rs.pendingBytes, maxPendingBytes)
+
+	// messages for other heights are not kept at all
+	rs = newRoundState(1)
+	rs.addPending(&proto.Vote{Height: 3}, 3)
+	assert.Empty(t, rs.pending)
+}
@@ -0,0 +1,127 @@
+package nodes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BreakerConfig configures the circuit breaker guarding calls to each peer.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed calls that opens
+	// the circuit.
+	FailureThreshold int
+	// Cooldown is how long an open circuit rejects calls before a single
+	// trial call is let through.
+	Cooldown time.Duration
+}
+
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 5,
+	Cooldown:         30 * time.Second,
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker stops calling a peer that keeps failing until Cooldown has
+// passed.
+type CircuitBreaker struct {
+	lock     sync.Mutex
+	cfg      BreakerConfig
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{cfg: cfg}
+}
+
+// Allow reports whether a call may be made. Once the cooldown of an open
+// circuit has passed exactly one trial call is allowed.
+func (b *CircuitBreaker) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cfg.Cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		return false
+	}
+
+	return true
+}
+
+func (b *CircuitBreaker) Success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *CircuitBreaker) Open() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.state != breakerClosed
+}
+
+func (b *CircuitBreaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !b.Allow() {
+			return status.Errorf(codes.Unavailable, "circuit breaker open for %s", cc.Target())
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if isPeerFailure(err) {
+			b.Failure()
+		} else {
+			b.Success()
+		}
+
+		return err
+	}
+}
+
+// isPeerFailure reports whether err means the peer is unhealthy, as opposed
+// to it rejecting our request. ResourceExhausted is a rejection: the peer
+// rate limits us, and backing off is up to the caller.
+func isPeerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,83 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreakerOpensAfterFailures(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerConfig{FailureThreshold: 3, Cooldown: 50 * time.Millisecond})
+
+	for i := 0; i < 3; i++ {
+		require.True(t, breaker.Allow())
+		breaker.Failure()
+	}
+
+	assert.True(t, breaker.Open())
+	assert.False(t, breaker.Allow())
+
+	time.Sleep(60 * time.Millisecond)
+
+	// a single trial call is let through after the cooldown
+	assert.True(t, breaker.Allow())
+	assert.False(t, breaker.Allow())
+
+	breaker.Success()
+	assert.False(t, breaker.Open())
+	assert.True(t, breaker.Allow())
+}
+
+func TestCircuitBreakerReopensOnFailedTrial(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerConfig{FailureThreshold: 1, Cooldown: 50 * time.Millisecond})
+
+	breaker.Failure()
+	time.Sleep(60 * time.Millisecond)
+
+	require.True(t, breaker.Allow())
+	breaker.Failure()
+
+	assert.False(t, breaker.Allow())
+}
+
+func TestCircuitBreakerClientInterceptor(t *testing.T) {
+	var (
+		calls       int
+		breaker     = NewCircuitBreaker(BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute})
+		interceptor = breaker.UnaryClientInterceptor()
+		cc          = &grpc.ClientConn{}
+	)
+	unavailable := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		return status.Error(codes.Unavailable, "connection refused")
+	}
+	rejected := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		return status.Error(codes.InvalidArgument, "invalid transaction")
+	}
+	limited := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+
+	// rejected and rate limited requests do not count against the peer
+	for i := 0; i < 3; i++ {
+		interceptor(context.Background(), "/Node/Test", nil, nil, cc, rejected)
+		interceptor(context.Background(), "/Node/Test", nil, nil, cc, limited)
+	}
+	assert.False(t, breaker.Open())
+
+	interceptor(context.Background(), "/Node/Test", nil, nil, cc, unavailable)
+	interceptor(context.Background(), "/Node/Test", nil, nil, cc, unavailable)
+	require.Equal(t, 8, calls)
+
+	err := interceptor(context.Background(), "/Node/Test", nil, nil, cc, unavailable)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 8, calls)
+}
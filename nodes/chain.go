@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"math/big"
+	"sync"
 
 	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/consensus"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/script"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
 )
 
-const godSeed = "d12cda4733e2e24377cc161b55bf447a13a615d48838b33ab7634b77531734dc"
-
 type HeaderList struct {
 	headers []*proto.Header
 }
@@ -24,6 +28,11 @@ func (h *HeaderList) Add(header *proto.Header) {
 	h.headers = append(h.headers, header)
 }
 
+// RemoveLast removes the header at the top of the list.
+func (h *HeaderList) RemoveLast() {
+	h.headers = h.headers[:len(h.headers)-1]
+}
+
 func (h *HeaderList) Get(index int) *proto.Header {
 	if index > h.Height() {
 		panic("index out of range")
@@ -45,24 +54,86 @@ type UTXO struct {
 	OutIndex int
 	Amount   int64
 	Spent    bool
+	Type     proto.OutputType
+	// Address is the owner of the output, for multisig outputs the hash of
+	// the keys that can spend it.
+	Address []byte
+	// Validator is the public key stake is bonded to.
+	Validator []byte
+	// UnlockHeight is the first height unbonding funds can be spent at.
+	UnlockHeight int32
+	// Height is the height of the block that created the output.
+	Height int32
+	// HashLock and RefundAddress are the terms of an HTLC output, which
+	// times out at UnlockHeight.
+	HashLock      []byte
+	RefundAddress []byte
+	// LockingScript locks a script output.
+	LockingScript []byte
+}
+
+// blockNode is a block in the index of every valid block we know, on the
+// best branch or not.
+type blockNode struct {
+	hash   []byte
+	height int32
+	parent *blockNode
+	// work is the cumulative work of the branch ending in this block.
+	work *big.Int
 }
 
 type Chain struct {
+	lock       sync.RWMutex
+	chainID    string
 	txStore    TXStorer
 	blockStore BlockStorer
 	utxoStore  UTXOStorer
-	headers    *HeaderList
+	// headers and utxoStore follow the best branch, which ends in tip.
+	headers *HeaderList
+	engine  consensus.Engine
+	// forks is set when the engine lets competing branches exist.
+	forks consensus.ForkChooser
+	index map[string]*blockNode
+	tip   *blockNode
+	// staking is set when the validators are taken from bonded stake;
+	// epochs holds the validator set of every epoch of the best branch.
+	staking consensus.Staking
+	epochs  map[int32]*consensus.ValidatorSet
+	// slashed holds the validators jailed for equivocating, by public key.
+	slashed map[string]bool
+	// upgrades decides the rules blocks and transactions are validated by.
+	upgrades UpgradeSchedule
+	// sigCache holds the input signatures verified for the mempool, so
+	// blocks including those transactions skip verifying them again.
+	sigCache *types.SigCache
+	// clock bounds how far ahead of local time headers may be dated.
+	clock Clock
+	// onReorganize is called with the blocks a reorganisation took off the
+	// best branch and those it put on it, with the chain locked.
+	onReorganize func(disconnected, connected []*proto.Block)
 }
 
-func NewChain(blockStore BlockStorer, txStore TXStorer) *Chain {
+// NewChain creates a chain starting at genesis, see Genesis.Block, that
+// follows the rules of upgrades.
+func NewChain(blockStore BlockStorer, txStore TXStorer, engine consensus.Engine, genesis *proto.Block, upgrades UpgradeSchedule) *Chain {
 	chain := &Chain{
+		chainID:    genesis.Header.ChainId,
 		blockStore: blockStore,
 		txStore:    txStore,
 		utxoStore:  NewMemoryUTXOStore(),
 		headers:    NewHeaderList(),
+		engine:     engine,
+		index:      make(map[string]*blockNode),
+		epochs:     make(map[int32]*consensus.ValidatorSet),
+		slashed:    make(map[string]bool),
+		upgrades:   upgrades,
+		sigCache:   types.NewSigCache(types.DefaultSigCacheSize),
+		clock:      SystemClock{},
 	}
+	chain.forks, _ = engine.(consensus.ForkChooser)
+	chain.staking, _ = engine.(consensus.Staking)
 
-	err := chain.addBlock(createGenesisBlock())
+	err := chain.addBlock(genesis)
 	if err != nil {
 		panic(err)
 	}
@@ -70,19 +141,234 @@ func NewChain(blockStore BlockStorer, txStore TXStorer) *Chain {
 	return chain
 }
 
+// Close flushes and closes every store that holds resources.
+func (c *Chain) Close() error {
+	for _, store := range []any{c.blockStore, c.txStore, c.utxoStore} {
+		if closer, ok := store.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ChainID returns the chain ID of the genesis block, which every block and
+// transaction has to carry.
+func (c *Chain) ChainID() string {
+	return c.chainID
+}
+
+// NextRules returns the rules the block extending the tip has to follow.
+// It fails with ErrNotSupported once that block needs an upgrade this node
+// does not implement.
+func (c *Chain) NextRules() (Rules, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.upgrades.Rules(int32(c.headers.Height()) + 1)
+}
+
 func (c *Chain) Height() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
 	return c.headers.Height()
 }
 
+// Tip returns the header of the highest block.
+func (c *Chain) Tip() *proto.Header {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.headers.Get(c.headers.Height())
+}
+
+func (c *Chain) HasBlock(hash []byte) bool {
+	_, err := c.GetBlockByHash(hash)
+
+	return err == nil
+}
+
+// AddBlock adds a block extending the tip. If the engine allows forks, a
+// block extending another known block is kept on a side branch, and the
+// chain reorganises onto that branch once it has more cumulative work.
 func (c *Chain) AddBlock(block *proto.Block) error {
-	if err := c.ValidateBlock(block); err != nil {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	hash := types.HashBlock(block)
+	if _, ok := c.index[hex.EncodeToString(hash)]; ok {
+		return fmt.Errorf("block %x already known", hash)
+	}
+
+	parent, ok := c.index[hex.EncodeToString(block.Header.PrevHash)]
+	if ok && parent != c.tip && c.forks != nil {
+		return c.addSideBlock(block, parent)
+	}
+
+	if err := c.validateBlock(block); err != nil {
+		return err
+	}
+
+	if err := c.addBlock(block); err != nil {
 		return err
 	}
 
-	return c.addBlock(block)
+	return c.engine.Finalize(chainView{c}, block)
 }
 
+// addBlock adds a valid block extending the tip.
 func (c *Chain) addBlock(block *proto.Block) error {
+	if err := c.connectBlock(block); err != nil {
+		return err
+	}
+	if err := c.blockStore.Put(block); err != nil {
+		return err
+	}
+
+	c.tip = c.indexBlock(block, c.tip)
+
+	return nil
+}
+
+// addSideBlock adds a block that does not extend the tip. Its transactions
+// are only validated once its branch becomes the best one.
+func (c *Chain) addSideBlock(block *proto.Block, parent *blockNode) error {
+	if err := c.checkChainID(block.Header.ChainId); err != nil {
+		return err
+	}
+	if err := c.checkRules(block.Header); err != nil {
+		return err
+	}
+	if err := consensus.CheckTimestamp(block.Header, c.clock.Now()); err != nil {
+		return err
+	}
+	if block.Header.Height != parent.height+1 {
+		return fmt.Errorf("block height (%d) does not extend parent height (%d)", block.Header.Height, parent.height)
+	}
+	if !types.VerifyRootHash(block) {
+		return fmt.Errorf("invalid merkle root")
+	}
+	if err := c.engine.ValidateHeader(chainView{c}, block); err != nil {
+		return err
+	}
+
+	if err := c.blockStore.Put(block); err != nil {
+		return err
+	}
+	node := c.indexBlock(block, parent)
+
+	if node.work.Cmp(c.tip.work) <= 0 {
+		return nil
+	}
+
+	if err := c.reorganize(node); err != nil {
+		delete(c.index, hex.EncodeToString(node.hash))
+		return err
+	}
+
+	return nil
+}
+
+// reorganize makes the branch ending in tip the best branch. The blocks of
+// the current branch are disconnected down to the fork point and those of
+// the new branch connected, validating their transactions; if one is
+// invalid the chain goes back to its current branch.
+func (c *Chain) reorganize(tip *blockNode) error {
+	var (
+		oldNode, newNode = c.tip, tip
+		// disconnected runs from the current tip down, connected from the
+		// fork point up
+		disconnected, connected []*proto.Block
+	)
+	for oldNode != newNode {
+		if oldNode.height >= newNode.height {
+			block, err := c.blockStore.Get(hex.EncodeToString(oldNode.hash))
+			if err != nil {
+				return err
+			}
+			disconnected = append(disconnected, block)
+			oldNode = oldNode.parent
+			continue
+		}
+
+		block, err := c.blockStore.Get(hex.EncodeToString(newNode.hash))
+		if err != nil {
+			return err
+		}
+		connected = append([]*proto.Block{block}, connected...)
+		newNode = newNode.parent
+	}
+
+	for _, block := range disconnected {
+		if err := c.disconnectBlock(block); err != nil {
+			return err
+		}
+	}
+	for i, block := range connected {
+		err := c.validateBody(block)
+		if err == nil {
+			err = c.connectBlock(block)
+		}
+		if err != nil {
+			err = fmt.Errorf("reorganizing to block %x at height %d: %w", tip.hash, tip.height, err)
+			if restoreErr := c.restoreBranch(connected[:i], disconnected); restoreErr != nil {
+				return fmt.Errorf("%w; restoring the previous branch: %v", err, restoreErr)
+			}
+			return err
+		}
+	}
+
+	c.tip = tip
+	if c.onReorganize != nil {
+		c.onReorganize(disconnected, connected)
+	}
+
+	return c.engine.Finalize(chainView{c}, connected[len(connected)-1])
+}
+
+// restoreBranch undoes a failed reorganisation: it disconnects the blocks
+// of the new branch connected so far, then connects the disconnected ones
+// again.
+func (c *Chain) restoreBranch(connected, disconnected []*proto.Block) error {
+	for i := len(connected) - 1; i >= 0; i-- {
+		if err := c.disconnectBlock(connected[i]); err != nil {
+			return err
+		}
+	}
+	for i := len(disconnected) - 1; i >= 0; i-- {
+		if err := c.connectBlock(disconnected[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Chain) indexBlock(block *proto.Block, parent *blockNode) *blockNode {
+	node := &blockNode{
+		hash:   types.HashBlock(block),
+		height: block.Header.Height,
+		parent: parent,
+		work:   new(big.Int),
+	}
+	if parent != nil {
+		node.work.Set(parent.work)
+	}
+	if c.forks != nil {
+		node.work.Add(node.work, c.forks.Work(block.Header))
+	}
+	c.index[hex.EncodeToString(node.hash)] = node
+
+	return node
+}
+
+// connectBlock applies a block to the headers and UTXO set of the best
+// branch, slashes the validators its evidence convicts and snapshots the
+// validator set at the end of an epoch.
+func (c *Chain) connectBlock(block *proto.Block) error {
 	c.headers.Add(block.Header)
 
 	for _, tx := range block.Transactions {
@@ -93,10 +379,18 @@ func (c *Chain) addBlock(block *proto.Block) error {
 
 		for it, output := range tx.Outputs {
 			utxo := &UTXO{
-				Hash:     hash,
-				Amount:   output.Amount,
-				OutIndex: it,
-				Spent:    false,
+				Hash:          hash,
+				Amount:        output.Amount,
+				OutIndex:      it,
+				Spent:         false,
+				Type:          output.Type,
+				Address:       output.Address,
+				Validator:     output.Validator,
+				UnlockHeight:  output.UnlockHeight,
+				Height:        block.Header.Height,
+				HashLock:      output.HashLock,
+				RefundAddress: output.RefundAddress,
+				LockingScript: output.LockingScript,
 			}
 
 			if err := c.utxoStore.Put(utxo); err != nil {
@@ -105,8 +399,7 @@ func (c *Chain) addBlock(block *proto.Block) error {
 		}
 
 		for _, input := range tx.Inputs {
-			key := fmt.Sprintf("%s_%d", hex.EncodeToString(input.PrevTxHash), input.PrevOutIndex)
-			utxo, err := c.utxoStore.Get(key)
+			utxo, err := c.utxoStore.Get(utxoKey(input.PrevTxHash, input.PrevOutIndex))
 			if err != nil {
 				return err
 			}
@@ -118,7 +411,203 @@ func (c *Chain) addBlock(block *proto.Block) error {
 		}
 	}
 
-	return c.blockStore.Put(block)
+	for _, evidence := range block.Evidence {
+		if err := c.slash(evidence.PublicKey, block.Header.Height); err != nil {
+			return err
+		}
+	}
+
+	if c.staking != nil && block.Header.Height%c.staking.Params().EpochLength == 0 {
+		set, err := c.bondedStake()
+		if err != nil {
+			return err
+		}
+		c.epochs[block.Header.Height/c.staking.Params().EpochLength] = set
+	}
+
+	return nil
+}
+
+// disconnectBlock takes the block at the top of the best branch off its
+// headers and UTXO set, undoing connectBlock. Only engines without stake
+// let branches compete, so the block carries no evidence whose slashing
+// would have to be undone.
+func (c *Chain) disconnectBlock(block *proto.Block) error {
+	if len(block.Evidence) > 0 {
+		return fmt.Errorf("cannot disconnect block %x with evidence", types.HashBlock(block))
+	}
+
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		for _, input := range tx.Inputs {
+			if err := c.unspend(utxoKey(input.PrevTxHash, input.PrevOutIndex)); err != nil {
+				return err
+			}
+		}
+
+		txHash := types.HashTransaction(tx)
+		for it := range tx.Outputs {
+			if err := c.utxoStore.Delete(utxoKey(txHash, uint32(it))); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.headers.RemoveLast()
+
+	return nil
+}
+
+func (c *Chain) unspend(key string) error {
+	utxo, err := c.utxoStore.Get(key)
+	if err != nil {
+		return err
+	}
+	utxo.Spent = false
+
+	return c.utxoStore.Put(utxo)
+}
+
+// slash jails a validator for good and burns the stake bonded to it,
+// including the stake still unbonding at height.
+func (c *Chain) slash(validator []byte, height int32) error {
+	c.slashed[hex.EncodeToString(validator)] = true
+
+	utxos, err := c.utxoStore.List()
+	if err != nil {
+		return err
+	}
+	for _, utxo := range utxos {
+		if utxo.Spent || !bytes.Equal(utxo.Validator, validator) {
+			continue
+		}
+		switch {
+		case utxo.Type == proto.OutputType_OUTPUT_STAKE:
+		case utxo.Type == proto.OutputType_OUTPUT_UNBONDING && height < utxo.UnlockHeight:
+		default:
+			continue
+		}
+
+		utxo.Spent = true
+		if err := c.utxoStore.Put(utxo); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bondedStake sums the unspent stake outputs by the validator they are
+// bonded to.
+func (c *Chain) bondedStake() (*consensus.ValidatorSet, error) {
+	utxos, err := c.utxoStore.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		power = make(map[string]int64)
+		keys  = make(map[string][]byte)
+	)
+	for _, utxo := range utxos {
+		if utxo.Spent || utxo.Type != proto.OutputType_OUTPUT_STAKE {
+			continue
+		}
+		key := hex.EncodeToString(utxo.Validator)
+		power[key] += utxo.Amount
+		keys[key] = utxo.Validator
+	}
+
+	var validators []consensus.Validator
+	for key, publicKey := range keys {
+		validators = append(validators, consensus.Validator{PublicKey: publicKey, Power: power[key]})
+	}
+
+	return consensus.NewValidatorSet(validators), nil
+}
+
+// ValidatorSet returns the validator set of the epoch of height: the stake
+// bonded at the end of the previous epoch.
+func (c *Chain) ValidatorSet(height int32) (*consensus.ValidatorSet, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.validatorSet(height)
+}
+
+func (c *Chain) validatorSet(height int32) (*consensus.ValidatorSet, error) {
+	if c.staking == nil {
+		return nil, fmt.Errorf("chain does not track stake")
+	}
+
+	set, err := c.epochSet(height)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.slashed) == 0 {
+		return set, nil
+	}
+
+	// jailed validators lose their turns right away, not only once their
+	// burnt stake drops out of the next epoch
+	var validators []consensus.Validator
+	for _, validator := range set.Validators() {
+		if !c.slashed[hex.EncodeToString(validator.PublicKey)] {
+			validators = append(validators, validator)
+		}
+	}
+
+	return consensus.NewValidatorSet(validators), nil
+}
+
+// epochSet returns the validator set snapshotted for the epoch of height.
+func (c *Chain) epochSet(height int32) (*consensus.ValidatorSet, error) {
+	epoch := (height - 1) / c.staking.Params().EpochLength
+	set, ok := c.epochs[epoch]
+	if !ok {
+		return nil, fmt.Errorf("no validator set for height %d", height)
+	}
+
+	return set, nil
+}
+
+// ValidateEvidence checks that evidence convicts a validator that was in
+// charge at the height of its headers and has not been slashed yet.
+func (c *Chain) ValidateEvidence(evidence *proto.Evidence) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.validateEvidence(evidence)
+}
+
+func (c *Chain) validateEvidence(evidence *proto.Evidence) error {
+	if c.staking == nil {
+		return fmt.Errorf("evidence without a proof of stake engine")
+	}
+	if err := types.CheckEvidence(evidence); err != nil {
+		return err
+	}
+	// both headers share a chain ID once CheckEvidence passes
+	if err := c.checkChainID(evidence.HeaderA.ChainId); err != nil {
+		return err
+	}
+
+	height := evidence.HeaderA.Height
+	if height < 1 || int(height) > c.headers.Height() {
+		return fmt.Errorf("evidence at height %d beyond the chain", height)
+	}
+	set, err := c.epochSet(height)
+	if err != nil {
+		return err
+	}
+	if set.Power(evidence.PublicKey) == 0 {
+		return fmt.Errorf("evidence against %x who was no validator at height %d", evidence.PublicKey, height)
+	}
+	if c.slashed[hex.EncodeToString(evidence.PublicKey)] {
+		return fmt.Errorf("validator %x already slashed", evidence.PublicKey)
+	}
+
+	return nil
 }
 
 func (c *Chain) GetBlockByHash(hash []byte) (*proto.Block, error) {
@@ -128,8 +617,15 @@ func (c *Chain) GetBlockByHash(hash []byte) (*proto.Block, error) {
 }
 
 func (c *Chain) GetBlockByHeight(height int) (*proto.Block, error) {
-	if c.Height() < height {
-		return nil, fmt.Errorf("given height (%d) too high - current height (%d)", height, c.Height())
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.getBlockByHeight(height)
+}
+
+func (c *Chain) getBlockByHeight(height int) (*proto.Block, error) {
+	if c.headers.Height() < height {
+		return nil, fmt.Errorf("given height (%d) too high - current height (%d)", height, c.headers.Height())
 	}
 
 	header := c.headers.Get(height)
@@ -139,47 +635,185 @@ func (c *Chain) GetBlockByHeight(height int) (*proto.Block, error) {
 }
 
 func (c *Chain) ValidateBlock(block *proto.Block) error {
-	// validate signature
-	if !types.VerifyBlock(block) {
-		return fmt.Errorf("invalid block signature")
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.validateBlock(block)
+}
+
+// ValidateProposal checks a block that is still being voted on, which does
+// not carry its consensus seal yet.
+func (c *Chain) ValidateProposal(block *proto.Block) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	validate := c.engine.ValidateHeader
+	if validator, ok := c.engine.(consensus.ProposalValidator); ok {
+		validate = validator.ValidateProposal
+	}
+
+	return c.validate(block, validate)
+}
+
+func (c *Chain) validateBlock(block *proto.Block) error {
+	return c.validate(block, c.engine.ValidateHeader)
+}
+
+// validate checks the block against the chain tip, validates its seal with
+// validateSeal and then its transactions.
+func (c *Chain) validate(block *proto.Block, validateSeal func(consensus.ChainReader, *proto.Block) error) error {
+	if err := c.checkChainID(block.Header.ChainId); err != nil {
+		return err
+	}
+	if err := c.checkRules(block.Header); err != nil {
+		return err
+	}
+	if err := consensus.CheckTimestamp(block.Header, c.clock.Now()); err != nil {
+		return err
 	}
 
-	// validate prev block hash
-	currentBlock, err := c.GetBlockByHeight(c.Height())
+	// validate height and prev block hash
+	currentBlock, err := c.getBlockByHeight(c.headers.Height())
 	if err != nil {
 		return err
 	}
 
+	if block.Header.Height != currentBlock.Header.Height+1 {
+		return fmt.Errorf("block height (%d) does not extend current height (%d)", block.Header.Height, currentBlock.Header.Height)
+	}
+
 	hash := types.HashBlock(currentBlock)
 	if !bytes.Equal(hash, block.Header.PrevHash) {
 		return fmt.Errorf("prev block hash mismatch")
 	}
 
+	// validate merkle root
+	if !types.VerifyRootHash(block) {
+		return fmt.Errorf("invalid merkle root")
+	}
+
+	// validate seal
+	if err := validateSeal(chainView{c}, block); err != nil {
+		return err
+	}
+
+	return c.validateBody(block)
+}
+
+// validateBody validates the evidence and transactions of a block
+// extending the tip.
+func (c *Chain) validateBody(block *proto.Block) error {
+	convicted := make(map[string]bool)
+	for _, evidence := range block.Evidence {
+		if err := c.validateEvidence(evidence); err != nil {
+			return err
+		}
+
+		key := hex.EncodeToString(evidence.PublicKey)
+		if convicted[key] {
+			return fmt.Errorf("validator %x convicted twice", evidence.PublicKey)
+		}
+		convicted[key] = true
+	}
+
+	// transactions are validated against the UTXO set before the block, so
+	// the block must not include one twice or spend an output twice
+	var (
+		txids = make(map[string]bool, len(block.Transactions))
+		spent = make(map[string]bool)
+	)
 	for _, tx := range block.Transactions {
-		if err := c.ValidateTransaction(tx); err != nil {
+		txid := hex.EncodeToString(types.HashTransaction(tx))
+		if txids[txid] {
+			return fmt.Errorf("transaction %s included twice", txid)
+		}
+		txids[txid] = true
+
+		for _, input := range tx.Inputs {
+			key := utxoKey(input.PrevTxHash, input.PrevOutIndex)
+			if spent[key] {
+				return fmt.Errorf("transaction %s spends output %s spent earlier in the block", txid, key)
+			}
+			spent[key] = true
+		}
+
+		if err := c.validateSpend(tx); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	// signatures are checked last and in parallel, as they cost the most
+	return types.CheckTransactions(block.Transactions, 0, c.sigCache)
 }
 
 func (c *Chain) ValidateTransaction(tx *proto.Transaction) error {
-	// verify signature
-	if !types.VerifyTransaction(tx) {
-		return fmt.Errorf("invalid transaction signature")
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.validateTransaction(tx)
+}
+
+func (c *Chain) validateTransaction(tx *proto.Transaction) error {
+	if err := c.validateSpend(tx); err != nil {
+		return err
+	}
+
+	return c.CheckSignatures(tx)
+}
+
+// CheckSignatures checks the input signatures of tx through the signature
+// cache of the chain.
+func (c *Chain) CheckSignatures(tx *proto.Transaction) error {
+	return types.CheckTransactions([]*proto.Transaction{tx}, 1, c.sigCache)
+}
+
+// SigCacheStats returns how often signature checks hit the cache.
+func (c *Chain) SigCacheStats() types.SigCacheStats {
+	return c.sigCache.Stats()
+}
+
+// validateSpend checks a transaction against the rules and the UTXO set,
+// everything but its signatures.
+func (c *Chain) validateSpend(tx *proto.Transaction) error {
+	if err := c.checkChainID(tx.ChainId); err != nil {
+		return err
 	}
 
-	// check if inputs are not spent
 	var (
-		nInputs   = len(tx.Inputs)
+		height    = int32(c.headers.Height()) + 1
 		hash      = hex.EncodeToString(types.HashTransaction(tx))
 		sumInputs = 0
+		// unbonding is the validator of the stake tx spends, if any
+		unbonding []byte
 	)
-	for i := 0; i < nInputs; i++ {
-		prevHash := hex.EncodeToString(tx.Inputs[i].PrevTxHash)
-		key := fmt.Sprintf("%s_%d", prevHash, i)
-		utxo, err := c.utxoStore.Get(key)
+	rules, err := c.upgrades.Rules(height)
+	if err != nil {
+		return err
+	}
+	if tx.Version < RulesGenesis || tx.Version > rules.Version {
+		return errors.Wrapf(errors.ErrInvalidVersion, "transaction %s declares rules %d, rules %d are in force", hash, tx.Version, rules.Version)
+	}
+	if rules.StrictTransactions {
+		if err := checkStrictTransaction(tx, hash); err != nil {
+			return err
+		}
+	}
+	if types.HasTimelocks(tx) && !rules.Timelocks {
+		return errors.Wrapf(errors.ErrNotSupported, "transaction %s is time locked before rules %d", hash, RulesTimelocks)
+	}
+	var medianTime int64
+	if tx.LockTime >= types.LockTimeThreshold {
+		if medianTime, err = consensus.MedianTimePast(chainView{c}, c.headers.Get(c.headers.Height())); err != nil {
+			return err
+		}
+	}
+	if err := types.CheckLockTime(tx, height, medianTime); err != nil {
+		return errors.Wrapf(err, "transaction %s", hash)
+	}
+
+	// check if inputs are not spent
+	for i, input := range tx.Inputs {
+		utxo, err := c.utxoStore.Get(utxoKey(input.PrevTxHash, input.PrevOutIndex))
 		if err != nil {
 			return err
 		}
@@ -189,6 +823,43 @@ func (c *Chain) ValidateTransaction(tx *proto.Transaction) error {
 		if utxo.Spent {
 			return fmt.Errorf("input %d of transaction %s is already spent", i, hash)
 		}
+		if unlock := int64(utxo.Height) + int64(input.RelativeLock); int64(height) < unlock {
+			return errors.Wrapf(errors.ErrTxNotFinal, "input %d of transaction %s is locked until height %d", i, hash, unlock)
+		}
+		if err := checkMultisigSpend(input, utxo); err != nil {
+			return errors.Wrapf(err, "input %d of transaction %s", i, hash)
+		}
+		if err := checkHTLCSpend(input, utxo, height); err != nil {
+			return errors.Wrapf(err, "input %d of transaction %s", i, hash)
+		}
+		if err := c.checkScriptSpend(tx, i, utxo); err != nil {
+			return errors.Wrapf(err, "transaction %s", hash)
+		}
+		if err := checkKeySpend(input, utxo); err != nil {
+			return errors.Wrapf(err, "input %d of transaction %s", i, hash)
+		}
+
+		switch utxo.Type {
+		case proto.OutputType_OUTPUT_STAKE:
+			if unbonding != nil && !bytes.Equal(unbonding, utxo.Validator) {
+				return fmt.Errorf("transaction %s unbonds the stake of several validators", hash)
+			}
+			unbonding = utxo.Validator
+		case proto.OutputType_OUTPUT_UNBONDING:
+			if height < utxo.UnlockHeight {
+				return fmt.Errorf("input %d of transaction %s is locked until height %d", i, hash, utxo.UnlockHeight)
+			}
+		}
+	}
+
+	for i, output := range tx.Outputs {
+		if err := checkOutput(output, rules, height); err != nil {
+			return errors.Wrapf(err, "output %d of transaction %s", i, hash)
+		}
+	}
+
+	if err := c.validateStake(tx, hash, height, unbonding); err != nil {
+		return err
 	}
 
 	sumOutputs := 0
@@ -202,29 +873,206 @@ func (c *Chain) ValidateTransaction(tx *proto.Transaction) error {
 	return nil
 }
 
-func createGenesisBlock() *proto.Block {
-	privateKey := encrypted.NewPrivateKeyFromSeedString(godSeed)
+// checkOutput checks outputs of the types added by upgrades against the rules
+// in force at height.
+func checkOutput(output *proto.TxOutput, rules Rules, height int32) error {
+	switch output.Type {
+	case proto.OutputType_OUTPUT_MULTISIG:
+		if !rules.Multisig {
+			return errors.Wrapf(errors.ErrNotSupported, "multisig before rules %d", RulesMultisig)
+		}
+		if len(output.Address) != encrypted.AddressLen {
+			return errors.Wrap(errors.ErrInvalidAddress, "multisig")
+		}
+	case proto.OutputType_OUTPUT_HTLC:
+		if !rules.HTLC {
+			return errors.Wrapf(errors.ErrNotSupported, "HTLC before rules %d", RulesHTLC)
+		}
+		if err := types.CheckHTLCOutput(output); err != nil {
+			return err
+		}
+		if output.UnlockHeight <= height {
+			return errors.Wrapf(errors.ErrInvalidHeight, "HTLC times out at height %d before it is included", output.UnlockHeight)
+		}
+	case proto.OutputType_OUTPUT_SCRIPT:
+		if !rules.Script {
+			return errors.Wrapf(errors.ErrNotSupported, "script before rules %d", RulesScript)
+		}
+		if err := script.Check(output.LockingScript); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkKeySpend checks that an input spending a single key output carries
+// the key the output pays to, so only its owner can sign for it.
+func checkKeySpend(input *proto.TxInput, utxo *UTXO) error {
+	switch utxo.Type {
+	case proto.OutputType_OUTPUT_TRANSFER, proto.OutputType_OUTPUT_STAKE, proto.OutputType_OUTPUT_UNBONDING:
+	default:
+		return nil
+	}
+
+	key, err := encrypted.ParsePublicKey(input.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(key.Address().Bytes(), utxo.Address) {
+		return errors.Wrap(errors.ErrUnauthorized, "key does not own the output")
+	}
+
+	return nil
+}
 
-	block := &proto.Block{
-		Header: &proto.Header{
-			Version: 1,
-		},
-		Transactions: []*proto.Transaction{},
+// checkHTLCSpend checks that an input claims an HTLC output with its
+// preimage and the key of its recipient, or refunds it after the timeout
+// with the key of its sender. Only HTLC inputs carry preimages.
+func checkHTLCSpend(input *proto.TxInput, utxo *UTXO, height int32) error {
+	if utxo.Type != proto.OutputType_OUTPUT_HTLC {
+		if len(input.Preimage) != 0 {
+			return errors.Wrap(errors.ErrUnauthorized, "preimage spends an output without hash lock")
+		}
+		return nil
 	}
 
-	tx := &proto.Transaction{
-		Version: 1,
-		Inputs:  []*proto.TxInput{},
-		Outputs: []*proto.TxOutput{
-			{
-				Amount:  1000,
-				Address: privateKey.Public().Address().Bytes(),
-			},
-		},
+	key, err := encrypted.ParsePublicKey(input.PublicKey)
+	if err != nil {
+		return err
+	}
+	owner := utxo.RefundAddress
+	if len(input.Preimage) != 0 {
+		if err := types.CheckPreimage(utxo.HashLock, input.Preimage); err != nil {
+			return err
+		}
+		owner = utxo.Address
+	} else if height < utxo.UnlockHeight {
+		return errors.Wrapf(errors.ErrTxNotFinal, "HTLC can be refunded from height %d", utxo.UnlockHeight)
+	}
+	if !bytes.Equal(key.Address().Bytes(), owner) {
+		return errors.Wrap(errors.ErrUnauthorized, "key does not own the HTLC output")
+	}
+
+	return nil
+}
+
+// checkScriptSpend runs the scripts of input index of tx if it spends a
+// script output. Only script inputs carry unlocking scripts.
+func (c *Chain) checkScriptSpend(tx *proto.Transaction, index int, utxo *UTXO) error {
+	if utxo.Type != proto.OutputType_OUTPUT_SCRIPT {
+		if len(tx.Inputs[index].UnlockingScript) != 0 {
+			return errors.Wrapf(errors.ErrScript, "input %d unlocks an output without locking script", index)
+		}
+		return nil
 	}
 
-	block.Transactions = append(block.Transactions, tx)
-	types.SignBlock(privateKey, block)
+	return types.CheckScriptInput(tx, index, utxo.LockingScript, c.sigCache)
+}
+
+// checkMultisigSpend checks that an input spends a multisig output exactly
+// when it carries the policy the output pays to. The signatures are checked
+// with the others.
+func checkMultisigSpend(input *proto.TxInput, utxo *UTXO) error {
+	if utxo.Type != proto.OutputType_OUTPUT_MULTISIG {
+		if input.Multisig != nil {
+			return errors.Wrap(errors.ErrUnauthorized, "multisig input spends a single key output")
+		}
+		return nil
+	}
+
+	if input.Multisig == nil {
+		return errors.Wrap(errors.ErrUnauthorized, "multisig output spent without its keys")
+	}
+	if err := types.CheckMultisig(input.Multisig); err != nil {
+		return err
+	}
+	if !bytes.Equal(types.MultisigAddressOf(input.Multisig), utxo.Address) {
+		return errors.Wrap(errors.ErrUnauthorized, "keys do not match the multisig output")
+	}
+
+	return nil
+}
+
+// checkRules checks that header declares the version of the rules in force
+// at its height.
+func (c *Chain) checkRules(header *proto.Header) error {
+	rules, err := c.upgrades.Rules(header.Height)
+	if err != nil {
+		return err
+	}
+	if header.Version != rules.Version {
+		return errors.Wrapf(errors.ErrInvalidVersion, "block %d declares rules %d instead of %d", header.Height, header.Version, rules.Version)
+	}
+
+	return nil
+}
+
+func (c *Chain) checkChainID(chainID string) error {
+	if chainID != c.chainID {
+		return errors.Wrapf(errors.ErrInvalidChainID, "%q instead of %q", chainID, c.chainID)
+	}
+
+	return nil
+}
+
+// validateStake checks the stake outputs of a transaction included at
+// height. Bonded stake can only be spent by an unbonding transaction,
+// which freezes all of it for the unbonding period; its outputs stay
+// bonded to the validator, so it can still be slashed meanwhile.
+// unbonding is the validator of the stake tx spends, nil if there is none.
+func (c *Chain) validateStake(tx *proto.Transaction, hash string, height int32, unbonding []byte) error {
+	for i, output := range tx.Outputs {
+		switch output.Type {
+		case proto.OutputType_OUTPUT_TRANSFER, proto.OutputType_OUTPUT_MULTISIG, proto.OutputType_OUTPUT_HTLC, proto.OutputType_OUTPUT_SCRIPT:
+			if unbonding == nil {
+				continue
+			}
+		}
+		if c.staking == nil {
+			return fmt.Errorf("output %d of transaction %s is a %s output without a proof of stake engine", i, hash, output.Type)
+		}
+
+		switch {
+		case unbonding != nil && output.Type != proto.OutputType_OUTPUT_UNBONDING:
+			return fmt.Errorf("transaction %s spends stake into output %d that is not unbonding", hash, i)
+		case unbonding == nil && output.Type == proto.OutputType_OUTPUT_UNBONDING:
+			return fmt.Errorf("output %d of transaction %s is unbonding without spending stake", i, hash)
+		case output.Type == proto.OutputType_OUTPUT_UNBONDING && output.UnlockHeight < height+c.staking.Params().UnbondingPeriod:
+			return fmt.Errorf("output %d of transaction %s unlocks before height %d", i, hash, height+c.staking.Params().UnbondingPeriod)
+		case output.Type == proto.OutputType_OUTPUT_UNBONDING && !bytes.Equal(output.Validator, unbonding):
+			return fmt.Errorf("output %d of transaction %s is not bonded to validator %x of the stake it unbonds", i, hash, unbonding)
+		case output.Type == proto.OutputType_OUTPUT_STAKE && len(output.Validator) != encrypted.PublicKeyLen:
+			return fmt.Errorf("output %d of transaction %s is bonded to an invalid validator key", i, hash)
+		}
+	}
+
+	return nil
+}
+
+// chainView gives consensus engines read access to a chain whose lock is
+// already held.
+type chainView struct {
+	c *Chain
+}
+
+func (v chainView) Height() int {
+	return v.c.headers.Height()
+}
+
+func (v chainView) GetBlockByHeight(height int) (*proto.Block, error) {
+	return v.c.getBlockByHeight(height)
+}
+
+func (v chainView) GetBlockByHash(hash []byte) (*proto.Block, error) {
+	return v.c.GetBlockByHash(hash)
+}
+
+func (v chainView) ValidatorSet(height int32) (*consensus.ValidatorSet, error) {
+	return v.c.validatorSet(height)
+}
 
-	return block
+// utxoKey is the key under which the UTXO store keeps an output.
+func utxoKey(txHash []byte, outIndex uint32) string {
+	return fmt.Sprintf("%s_%d", hex.EncodeToString(txHash), outIndex)
 }
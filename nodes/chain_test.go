@@ -1,30 +1,74 @@
 package nodes
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/consensus"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/script"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/util"
+	pb "google.golang.org/protobuf/proto"
 )
 
+var (
+	// authorityKey seals the blocks of the chains created by newChain.
+	authorityKey = encrypted.GeneratePrivateKey()
+	// premineKey owns the coins the genesis of every test chain pays out.
+	premineKey = encrypted.GeneratePrivateKey()
+)
+
+func newChain() *Chain {
+	return NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), consensus.NewSingleAuthority(authorityKey.Public()), testGenesis(Genesis{}), nil)
+}
+
+// testGenesis returns the genesis block of g, paying 1000 to premineKey.
+func testGenesis(g Genesis) *proto.Block {
+	g.Allocations = map[string]int64{premineKey.Public().Address().String(): 1000}
+
+	block, err := g.Block()
+	if err != nil {
+		panic(err)
+	}
+
+	return block
+}
+
+// signTx signs every input of tx with key.
+func signTx(key *encrypted.PrivateKey, tx *proto.Transaction) *proto.Transaction {
+	for i := range tx.Inputs {
+		sig, err := types.SignTransaction(key, tx, i)
+		if err != nil {
+			panic(err)
+		}
+		tx.Inputs[i].Signature = sig.Bytes()
+	}
+
+	return tx
+}
+
 func randomBlock(t *testing.T, chain *Chain) *proto.Block {
-	privKey := encrypted.GeneratePrivateKey()
 	block := util.RandomBlock()
 	prevBlock, err := chain.GetBlockByHeight(chain.Height())
 	require.Nil(t, err)
 
+	block.Header.Height = prevBlock.Header.Height + 1
 	block.Header.PrevHash = types.HashBlock(prevBlock)
-	types.SignBlock(privKey, block)
+	types.SignBlock(authorityKey, block)
 
 	return block
 }
 
 func TestNewChain(t *testing.T) {
-	chain := NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+	chain := newChain()
 	require.Equal(t, 0, chain.Height())
 
 	_, err := chain.GetBlockByHeight(0)
@@ -32,7 +76,7 @@ func TestNewChain(t *testing.T) {
 }
 
 func TestChainHeight(t *testing.T) {
-	chain := NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+	chain := newChain()
 
 	for i := 0; i < 10; i++ {
 		block := randomBlock(t, chain)
@@ -43,7 +87,7 @@ func TestChainHeight(t *testing.T) {
 }
 
 func TestAddBlock(t *testing.T) {
-	chain := NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+	chain := newChain()
 
 	for i := 0; i < 100; i++ {
 		block := randomBlock(t, chain)
@@ -63,14 +107,15 @@ func TestAddBlock(t *testing.T) {
 
 func TestAddBlockWithTX(t *testing.T) {
 	var (
-		chain      = NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+		chain      = newChain()
 		block      = randomBlock(t, chain)
-		privateKey = encrypted.NewPrivateKeyFromSeedString(godSeed)
+		privateKey = premineKey
 		recipient  = encrypted.GeneratePrivateKey().Public().Address().Bytes()
 	)
 
-	prevTx, err := chain.txStore.Get("737cb341c1dd4a34f78faeb9ae8ffc07b5e9cf987a1ef0bfb65d98542f48aacb")
+	genesis, err := chain.GetBlockByHeight(0)
 	assert.Nil(t, err)
+	prevTx := genesis.Transactions[0]
 
 	inputs := []*proto.TxInput{
 		{
@@ -95,24 +140,24 @@ func TestAddBlockWithTX(t *testing.T) {
 		Outputs: outputs,
 	}
 
-	signature := types.SignTransaction(privateKey, tx)
-	tx.Inputs[0].Signature = signature.Bytes()
+	signTx(privateKey, tx)
 
 	block.Transactions = append(block.Transactions, tx)
-	types.SignBlock(privateKey, block)
+	types.SignBlock(authorityKey, block)
 	require.Nil(t, chain.AddBlock(block))
 }
 
 func TestAddBlockWithInsufficientFunds(t *testing.T) {
 	var (
-		chain      = NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+		chain      = newChain()
 		block      = randomBlock(t, chain)
-		privateKey = encrypted.NewPrivateKeyFromSeedString(godSeed)
+		privateKey = premineKey
 		recipient  = encrypted.GeneratePrivateKey().Public().Address().Bytes()
 	)
 
-	prevTx, err := chain.txStore.Get("737cb341c1dd4a34f78faeb9ae8ffc07b5e9cf987a1ef0bfb65d98542f48aacb")
+	genesis, err := chain.GetBlockByHeight(0)
 	assert.Nil(t, err)
+	prevTx := genesis.Transactions[0]
 
 	inputs := []*proto.TxInput{
 		{
@@ -133,9 +178,678 @@ func TestAddBlockWithInsufficientFunds(t *testing.T) {
 		Outputs: outputs,
 	}
 
-	signature := types.SignTransaction(privateKey, tx)
-	tx.Inputs[0].Signature = signature.Bytes()
+	signTx(privateKey, tx)
 
 	block.Transactions = append(block.Transactions, tx)
+	types.SignBlock(authorityKey, block)
 	require.NotNil(t, chain.AddBlock(block))
 }
+
+func TestAddBlockRejectsInvalidHeight(t *testing.T) {
+	chain := newChain()
+	block := randomBlock(t, chain)
+
+	block.Header.Height++
+	types.SignBlock(authorityKey, block)
+	require.NotNil(t, chain.AddBlock(block))
+	require.Equal(t, 0, chain.Height())
+}
+
+func mineBlock(t *testing.T, chain *Chain, parent *proto.Block, key *encrypted.PrivateKey, txx ...*proto.Transaction) *proto.Block {
+	block := &proto.Block{
+		Header: &proto.Header{
+			Version:   1,
+			Height:    parent.Header.Height + 1,
+			PrevHash:  types.HashBlock(parent),
+			Timestamp: parent.Header.Timestamp + int64(time.Second),
+		},
+		Transactions: txx,
+	}
+	require.Nil(t, chain.engine.Propose(context.Background(), chain, block, key))
+
+	return block
+}
+
+func TestForkChoiceFollowsMostWork(t *testing.T) {
+	var (
+		chain = NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), consensus.NewProofOfWork(consensus.PowParams{LimitBits: 0x207fffff}), testGenesis(Genesis{}), nil)
+		miner = encrypted.GeneratePrivateKey()
+		spend = premineKey
+	)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	var disconnected, connected []*proto.Block
+	chain.onReorganize = func(d, c []*proto.Block) {
+		disconnected, connected = d, c
+	}
+
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: types.HashTransaction(genesis.Transactions[0]),
+			PublicKey:  spend.Public().Bytes(),
+		}},
+		Outputs: []*proto.TxOutput{{Amount: 1000, Address: miner.Public().Address().Bytes()}},
+	}
+	signTx(spend, tx)
+
+	a1 := mineBlock(t, chain, genesis, miner, tx)
+	require.Nil(t, chain.AddBlock(a1))
+	a2 := mineBlock(t, chain, a1, miner)
+	require.Nil(t, chain.AddBlock(a2))
+
+	// a competing branch stays on the side until it has more work
+	b1 := mineBlock(t, chain, genesis, miner)
+	require.Nil(t, chain.AddBlock(b1))
+	b2 := mineBlock(t, chain, b1, miner)
+	require.Nil(t, chain.AddBlock(b2))
+	assert.Equal(t, types.HashBlock(a2), types.HashHeader(chain.Tip()))
+	require.NotNil(t, chain.AddBlock(b2))
+
+	assert.Empty(t, connected)
+
+	b3 := mineBlock(t, chain, b2, miner)
+	require.Nil(t, chain.AddBlock(b3))
+	assert.Equal(t, types.HashBlock(b3), types.HashHeader(chain.Tip()))
+	assert.Equal(t, 3, chain.Height())
+
+	// only the blocks after the fork point are switched
+	assert.Equal(t, []*proto.Block{a2, a1}, disconnected)
+	assert.Equal(t, []*proto.Block{b1, b2, b3}, connected)
+
+	block, err := chain.GetBlockByHeight(1)
+	require.Nil(t, err)
+	assert.Equal(t, types.HashBlock(b1), types.HashBlock(block))
+
+	// the transaction of the abandoned branch is unspent again
+	utxo, err := chain.utxoStore.Get(utxoKey(types.HashTransaction(genesis.Transactions[0]), 0))
+	require.Nil(t, err)
+	assert.False(t, utxo.Spent)
+	_, err = chain.utxoStore.Get(utxoKey(types.HashTransaction(tx), 0))
+	assert.NotNil(t, err)
+
+	// and can be spent on the new branch
+	b4 := mineBlock(t, chain, b3, miner, tx)
+	require.Nil(t, chain.AddBlock(b4))
+	assert.Equal(t, 4, chain.Height())
+}
+
+func TestProofOfWorkRejectsForwardDatedBlocks(t *testing.T) {
+	var (
+		chain = NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), consensus.NewProofOfWork(consensus.PowParams{LimitBits: 0x207fffff}), testGenesis(Genesis{Time: time.Now()}), nil)
+		miner = encrypted.GeneratePrivateKey()
+	)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	// dating blocks ahead would stretch the interval difficulty is
+	// retargeted over
+	block := mineBlock(t, chain, genesis, miner)
+	block.Header.Timestamp = time.Now().Add(time.Hour).UnixNano()
+	require.Nil(t, chain.engine.Propose(context.Background(), chain, block, miner))
+	assert.NotNil(t, chain.AddBlock(block))
+	assert.Equal(t, 0, chain.Height())
+
+	require.Nil(t, chain.AddBlock(mineBlock(t, chain, genesis, miner)))
+}
+
+func TestForkChoiceRejectsInvalidBranch(t *testing.T) {
+	var (
+		chain = NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), consensus.NewProofOfWork(consensus.PowParams{LimitBits: 0x207fffff}), testGenesis(Genesis{}), nil)
+		miner = encrypted.GeneratePrivateKey()
+	)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	a1 := mineBlock(t, chain, genesis, miner)
+	require.Nil(t, chain.AddBlock(a1))
+
+	// overspends the genesis output, which is only checked on reorganising
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: types.HashTransaction(genesis.Transactions[0]),
+			PublicKey:  miner.Public().Bytes(),
+		}},
+		Outputs: []*proto.TxOutput{{Amount: 5000, Address: miner.Public().Address().Bytes()}},
+	}
+	signTx(miner, tx)
+
+	b1 := mineBlock(t, chain, genesis, miner, tx)
+	require.Nil(t, chain.AddBlock(b1))
+	b2 := mineBlock(t, chain, b1, miner)
+	require.NotNil(t, chain.AddBlock(b2))
+
+	assert.Equal(t, types.HashBlock(a1), types.HashHeader(chain.Tip()))
+	assert.Equal(t, 1, chain.Height())
+
+	// the current branch is connected again as it was
+	utxo, err := chain.utxoStore.Get(utxoKey(types.HashTransaction(genesis.Transactions[0]), 0))
+	require.Nil(t, err)
+	assert.False(t, utxo.Spent)
+	require.Nil(t, chain.AddBlock(mineBlock(t, chain, a1, miner)))
+	assert.Equal(t, 2, chain.Height())
+}
+
+func TestChainWithoutForksRejectsSideBlocks(t *testing.T) {
+	chain := newChain()
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	require.Nil(t, chain.AddBlock(randomBlock(t, chain)))
+
+	side := util.RandomBlock()
+	side.Header.Height = 1
+	side.Header.PrevHash = types.HashBlock(genesis)
+	types.SignBlock(authorityKey, side)
+
+	require.NotNil(t, chain.AddBlock(side))
+	assert.False(t, chain.HasBlock(types.HashBlock(side)))
+}
+
+func TestChainRejectsForwardDatedHeaders(t *testing.T) {
+	var (
+		a, b    = encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey()
+		timeout = 10 * time.Second
+		engine  = consensus.NewProofOfAuthority([]*encrypted.PublicKey{a.Public(), b.Public()}, timeout)
+		chain   = NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), engine, testGenesis(Genesis{Time: time.Now()}), nil)
+	)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	next := func(key *encrypted.PrivateKey, timestamp int64) *proto.Block {
+		block := &proto.Block{
+			Header: &proto.Header{
+				Version:   1,
+				Height:    1,
+				PrevHash:  types.HashBlock(genesis),
+				Timestamp: timestamp,
+			},
+		}
+		require.Nil(t, engine.Propose(context.Background(), chain, block, key))
+
+		return block
+	}
+
+	// b is in turn now; a dates its block a timeout ahead to take the turn
+	early := next(a, genesis.Header.Timestamp+int64(timeout))
+	err = chain.AddBlock(early)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "ahead of local time")
+	assert.Equal(t, 0, chain.Height())
+
+	require.Nil(t, chain.AddBlock(next(b, genesis.Header.Timestamp+1)))
+}
+
+// stakeBlock builds the next block on the tip and seals it by whichever of
+// keys is its proposer.
+func stakeBlock(t *testing.T, chain *Chain, keys []*encrypted.PrivateKey, evidence []*proto.Evidence, txx ...*proto.Transaction) *proto.Block {
+	parent, err := chain.GetBlockByHeight(chain.Height())
+	require.Nil(t, err)
+
+	block := &proto.Block{
+		Header: &proto.Header{
+			Version:   1,
+			Height:    parent.Header.Height + 1,
+			PrevHash:  types.HashBlock(parent),
+			Timestamp: parent.Header.Timestamp + int64(time.Second),
+		},
+		Transactions: txx,
+		Evidence:     evidence,
+	}
+	if len(txx) > 0 {
+		tree, err := types.GetMerkleTree(block)
+		require.Nil(t, err)
+		block.Header.RootHash = tree.MerkleRoot()
+	}
+
+	proposer, err := chain.engine.SelectProposer(chain, block.Header.Height, block.Header.Timestamp)
+	require.Nil(t, err)
+	for _, key := range keys {
+		if bytes.Equal(key.Public().Bytes(), proposer) {
+			require.Nil(t, chain.engine.Propose(context.Background(), chain, block, key))
+			return block
+		}
+	}
+	t.Fatalf("proposer %x not among the keys", proposer)
+
+	return nil
+}
+
+func TestStakeBondingAndUnbonding(t *testing.T) {
+	var (
+		a, b, c = encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey()
+		keys    = []*encrypted.PrivateKey{a, b, c}
+		engine  = consensus.NewProofOfStake(consensus.PosParams{EpochLength: 2, UnbondingPeriod: 3}, time.Minute)
+		genesis = testGenesis(Genesis{Engine: EnginePoS, Validators: []*encrypted.PublicKey{a.Public(), b.Public()}, Stake: 100})
+		chain   = NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), engine, genesis, nil)
+		spend   = premineKey
+	)
+	genesisHash := types.HashTransaction(genesis.Transactions[0])
+
+	set, err := chain.ValidatorSet(1)
+	require.Nil(t, err)
+	assert.Len(t, set.Validators(), 2)
+
+	// bond the genesis coins to c and start unbonding the stake of a
+	bond := &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{{PrevTxHash: genesisHash, PublicKey: spend.Public().Bytes()}},
+		Outputs: []*proto.TxOutput{types.StakeOutput(1000, c.Public().Address(), c.Public())},
+	}
+	signTx(spend, bond)
+
+	unbondInputs := func() []*proto.TxInput {
+		return []*proto.TxInput{{PrevTxHash: genesisHash, PrevOutIndex: 1, PublicKey: a.Public().Bytes()}}
+	}
+	signed := func(tx *proto.Transaction) *proto.Transaction {
+		return signTx(a, tx)
+	}
+
+	// stake can neither be spent freely nor unlocked early
+	transfer := signed(&proto.Transaction{
+		Version: 1,
+		Inputs:  unbondInputs(),
+		Outputs: []*proto.TxOutput{{Amount: 100, Address: a.Public().Address().Bytes()}},
+	})
+	assert.NotNil(t, chain.ValidateTransaction(transfer))
+	early := signed(types.NewUnbondingTransaction(unbondInputs(), 100, a.Public().Address(), a.Public(), 3))
+	assert.NotNil(t, chain.ValidateTransaction(early))
+
+	// nor unbonded by another validator
+	theft := signTx(b, types.NewUnbondingTransaction([]*proto.TxInput{{PrevTxHash: genesisHash, PrevOutIndex: 1, PublicKey: b.Public().Bytes()}}, 100, b.Public().Address(), a.Public(), 4))
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(theft), errors.ErrUnauthorized))
+
+	unbond := signed(types.NewUnbondingTransaction(unbondInputs(), 100, a.Public().Address(), a.Public(), 4))
+	require.Nil(t, chain.AddBlock(stakeBlock(t, chain, keys, nil, bond, unbond)))
+	require.Nil(t, chain.AddBlock(stakeBlock(t, chain, keys, nil)))
+
+	// the second epoch is made up of the stake bonded at its start
+	set, err = chain.ValidatorSet(2)
+	require.Nil(t, err)
+	assert.Equal(t, int64(100), set.Power(a.Public().Bytes()))
+	set, err = chain.ValidatorSet(3)
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), set.Power(a.Public().Bytes()))
+	assert.Equal(t, int64(100), set.Power(b.Public().Bytes()))
+	assert.Equal(t, int64(1000), set.Power(c.Public().Bytes()))
+
+	// unbonded funds stay frozen until the unlock height
+	withdraw := &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{{PrevTxHash: types.HashTransaction(unbond), PublicKey: a.Public().Bytes()}},
+		Outputs: []*proto.TxOutput{{Amount: 100, Address: a.Public().Address().Bytes()}},
+	}
+	signTx(a, withdraw)
+	assert.NotNil(t, chain.ValidateTransaction(withdraw))
+
+	require.Nil(t, chain.AddBlock(stakeBlock(t, chain, keys, nil)))
+	require.Nil(t, chain.ValidateTransaction(withdraw))
+	require.Nil(t, chain.AddBlock(stakeBlock(t, chain, keys, nil, withdraw)))
+}
+
+func TestStakeOutputsNeedProofOfStake(t *testing.T) {
+	var (
+		chain = newChain()
+		spend = premineKey
+	)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{{PrevTxHash: types.HashTransaction(genesis.Transactions[0]), PublicKey: spend.Public().Bytes()}},
+		Outputs: []*proto.TxOutput{types.StakeOutput(1000, spend.Public().Address(), spend.Public())},
+	}
+	signTx(spend, tx)
+
+	assert.NotNil(t, chain.ValidateTransaction(tx))
+}
+
+func TestEvidenceSlashesStake(t *testing.T) {
+	var (
+		a, b    = encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey()
+		keys    = []*encrypted.PrivateKey{a, b}
+		engine  = consensus.NewProofOfStake(consensus.PosParams{EpochLength: 10, UnbondingPeriod: 3}, time.Minute)
+		genesis = testGenesis(Genesis{Engine: EnginePoS, Validators: []*encrypted.PublicKey{a.Public(), b.Public()}, Stake: 100})
+		chain   = NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), engine, genesis, nil)
+	)
+
+	// the proposer of height 1 signs a second block at the same height
+	block := stakeBlock(t, chain, keys, nil)
+	require.Nil(t, chain.AddBlock(block))
+
+	offender := a
+	if bytes.Equal(block.PublicKey, b.Public().Bytes()) {
+		offender = b
+	}
+	conflicting := pb.Clone(block).(*proto.Block)
+	conflicting.Header.Timestamp++
+	types.SignBlock(offender, conflicting)
+	require.NotNil(t, chain.AddBlock(conflicting))
+
+	evidence := types.NewEvidence(block, conflicting)
+	require.Nil(t, chain.ValidateEvidence(evidence))
+
+	// evidence against somebody without stake is worthless
+	outsider := encrypted.GeneratePrivateKey()
+	forged := pb.Clone(block).(*proto.Block)
+	types.SignBlock(outsider, forged)
+	types.SignBlock(outsider, conflicting)
+	assert.NotNil(t, chain.ValidateEvidence(types.NewEvidence(forged, conflicting)))
+
+	// and so are headers the offender signed on another chain
+	other, otherConflicting := pb.Clone(block).(*proto.Block), pb.Clone(conflicting).(*proto.Block)
+	other.Header.ChainId, otherConflicting.Header.ChainId = "other", "other"
+	types.SignBlock(offender, other)
+	types.SignBlock(offender, otherConflicting)
+	assert.True(t, errors.IsOf(chain.ValidateEvidence(types.NewEvidence(other, otherConflicting)), errors.ErrInvalidChainID))
+
+	require.Nil(t, chain.AddBlock(stakeBlock(t, chain, keys, []*proto.Evidence{evidence})))
+
+	// the offender is jailed and its stake burnt
+	set, err := chain.ValidatorSet(3)
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), set.Power(offender.Public().Bytes()))
+	assert.Len(t, set.Validators(), 1)
+
+	genesisHash := types.HashTransaction(genesis.Transactions[0])
+	for index := uint32(1); index <= 2; index++ {
+		utxo, err := chain.utxoStore.Get(utxoKey(genesisHash, index))
+		require.Nil(t, err)
+		assert.Equal(t, bytes.Equal(utxo.Validator, offender.Public().Bytes()), utxo.Spent)
+	}
+
+	// and cannot be slashed twice
+	assert.NotNil(t, chain.ValidateEvidence(evidence))
+	require.Nil(t, chain.AddBlock(stakeBlock(t, chain, keys, nil)))
+}
+
+func TestEvidenceSlashesUnbondingStake(t *testing.T) {
+	var (
+		a, b    = encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey()
+		keys    = []*encrypted.PrivateKey{a, b}
+		engine  = consensus.NewProofOfStake(consensus.PosParams{EpochLength: 10, UnbondingPeriod: 3}, time.Minute)
+		genesis = testGenesis(Genesis{Engine: EnginePoS, Validators: []*encrypted.PublicKey{a.Public(), b.Public()}, Stake: 100})
+		chain   = NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), engine, genesis, nil)
+	)
+
+	block := stakeBlock(t, chain, keys, nil)
+	require.Nil(t, chain.AddBlock(block))
+
+	offender, index := a, uint32(1)
+	if bytes.Equal(block.PublicKey, b.Public().Bytes()) {
+		offender, index = b, 2
+	}
+
+	// the offender unbonds its stake before its equivocation comes out
+	inputs := []*proto.TxInput{{PrevTxHash: types.HashTransaction(genesis.Transactions[0]), PrevOutIndex: index, PublicKey: offender.Public().Bytes()}}
+	unbond := types.NewUnbondingTransaction(inputs, 100, offender.Public().Address(), offender.Public(), 5)
+	assert.Equal(t, offender.Public().Bytes(), unbond.Outputs[0].Validator)
+
+	// unbonding stake cannot leave its validator
+	escape := pb.Clone(unbond).(*proto.Transaction)
+	escape.Outputs[0].Validator = nil
+	assert.NotNil(t, chain.ValidateTransaction(signTx(offender, escape)))
+
+	signTx(offender, unbond)
+	require.Nil(t, chain.AddBlock(stakeBlock(t, chain, keys, nil, unbond)))
+
+	conflicting := pb.Clone(block).(*proto.Block)
+	conflicting.Header.Timestamp++
+	types.SignBlock(offender, conflicting)
+	require.Nil(t, chain.AddBlock(stakeBlock(t, chain, keys, []*proto.Evidence{types.NewEvidence(block, conflicting)})))
+
+	utxo, err := chain.utxoStore.Get(utxoKey(types.HashTransaction(unbond), 0))
+	require.Nil(t, err)
+	assert.True(t, utxo.Spent)
+}
+
+func TestBlockCommitsToWitness(t *testing.T) {
+	var (
+		chain   = newChain()
+		genesis = mustBlock(t, chain, 0)
+	)
+	tx := signTx(premineKey, &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{{PrevTxHash: types.HashTransaction(genesis.Transactions[0]), PublicKey: premineKey.Public().Bytes()}},
+		Outputs: []*proto.TxOutput{{Amount: 1000, Address: premineKey.Public().Address().Bytes()}},
+	})
+
+	// the same transaction twice spends its output twice
+	block := randomBlock(t, chain)
+	block.Transactions = []*proto.Transaction{tx, tx}
+	types.SignBlock(authorityKey, block)
+	assert.NotNil(t, chain.AddBlock(block))
+
+	// swapping a signature keeps the txid but breaks the block's merkle root
+	block = randomBlock(t, chain)
+	block.Transactions = []*proto.Transaction{tx}
+	types.SignBlock(authorityKey, block)
+
+	txid := types.HashTransaction(tx)
+	tx.Inputs[0].Signature = append([]byte{}, tx.Inputs[0].Signature...)
+	tx.Inputs[0].Signature[0] ^= 1
+	assert.Equal(t, txid, types.HashTransaction(tx))
+	assert.NotNil(t, chain.AddBlock(block))
+
+	tx.Inputs[0].Signature[0] ^= 1
+	require.Nil(t, chain.AddBlock(block))
+
+	_, err := chain.txStore.Get(hex.EncodeToString(txid))
+	assert.Nil(t, err)
+}
+
+func TestBlockReusesMempoolSignatureChecks(t *testing.T) {
+	var (
+		chain   = newChain()
+		genesis = mustBlock(t, chain, 0)
+	)
+	tx := signTx(premineKey, &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{{PrevTxHash: types.HashTransaction(genesis.Transactions[0]), PublicKey: premineKey.Public().Bytes()}},
+		Outputs: []*proto.TxOutput{{Amount: 1000, Address: premineKey.Public().Address().Bytes()}},
+	})
+	require.Nil(t, chain.ValidateTransaction(tx))
+	assert.Equal(t, int64(0), chain.SigCacheStats().Hits)
+
+	block := randomBlock(t, chain)
+	block.Transactions = []*proto.Transaction{tx}
+	types.SignBlock(authorityKey, block)
+	require.Nil(t, chain.AddBlock(block))
+
+	stats := chain.SigCacheStats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, 0.5, stats.HitRate())
+}
+
+func TestMultisigOutputs(t *testing.T) {
+	var (
+		upgrades = UpgradeSchedule{{Name: "multisig", Height: 1, Version: RulesMultisig}}
+		chain    = NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), consensus.NewSingleAuthority(authorityKey.Public()), testGenesis(Genesis{}), upgrades)
+		genesis  = mustBlock(t, chain, 0)
+		signers  = []*encrypted.PrivateKey{encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey()}
+		keys     = []*encrypted.PublicKey{signers[0].Public(), signers[1].Public(), signers[2].Public()}
+	)
+	fund := signTx(premineKey, &proto.Transaction{
+		Version: RulesMultisig,
+		Inputs:  []*proto.TxInput{{PrevTxHash: types.HashTransaction(genesis.Transactions[0]), PublicKey: premineKey.Public().Bytes()}},
+		Outputs: []*proto.TxOutput{types.MultisigOutput(1000, 2, keys)},
+	})
+
+	// chains without the upgrade reject multisig outputs
+	fund.Version = RulesGenesis
+	signTx(premineKey, fund)
+	assert.True(t, errors.IsOf(newChain().ValidateTransaction(fund), errors.ErrNotSupported))
+	fund.Version = RulesMultisig
+	signTx(premineKey, fund)
+
+	block := randomBlock(t, chain)
+	block.Header.Version = RulesMultisig
+	block.Transactions = []*proto.Transaction{fund}
+	types.SignBlock(authorityKey, block)
+	require.Nil(t, chain.AddBlock(block))
+
+	spend := &proto.Transaction{
+		Version: RulesMultisig,
+		Inputs:  []*proto.TxInput{types.MultisigInput(types.HashTransaction(fund), 0, 2, keys)},
+		Outputs: []*proto.TxOutput{{Amount: 1000, Address: premineKey.Public().Address().Bytes()}},
+	}
+	require.Nil(t, types.CoSignTransaction(signers[2], spend, 0))
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(spend), errors.ErrUnauthorized))
+
+	require.Nil(t, types.CoSignTransaction(signers[0], spend, 0))
+	require.Nil(t, chain.ValidateTransaction(spend))
+
+	// a policy of the same keys in another order pays to another address
+	swapped := types.MultisigInput(types.HashTransaction(fund), 0, 2, []*encrypted.PublicKey{keys[1], keys[0], keys[2]})
+	other := &proto.Transaction{Version: RulesMultisig, Inputs: []*proto.TxInput{swapped}, Outputs: spend.Outputs}
+	require.Nil(t, types.CoSignTransaction(signers[0], other, 0))
+	require.Nil(t, types.CoSignTransaction(signers[1], other, 0))
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(other), errors.ErrUnauthorized))
+
+	// a single key cannot spend the output
+	single := signTx(signers[0], &proto.Transaction{
+		Version: RulesMultisig,
+		Inputs:  []*proto.TxInput{{PrevTxHash: types.HashTransaction(fund), PublicKey: keys[0].Bytes()}},
+		Outputs: spend.Outputs,
+	})
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(single), errors.ErrUnauthorized))
+}
+
+// versionBlock returns a block of txx extending the tip of chain under the
+// given rules, stamped with timestamp.
+func versionBlock(t *testing.T, chain *Chain, version int32, timestamp int64, txx ...*proto.Transaction) *proto.Block {
+	block := randomBlock(t, chain)
+	block.Header.Version = version
+	block.Header.Timestamp = timestamp
+	block.Header.ChainId = chain.ChainID()
+	block.Transactions = txx
+	types.SignBlock(authorityKey, block)
+
+	return block
+}
+
+func TestTimelocks(t *testing.T) {
+	var (
+		upgrades = UpgradeSchedule{{Name: "timelocks", Height: 1, Version: RulesTimelocks}}
+		chain    = NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), consensus.NewSingleAuthority(authorityKey.Public()), testGenesis(Genesis{}), upgrades)
+		genesis  = mustBlock(t, chain, 0)
+		start    = types.LockTimeThreshold + 1000
+	)
+	spend := func(prev *proto.Transaction, lockTime int64, relativeLock uint32) *proto.Transaction {
+		return signTx(premineKey, &proto.Transaction{
+			Version:  RulesTimelocks,
+			Inputs:   []*proto.TxInput{{PrevTxHash: types.HashTransaction(prev), PublicKey: premineKey.Public().Bytes(), RelativeLock: relativeLock}},
+			Outputs:  []*proto.TxOutput{{Amount: 1000, Address: premineKey.Public().Address().Bytes()}},
+			LockTime: lockTime,
+		})
+	}
+
+	// chains without the upgrade reject time locked transactions
+	locked := spend(genesis.Transactions[0], 2, 0)
+	locked.Version = RulesGenesis
+	signTx(premineKey, locked)
+	assert.True(t, errors.IsOf(newChain().ValidateTransaction(locked), errors.ErrNotSupported))
+
+	// a height lock is final from its height on
+	locked = spend(genesis.Transactions[0], 2, 0)
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(locked), errors.ErrTxNotFinal))
+	assert.True(t, errors.IsOf(chain.AddBlock(versionBlock(t, chain, RulesTimelocks, start, locked)), errors.ErrTxNotFinal))
+	require.Nil(t, chain.AddBlock(versionBlock(t, chain, RulesTimelocks, start)))
+	require.Nil(t, chain.ValidateTransaction(locked))
+	require.Nil(t, chain.AddBlock(versionBlock(t, chain, RulesTimelocks, start+10, locked)))
+
+	// a time lock is final once the median time past of the tip reaches
+	// it, not as soon as the tip does
+	timed := spend(locked, start+10, 0)
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(timed), errors.ErrTxNotFinal))
+	require.Nil(t, chain.AddBlock(versionBlock(t, chain, RulesTimelocks, start+20)))
+	require.Nil(t, chain.ValidateTransaction(timed))
+	require.Nil(t, chain.AddBlock(versionBlock(t, chain, RulesTimelocks, start+30, timed)))
+
+	// a relative lock counts blocks since the spent output was included at
+	// height 4
+	relative := spend(timed, 0, 2)
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(relative), errors.ErrTxNotFinal))
+	require.Nil(t, chain.AddBlock(versionBlock(t, chain, RulesTimelocks, start+40)))
+	require.Nil(t, chain.ValidateTransaction(relative))
+}
+
+func TestScriptOutputs(t *testing.T) {
+	var (
+		upgrades = UpgradeSchedule{{Name: "script", Height: 1, Version: RulesScript}}
+		chain    = NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), consensus.NewSingleAuthority(authorityKey.Public()), testGenesis(Genesis{}), upgrades)
+		genesis  = mustBlock(t, chain, 0)
+		alice    = encrypted.GeneratePrivateKey()
+		bob      = encrypted.GeneratePrivateKey()
+	)
+	// 2-of-2 of alice and bob, or alice alone from height 5
+	locking, err := script.NewBuilder().
+		AddNumber(2).AddData(alice.Public().Bytes()).AddData(bob.Public().Bytes()).AddNumber(2).AddOp(script.OpCheckMultisig).
+		Script()
+	require.Nil(t, err)
+	timeLocked, err := script.NewBuilder().
+		AddNumber(5).AddOp(script.OpCheckLockTimeVerify).AddData(alice.Public().Bytes()).AddOp(script.OpCheckSig).
+		Script()
+	require.Nil(t, err)
+
+	fund := signTx(premineKey, &proto.Transaction{
+		Version: RulesScript,
+		Inputs:  []*proto.TxInput{{PrevTxHash: types.HashTransaction(genesis.Transactions[0]), PublicKey: premineKey.Public().Bytes()}},
+		Outputs: []*proto.TxOutput{types.ScriptOutput(500, locking), types.ScriptOutput(500, timeLocked)},
+	})
+
+	// chains without the upgrade reject script outputs
+	fund.Version = RulesGenesis
+	signTx(premineKey, fund)
+	assert.True(t, errors.IsOf(newChain().ValidateTransaction(fund), errors.ErrNotSupported))
+	fund.Version = RulesScript
+	signTx(premineKey, fund)
+	require.Nil(t, chain.AddBlock(versionBlock(t, chain, RulesScript, 1, fund)))
+
+	spend := func(index uint32, lockTime int64, signers ...*encrypted.PrivateKey) *proto.Transaction {
+		tx := &proto.Transaction{
+			Version:  RulesScript,
+			Inputs:   []*proto.TxInput{{PrevTxHash: types.HashTransaction(fund), PrevOutIndex: index}},
+			Outputs:  []*proto.TxOutput{{Amount: 500, Address: alice.Public().Address().Bytes()}},
+			LockTime: lockTime,
+		}
+		unlocking := script.NewBuilder()
+		for _, signer := range signers {
+			sig, err := types.SignTransaction(signer, tx, 0)
+			require.Nil(t, err)
+			unlocking.AddData(sig.Bytes())
+		}
+		tx.Inputs[0].UnlockingScript, err = unlocking.Script()
+		require.Nil(t, err)
+
+		return tx
+	}
+
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(spend(0, 0, alice)), errors.ErrScript))
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(spend(0, 0, bob, alice)), errors.ErrScript))
+	require.Nil(t, chain.ValidateTransaction(spend(0, 0, alice, bob)))
+
+	// the unlocking script is witness data, the signatures cover the rest
+	tampered := spend(0, 0, alice, bob)
+	tampered.Outputs[0].Amount = 400
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(tampered), errors.ErrScript))
+
+	// the time locked output needs a transaction locked until height 5
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(spend(1, 0, alice)), errors.ErrScript))
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(spend(1, 5, alice)), errors.ErrTxNotFinal))
+	for chain.Height() < 4 {
+		require.Nil(t, chain.AddBlock(versionBlock(t, chain, RulesScript, int64(chain.Height()+1))))
+	}
+	require.Nil(t, chain.ValidateTransaction(spend(1, 5, alice)))
+
+	// signatures alone do not spend script outputs
+	plain := signTx(alice, &proto.Transaction{
+		Version: RulesScript,
+		Inputs:  []*proto.TxInput{{PrevTxHash: types.HashTransaction(fund), PublicKey: alice.Public().Bytes()}},
+		Outputs: []*proto.TxOutput{{Amount: 500, Address: alice.Public().Address().Bytes()}},
+	})
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(plain), errors.ErrScript))
+}
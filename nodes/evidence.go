@@ -0,0 +1,197 @@
+package nodes
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/version"
+)
+
+const (
+	// evidenceWindow is how many heights below the tip signed headers are
+	// kept to catch equivocation.
+	evidenceWindow = 100
+	// maxPendingEvidence bounds the evidence kept until it is committed.
+	maxPendingEvidence = 1000
+)
+
+// EvidencePool remembers the first header every validator signed at each
+// recent height and collects the evidence of validators that signed a
+// second one, until it is committed.
+type EvidencePool struct {
+	lock    sync.Mutex
+	signed  map[string]*proto.Block
+	pending map[string]*proto.Evidence
+}
+
+func NewEvidencePool() *EvidencePool {
+	return &EvidencePool{
+		signed:  make(map[string]*proto.Block),
+		pending: make(map[string]*proto.Evidence),
+	}
+}
+
+// Observe records the header of a block with a valid signature. It returns
+// new evidence if the signer already signed a different header at the same
+// height.
+func (p *EvidencePool) Observe(block *proto.Block) *proto.Evidence {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key := fmt.Sprintf("%x/%d", block.PublicKey, block.Header.Height)
+	first, ok := p.signed[key]
+	if !ok {
+		p.signed[key] = &proto.Block{Header: block.Header, PublicKey: block.PublicKey, Signature: block.Signature}
+		return nil
+	}
+
+	evidence := types.NewEvidence(first, block)
+	if !types.VerifyEvidence(evidence) || !p.add(evidence) {
+		return nil
+	}
+
+	return evidence
+}
+
+// Add adds evidence and reports whether it was new. A full pool takes no
+// more evidence until some is committed.
+func (p *EvidencePool) Add(evidence *proto.Evidence) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.add(evidence)
+}
+
+func (p *EvidencePool) add(evidence *proto.Evidence) bool {
+	hash := hex.EncodeToString(types.HashEvidence(evidence))
+	if _, ok := p.pending[hash]; ok || len(p.pending) >= maxPendingEvidence {
+		return false
+	}
+	p.pending[hash] = evidence
+
+	return true
+}
+
+func (p *EvidencePool) List() []*proto.Evidence {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	evidence := make([]*proto.Evidence, 0, len(p.pending))
+	for _, e := range p.pending {
+		evidence = append(evidence, e)
+	}
+
+	return evidence
+}
+
+func (p *EvidencePool) Remove(evidence *proto.Evidence) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.pending, hex.EncodeToString(types.HashEvidence(evidence)))
+}
+
+func (p *EvidencePool) Len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return len(p.pending)
+}
+
+// Prune forgets the signed headers below height.
+func (p *EvidencePool) Prune(height int32) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for key, block := range p.signed {
+		if block.Header.Height < height {
+			delete(p.signed, key)
+		}
+	}
+}
+
+func (n *Node) HandleEvidence(ctx context.Context, evidence *proto.Evidence) (*proto.Ack, error) {
+	if n.evidence == nil {
+		return &proto.Ack{}, nil
+	}
+	// only evidence the chain would slash for is kept and relayed
+	if err := n.chain.ValidateEvidence(evidence); err != nil {
+		return nil, err
+	}
+
+	if n.evidence.Add(evidence) {
+		n.broadcastEvidence(evidence)
+	}
+
+	return &proto.Ack{}, nil
+}
+
+// observe looks for equivocation in a block we received or produced and
+// spreads the evidence it finds. Only headers of validators of the epoch,
+// at most evidenceWindow heights below the tip and at most one above it,
+// are recorded; anything else could be signed by anybody in any number.
+func (n *Node) observe(block *proto.Block) {
+	if n.evidence == nil {
+		return
+	}
+
+	tip := int32(n.chain.Height())
+	height := block.Header.Height
+	if height <= tip-evidenceWindow || height > tip+1 {
+		return
+	}
+	set, err := n.chain.ValidatorSet(height)
+	if err != nil || set.Power(block.PublicKey) == 0 || !types.VerifyBlock(block) {
+		return
+	}
+
+	n.evidence.Prune(tip - evidenceWindow)
+	if evidence := n.evidence.Observe(block); evidence != nil {
+		n.logger.Warnw("Validator signed conflicting blocks", "publicKey", hex.EncodeToString(evidence.PublicKey), "height", evidence.HeaderA.Height)
+		n.broadcastEvidence(evidence)
+	}
+}
+
+func (n *Node) broadcastEvidence(evidence *proto.Evidence) {
+	key := "evidence/" + hex.EncodeToString(types.HashEvidence(evidence))
+	n.broadcast(key, func(ctx context.Context, p *peer) error {
+		if !p.supports(FeatureEvidence, version.EvidenceP2PProtocol) {
+			return nil
+		}
+		_, err := p.client.HandleEvidence(ctx, evidence)
+		return err
+	})
+}
+
+// pendingEvidence returns the evidence a block on top of the tip can
+// include, dropping evidence the chain no longer accepts.
+func (n *Node) pendingEvidence() []*proto.Evidence {
+	if n.evidence == nil {
+		return nil
+	}
+
+	var (
+		included  []*proto.Evidence
+		convicted = make(map[string]bool)
+	)
+	for _, evidence := range n.evidence.List() {
+		if err := n.chain.ValidateEvidence(evidence); err != nil {
+			n.logger.Debugw("Dropping evidence", "error", err)
+			n.evidence.Remove(evidence)
+			continue
+		}
+
+		key := hex.EncodeToString(evidence.PublicKey)
+		if convicted[key] {
+			continue
+		}
+		convicted[key] = true
+		included = append(included, evidence)
+	}
+
+	return included
+}
@@ -0,0 +1,141 @@
+package nodes
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/util"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestEvidencePoolObserve(t *testing.T) {
+	var (
+		pool  = NewEvidencePool()
+		key   = encrypted.GeneratePrivateKey()
+		block = util.RandomBlock()
+	)
+	block.Header.Height = 5
+	types.SignBlock(key, block)
+
+	assert.Nil(t, pool.Observe(block))
+	assert.Nil(t, pool.Observe(block))
+
+	// another height is no equivocation
+	next := pb.Clone(block).(*proto.Block)
+	next.Header.Height++
+	types.SignBlock(key, next)
+	assert.Nil(t, pool.Observe(next))
+
+	conflicting := pb.Clone(block).(*proto.Block)
+	conflicting.Header.Timestamp++
+	types.SignBlock(key, conflicting)
+
+	evidence := pool.Observe(conflicting)
+	require.NotNil(t, evidence)
+	assert.True(t, types.VerifyEvidence(evidence))
+	assert.Equal(t, 1, pool.Len())
+
+	// seeing it again, or hearing of it, adds nothing
+	assert.Nil(t, pool.Observe(conflicting))
+	assert.False(t, pool.Add(types.NewEvidence(conflicting, block)))
+
+	pool.Remove(evidence)
+	assert.Equal(t, 0, pool.Len())
+
+	// pruned heights are forgotten
+	pool.Prune(6)
+	assert.Nil(t, pool.Observe(block))
+}
+
+func TestEvidencePoolIsBounded(t *testing.T) {
+	var (
+		pool = NewEvidencePool()
+		key  = encrypted.GeneratePrivateKey()
+	)
+	for i := 0; i <= maxPendingEvidence; i++ {
+		a, b := util.RandomBlock(), util.RandomBlock()
+		types.SignBlock(key, a)
+		types.SignBlock(key, b)
+		assert.Equal(t, i < maxPendingEvidence, pool.Add(types.NewEvidence(a, b)))
+	}
+	assert.Equal(t, maxPendingEvidence, pool.Len())
+}
+
+func TestHandleEvidenceNeedsValidator(t *testing.T) {
+	var (
+		validator = encrypted.GeneratePrivateKey()
+		stranger  = encrypted.GeneratePrivateKey()
+		n         = NewNode(ServerConfig{
+			ListenAddr: "127.0.0.1:0",
+			PrivateKey: validator,
+			Genesis: Genesis{
+				Validators: []*encrypted.PublicKey{validator.Public()},
+				Engine:     EnginePoS,
+			},
+		})
+	)
+	require.Nil(t, n.chain.AddBlock(stakeBlock(t, n.chain, []*encrypted.PrivateKey{validator}, nil)))
+
+	equivocation := func(key *encrypted.PrivateKey) *proto.Evidence {
+		a, b := util.RandomBlock(), util.RandomBlock()
+		a.Header.Height, b.Header.Height = 1, 1
+		types.SignBlock(key, a)
+		types.SignBlock(key, b)
+
+		return types.NewEvidence(a, b)
+	}
+
+	// well signed, but there is no stake to slash
+	_, err := n.HandleEvidence(context.Background(), equivocation(stranger))
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, n.evidence.Len())
+
+	_, err = n.HandleEvidence(context.Background(), equivocation(validator))
+	require.Nil(t, err)
+	assert.Equal(t, 1, n.evidence.Len())
+}
+
+func TestObserveOnlyRecordsValidatorsNearTheTip(t *testing.T) {
+	var (
+		validator = encrypted.GeneratePrivateKey()
+		stranger  = encrypted.GeneratePrivateKey()
+		n         = NewNode(ServerConfig{
+			ListenAddr: "127.0.0.1:0",
+			PrivateKey: validator,
+			Genesis: Genesis{
+				Validators: []*encrypted.PublicKey{validator.Public()},
+				Engine:     EnginePoS,
+			},
+		})
+	)
+	require.Nil(t, n.chain.AddBlock(stakeBlock(t, n.chain, []*encrypted.PrivateKey{validator}, nil)))
+
+	signed := func(key *encrypted.PrivateKey, height int32) *proto.Block {
+		block := util.RandomBlock()
+		block.Header.Height = height
+		types.SignBlock(key, block)
+
+		return block
+	}
+
+	n.observe(signed(validator, 1))
+	require.Len(t, n.evidence.signed, 1)
+
+	// headers of anybody else, or far from the tip, are not kept
+	n.observe(signed(stranger, 2))
+	n.observe(signed(validator, 3))
+	assert.Len(t, n.evidence.signed, 1)
+
+	// nor do they prune the headers that are
+	n.observe(signed(validator, math.MaxInt32))
+	assert.Len(t, n.evidence.signed, 1)
+
+	n.observe(signed(validator, 2))
+	assert.Len(t, n.evidence.signed, 2)
+}
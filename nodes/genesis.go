@@ -0,0 +1,214 @@
+package nodes
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/consensus"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+// defaultProposerTimeout leaves an absent proposer a few block times before
+// the next validator takes over.
+const defaultProposerTimeout = 3 * blockTime
+
+// defaultGenesisStake is bonded to every genesis validator of EnginePoS.
+const defaultGenesisStake = 100
+
+// Consensus engines a genesis can select.
+const (
+	// EnginePoA rotates block production over the validators.
+	EnginePoA = "poa"
+	// EngineBFT finalizes every block by a vote of the validators.
+	EngineBFT = "bft"
+	// EnginePoW lets anybody mine blocks; it needs no validators.
+	EnginePoW = "pow"
+	// EnginePoS draws proposers by bonded stake; the validators only make
+	// up the set of the first epoch.
+	EnginePoS = "pos"
+)
+
+// Genesis holds the parameters every node of a network has to agree on. It
+// is usually loaded from a genesis file, see LoadGenesis.
+type Genesis struct {
+	// ChainID names the network.
+	ChainID string `json:"chainId"`
+	// Time is the timestamp of the genesis block.
+	Time time.Time `json:"genesisTime"`
+	// Allocations are the coins the genesis block pays out, by hex address.
+	Allocations map[string]int64 `json:"allocations,omitempty"`
+	// Validators are the keys allowed to propose blocks, in proposer order.
+	// When empty the node's own key is the only authority.
+	Validators []*encrypted.PublicKey `json:"validators,omitempty"`
+	// Engine selects how nodes agree on blocks; defaults to EnginePoA.
+	Engine string `json:"engine,omitempty"`
+	// ProposerTimeout is how long after a block the next validator waits
+	// for an absent proposer before producing the block itself. It must be
+	// at least twice consensus.MaxFutureDrift.
+	ProposerTimeout time.Duration `json:"proposerTimeout"`
+	// Pow holds the mining rules of EnginePoW.
+	Pow consensus.PowParams `json:"pow"`
+	// Pos holds the staking rules of EnginePoS.
+	Pos consensus.PosParams `json:"pos"`
+	// Stake is bonded to every validator in the genesis block of EnginePoS.
+	Stake int64 `json:"stake"`
+	// Upgrades schedules the heights at which new consensus rules activate.
+	Upgrades UpgradeSchedule `json:"upgrades,omitempty"`
+}
+
+// LoadGenesis reads a genesis file.
+func LoadGenesis(path string) (Genesis, error) {
+	var g Genesis
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return g, err
+	}
+	if err := json.Unmarshal(b, &g); err != nil {
+		return g, fmt.Errorf("parsing genesis file %s: %w", path, err)
+	}
+	if _, err := g.Block(); err != nil {
+		return g, fmt.Errorf("invalid genesis file %s: %w", path, err)
+	}
+
+	return g, nil
+}
+
+// Save writes the genesis file.
+func (g Genesis) Save(path string) error {
+	b, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// WithDefaults fills in the consensus parameters left unset.
+func (g Genesis) WithDefaults() Genesis {
+	if g.ProposerTimeout == 0 {
+		g.ProposerTimeout = defaultProposerTimeout
+	}
+	if g.Pow == (consensus.PowParams{}) {
+		g.Pow = consensus.DefaultPowParams
+	}
+	if g.Pos == (consensus.PosParams{}) {
+		g.Pos = consensus.DefaultPosParams
+	}
+	if g.Stake == 0 {
+		g.Stake = defaultGenesisStake
+	}
+
+	return g
+}
+
+// Block builds the genesis block. Its single transaction pays out the
+// allocations in address order and, under EnginePoS, bonds Stake to every
+// validator. The block is not signed; every node builds it itself.
+func (g Genesis) Block() (*proto.Block, error) {
+	if err := g.checkEngine(); err != nil {
+		return nil, err
+	}
+	if err := g.Upgrades.Validate(); err != nil {
+		return nil, err
+	}
+
+	var timestamp int64
+	if !g.Time.IsZero() {
+		timestamp = g.Time.UnixNano()
+	}
+
+	block := &proto.Block{
+		Header: &proto.Header{
+			Version:   RulesGenesis,
+			Timestamp: timestamp,
+			ChainId:   g.ChainID,
+		},
+	}
+
+	addresses := make([]string, 0, len(g.Allocations))
+	for address := range g.Allocations {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	tx := &proto.Transaction{Version: RulesGenesis, ChainId: g.ChainID}
+	for _, address := range addresses {
+		b, err := hex.DecodeString(address)
+		if err != nil || len(b) != encrypted.AddressLen {
+			return nil, fmt.Errorf("invalid allocation address %q", address)
+		}
+		if g.Allocations[address] <= 0 {
+			return nil, fmt.Errorf("allocation to %s is not positive", address)
+		}
+		tx.Outputs = append(tx.Outputs, &proto.TxOutput{
+			Amount:  g.Allocations[address],
+			Address: b,
+		})
+	}
+	if g.Engine == EnginePoS {
+		for _, validator := range g.Validators {
+			tx.Outputs = append(tx.Outputs, types.StakeOutput(g.Stake, validator.Address(), validator))
+		}
+	}
+
+	if len(tx.Outputs) > 0 {
+		block.Transactions = append(block.Transactions, tx)
+		tree, err := types.GetMerkleTree(block)
+		if err != nil {
+			return nil, err
+		}
+		block.Header.RootHash = tree.MerkleRoot()
+	}
+
+	return block, nil
+}
+
+// checkEngine checks that the genesis selects a known engine and, for the
+// engines that need them, validators.
+func (g Genesis) checkEngine() error {
+	if g.ProposerTimeout != 0 && g.ProposerTimeout < 2*consensus.MaxFutureDrift {
+		return fmt.Errorf("proposer timeout %s below twice the allowed clock drift %s", g.ProposerTimeout, consensus.MaxFutureDrift)
+	}
+
+	switch g.Engine {
+	case "", EnginePoA, EnginePoW:
+	case EnginePoS, EngineBFT:
+		if len(g.Validators) == 0 {
+			return fmt.Errorf("consensus engine %q without validators", g.Engine)
+		}
+	default:
+		return fmt.Errorf("unknown consensus engine %q", g.Engine)
+	}
+
+	return nil
+}
+
+// engine returns the consensus engine the genesis selects, which
+// checkEngine accepted. Without validators, the node's own key is the
+// single authority.
+func (g Genesis) engine(key *encrypted.PrivateKey) consensus.Engine {
+	switch {
+	case g.Engine == EnginePoW:
+		return consensus.NewProofOfWork(g.Pow)
+	case g.Engine == EnginePoS:
+		return consensus.NewProofOfStake(g.Pos, g.ProposerTimeout)
+	case g.Engine == EngineBFT:
+		return consensus.NewBFT(g.Validators)
+	case len(g.Validators) > 0:
+		return consensus.NewProofOfAuthority(g.Validators, g.ProposerTimeout)
+	}
+
+	var authority *encrypted.PublicKey
+	if key != nil {
+		authority = key.Public()
+	}
+
+	return consensus.NewSingleAuthority(authority)
+}
@@ -0,0 +1,111 @@
+package nodes
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/consensus"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+func TestGenesisFile(t *testing.T) {
+	var (
+		path    = filepath.Join(t.TempDir(), "genesis.json")
+		genesis = Genesis{
+			ChainID: "testnet",
+			Time:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			Allocations: map[string]int64{
+				encrypted.GeneratePrivateKey().Public().Address().String(): 500,
+				encrypted.GeneratePrivateKey().Public().Address().String(): 700,
+			},
+			Validators: []*encrypted.PublicKey{encrypted.GeneratePrivateKey().Public()},
+			Engine:     EnginePoS,
+		}.WithDefaults()
+	)
+	require.Nil(t, genesis.Save(path))
+
+	loaded, err := LoadGenesis(path)
+	require.Nil(t, err)
+	assert.Equal(t, genesis.ChainID, loaded.ChainID)
+	assert.Equal(t, genesis.Pos, loaded.Pos)
+	assert.Equal(t, genesis.Validators[0].Bytes(), loaded.Validators[0].Bytes())
+
+	block, err := genesis.Block()
+	require.Nil(t, err)
+	loadedBlock, err := loaded.Block()
+	require.Nil(t, err)
+	assert.Equal(t, types.HashBlock(block), types.HashBlock(loadedBlock))
+
+	// two allocations and the stake of the validator
+	require.Len(t, block.Transactions, 1)
+	assert.Len(t, block.Transactions[0].Outputs, 3)
+	assert.Equal(t, genesis.Time.UnixNano(), block.Header.Timestamp)
+}
+
+func TestGenesisRejectsInvalidAllocation(t *testing.T) {
+	_, err := Genesis{Allocations: map[string]int64{"abcd": 100}}.Block()
+	assert.NotNil(t, err)
+
+	address := encrypted.GeneratePrivateKey().Public().Address().String()
+	_, err = Genesis{Allocations: map[string]int64{address: -1}}.Block()
+	assert.NotNil(t, err)
+
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	require.Nil(t, Genesis{Allocations: map[string]int64{"abcd": 100}}.Save(path))
+	_, err = LoadGenesis(path)
+	assert.NotNil(t, err)
+}
+
+func TestGenesisRejectsInvalidEngine(t *testing.T) {
+	validators := []*encrypted.PublicKey{encrypted.GeneratePrivateKey().Public()}
+
+	_, err := Genesis{Engine: "pbft", Validators: validators}.Block()
+	assert.NotNil(t, err)
+	for _, engine := range []string{EnginePoS, EngineBFT} {
+		_, err = Genesis{Engine: engine}.Block()
+		assert.NotNil(t, err, engine)
+
+		_, err = Genesis{Engine: engine, Validators: validators}.Block()
+		assert.Nil(t, err, engine)
+	}
+
+	// a timeout within the clock drift would let a proposer skip turns
+	_, err = Genesis{ProposerTimeout: consensus.MaxFutureDrift}.Block()
+	assert.NotNil(t, err)
+	_, err = Genesis{ProposerTimeout: 2 * consensus.MaxFutureDrift}.Block()
+	assert.Nil(t, err)
+
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	require.Nil(t, Genesis{Engine: "pbft"}.Save(path))
+	_, err = LoadGenesis(path)
+	assert.NotNil(t, err)
+}
+
+func TestHandshakeRejectsOtherGenesis(t *testing.T) {
+	n := NewNode(ServerConfig{ListenAddr: "127.0.0.1:0"})
+	other := NewNode(ServerConfig{ListenAddr: "127.0.0.1:0", Genesis: Genesis{Time: time.Unix(1, 0)}})
+	require.NotEqual(t, n.genesisHash, other.genesisHash)
+
+	_, err := n.Handshake(context.Background(), &proto.Version{ListenAddr: "127.0.0.1:1", GenesisHash: other.genesisHash})
+	assert.NotNil(t, err)
+	assert.Empty(t, n.Peers())
+}
+
+func TestRejectsOtherChainID(t *testing.T) {
+	n := NewNode(ServerConfig{ListenAddr: "127.0.0.1:0", Genesis: Genesis{ChainID: "mainnet"}})
+
+	_, err := n.Handshake(context.Background(), &proto.Version{ListenAddr: "127.0.0.1:1", ChainId: "testnet", GenesisHash: n.genesisHash})
+	assert.True(t, errors.IsOf(err, errors.ErrInvalidChainID))
+	assert.Empty(t, n.Peers())
+
+	_, err = n.HandleTransaction(context.Background(), &proto.Transaction{Version: 1, ChainId: "testnet"})
+	assert.True(t, errors.IsOf(err, errors.ErrInvalidChainID))
+	assert.Equal(t, 0, n.mempool.Len())
+}
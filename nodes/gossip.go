@@ -0,0 +1,410 @@
+package nodes
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+	pb "google.golang.org/protobuf/proto"
+)
+
+const (
+	// seenTTL is how long a node remembers an inventory item after it first
+	// saw it, so transactions cleared from the mempool do not bounce back.
+	seenTTL = 10 * time.Minute
+	// requestTTL is how long an outstanding getdata suppresses requesting the
+	// same item from another peer.
+	requestTTL = 5 * time.Second
+)
+
+// SeenCache is a set of hashes whose entries expire after a fixed TTL.
+type SeenCache struct {
+	lock      sync.Mutex
+	ttl       time.Duration
+	items     map[string]time.Time
+	lastPrune time.Time
+}
+
+func NewSeenCache(ttl time.Duration) *SeenCache {
+	return &SeenCache{
+		ttl:       ttl,
+		items:     make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+// Add marks the hash as seen and reports whether it was not seen before.
+func (s *SeenCache) Add(hash string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+
+	if expires, ok := s.items[hash]; ok && now.Before(expires) {
+		return false
+	}
+	s.items[hash] = now.Add(s.ttl)
+
+	return true
+}
+
+func (s *SeenCache) Has(hash string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	expires, ok := s.items[hash]
+
+	return ok && time.Now().Before(expires)
+}
+
+func (s *SeenCache) Remove(hash string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.items, hash)
+}
+
+func (s *SeenCache) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.prune(time.Now())
+
+	return len(s.items)
+}
+
+func (s *SeenCache) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < s.ttl {
+		return
+	}
+
+	for hash, expires := range s.items {
+		if !now.Before(expires) {
+			delete(s.items, hash)
+		}
+	}
+	s.lastPrune = now
+}
+
+// GossipStats counts the bytes a node has sent to its peers while relaying.
+type GossipStats struct {
+	InvBytes  int64
+	DataBytes int64
+}
+
+func (s GossipStats) Total() int64 {
+	return s.InvBytes + s.DataBytes
+}
+
+type gossipCounters struct {
+	invBytes  atomic.Int64
+	dataBytes atomic.Int64
+}
+
+func (n *Node) GossipStats() GossipStats {
+	return GossipStats{
+		InvBytes:  n.stats.invBytes.Load(),
+		DataBytes: n.stats.dataBytes.Load(),
+	}
+}
+
+const (
+	// maxAncestorFetch bounds how many missing ancestors of an announced
+	// block we fetch from a single peer.
+	maxAncestorFetch = 1000
+	// fetchWorkers fetch the announced items we want, from a queue of at
+	// most maxQueuedFetches announcements.
+	fetchWorkers     = 4
+	maxQueuedFetches = 256
+)
+
+// fetch is an announcement whose items we still have to get from its peer.
+type fetch struct {
+	peer *peer
+	want *proto.Inventory
+}
+
+// HandleInventory queues the announced items we do not have yet for the
+// fetch workers, so a slow or hostile peer cannot hold the RPC open. The
+// peer is told by the host it calls from, not by the address it claims.
+func (n *Node) HandleInventory(ctx context.Context, inv *proto.Inventory) (*proto.Ack, error) {
+	p := n.getPeer(remoteAddr(ctx, inv.From))
+	if p == nil {
+		n.logger.Debugw("Inventory from unknown peer", "from", inv.From, "we", n.ListenAddr)
+		return &proto.Ack{}, nil
+	}
+
+	want := &proto.Inventory{From: n.advertisedAddr()}
+	for _, item := range inv.Items {
+		hash := hex.EncodeToString(item.Hash)
+		p.known.Add(hash)
+
+		switch item.Type {
+		case proto.InvType_INV_TX:
+			if n.seen.Has(hash) {
+				continue
+			}
+		case proto.InvType_INV_BLOCK:
+			if n.chain.HasBlock(item.Hash) {
+				continue
+			}
+		default:
+			continue
+		}
+		if !n.requested.Add(hash) {
+			continue
+		}
+		want.Items = append(want.Items, item)
+	}
+
+	if len(want.Items) == 0 {
+		return &proto.Ack{}, nil
+	}
+
+	select {
+	case n.fetches <- fetch{peer: p, want: want}:
+	default:
+		n.logger.Debugw("Dropped inventory", "remoteNode", p.version.ListenAddr, "lenItems", len(want.Items))
+		n.unrequest(want.Items)
+	}
+
+	return &proto.Ack{}, nil
+}
+
+// fetchLoop gets the items queued by HandleInventory until the node stops.
+func (n *Node) fetchLoop() {
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case f := <-n.fetches:
+			n.fetch(f.peer, f.want)
+		}
+	}
+}
+
+// fetch gets the items of want from p and processes them. Items p did not
+// send can be requested from other peers again right away.
+func (n *Node) fetch(p *peer, want *proto.Inventory) {
+	data, err := n.getData(n.ctx, p, want)
+	if err != nil {
+		n.logger.Debugw("Fetching inventory failed", "remoteNode", p.version.ListenAddr, "error", err)
+		n.unrequest(want.Items)
+		return
+	}
+
+	received := make(map[string]bool, len(data.Transactions)+len(data.Blocks))
+	for _, tx := range data.Transactions {
+		received[hex.EncodeToString(types.HashTransaction(tx))] = true
+		if err := n.processTransaction(tx, p); err != nil {
+			n.logger.Debugw("Rejected transaction", "remoteNode", p.version.ListenAddr, "error", err)
+		}
+	}
+	for _, block := range data.Blocks {
+		if block.Header == nil {
+			continue
+		}
+		received[hex.EncodeToString(types.HashBlock(block))] = true
+		n.processBlock(n.ctx, block, p)
+	}
+
+	var missing []*proto.InvItem
+	for _, item := range want.Items {
+		if !received[hex.EncodeToString(item.Hash)] {
+			missing = append(missing, item)
+		}
+	}
+	n.unrequest(missing)
+}
+
+// unrequest forgets that we asked for items.
+func (n *Node) unrequest(items []*proto.InvItem) {
+	for _, item := range items {
+		n.requested.Remove(hex.EncodeToString(item.Hash))
+	}
+}
+
+func (n *Node) GetData(ctx context.Context, inv *proto.Inventory) (*proto.Data, error) {
+	data := &proto.Data{}
+	for _, item := range inv.Items {
+		switch item.Type {
+		case proto.InvType_INV_TX:
+			if tx, ok := n.mempool.Get(hex.EncodeToString(item.Hash)); ok {
+				data.Transactions = append(data.Transactions, tx)
+			}
+		case proto.InvType_INV_BLOCK:
+			if block, err := n.chain.GetBlockByHash(item.Hash); err == nil {
+				data.Blocks = append(data.Blocks, block)
+			}
+		}
+	}
+
+	n.stats.dataBytes.Add(int64(pb.Size(data)))
+
+	return data, nil
+}
+
+func (n *Node) getData(ctx context.Context, p *peer, inv *proto.Inventory) (*proto.Data, error) {
+	n.stats.invBytes.Add(int64(pb.Size(inv)))
+
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+
+	return p.client.GetData(ctx, inv)
+}
+
+// processTransaction adds a transaction we have not seen yet to the mempool
+// and announces it to every peer not known to have it. from is nil when the
+// transaction was pushed to us directly. Transactions of other chains or
+// with invalid signatures are rejected.
+func (n *Node) processTransaction(tx *proto.Transaction, from *peer) error {
+	if tx.ChainId != n.chain.ChainID() {
+		return errors.Wrapf(errors.ErrInvalidChainID, "transaction for chain %q instead of %q", tx.ChainId, n.chain.ChainID())
+	}
+
+	hash := types.HashTransaction(tx)
+	hashHex := hex.EncodeToString(hash)
+	n.requested.Remove(hashHex)
+
+	// Look the transaction up before checking its signatures, so a peer
+	// cannot make us verify the same transaction over and over. The hash
+	// does not cover the signatures, so only mark it seen once they check
+	// out, otherwise a bad copy would keep the valid one out.
+	if n.seen.Has(hashHex) || n.mempool.Has(tx) {
+		return nil
+	}
+	if err := n.chain.CheckSignatures(tx); err != nil {
+		return err
+	}
+	if !n.seen.Add(hashHex) {
+		return nil
+	}
+	if !n.mempool.Add(tx) {
+		return nil
+	}
+
+	n.logger.Debugw("Received transaction", "hash", hashHex, "we", n.ListenAddr)
+
+	n.relay(&proto.InvItem{Type: proto.InvType_INV_TX, Hash: hash}, from)
+
+	return nil
+}
+
+// processBlock adds a block received from a peer to the chain, first
+// fetching any ancestors we are missing from the same peer.
+func (n *Node) processBlock(ctx context.Context, block *proto.Block, from *peer) {
+	if block.Header == nil {
+		return
+	}
+	n.requested.Remove(hex.EncodeToString(types.HashBlock(block)))
+
+	blocks := []*proto.Block{block}
+	for !n.chain.HasBlock(blocks[0].Header.PrevHash) {
+		if len(blocks) > maxAncestorFetch {
+			n.logger.Errorw("Too many missing ancestors", "remoteNode", from.version.ListenAddr)
+			return
+		}
+
+		inv := &proto.Inventory{
+			From:  n.advertisedAddr(),
+			Items: []*proto.InvItem{{Type: proto.InvType_INV_BLOCK, Hash: blocks[0].Header.PrevHash}},
+		}
+		data, err := n.getData(ctx, from, inv)
+		if err != nil || len(data.Blocks) != 1 || data.Blocks[0].Header == nil {
+			n.logger.Debugw("Fetching ancestor failed", "remoteNode", from.version.ListenAddr, "error", err)
+			return
+		}
+		if !bytes.Equal(types.HashBlock(data.Blocks[0]), blocks[0].Header.PrevHash) {
+			n.logger.Debugw("Peer sent the wrong ancestor", "remoteNode", from.version.ListenAddr, "height", blocks[0].Header.Height-1)
+			return
+		}
+		blocks = append([]*proto.Block{data.Blocks[0]}, blocks...)
+	}
+
+	for _, b := range blocks {
+		if n.chain.HasBlock(types.HashBlock(b)) {
+			continue
+		}
+		n.observe(b)
+		if err := n.addBlock(b); err != nil {
+			n.logger.Debugw("Rejected block", "height", b.Header.Height, "error", err)
+			return
+		}
+
+		n.logger.Debugw("Received block", "height", b.Header.Height, "we", n.ListenAddr)
+		n.relayBlock(b, from)
+	}
+
+	if n.consensusMsgs != nil {
+		select {
+		case n.consensusMsgs <- heightEvent{}:
+		default:
+		}
+	}
+}
+
+// relayBlock drops the block's transactions from the mempool and announces
+// the block to our peers.
+func (n *Node) relayBlock(block *proto.Block, from *peer) {
+	n.observe(block)
+	for _, tx := range block.Transactions {
+		hash := hex.EncodeToString(types.HashTransaction(tx))
+		n.seen.Add(hash)
+		n.mempool.Remove(hash)
+	}
+
+	hash := types.HashBlock(block)
+	n.seen.Add(hex.EncodeToString(hash))
+	n.relay(&proto.InvItem{Type: proto.InvType_INV_BLOCK, Hash: hash}, from)
+}
+
+// reorganized returns the transactions of the blocks a reorganisation took
+// off the best branch to the mempool, except those the new branch includes.
+// Transactions the new branch spent the inputs of are dropped once a block
+// is created.
+func (n *Node) reorganized(disconnected, connected []*proto.Block) {
+	for _, block := range disconnected {
+		for _, tx := range block.Transactions {
+			n.mempool.Add(tx)
+		}
+	}
+	for _, block := range connected {
+		for _, tx := range block.Transactions {
+			n.mempool.Remove(hex.EncodeToString(types.HashTransaction(tx)))
+		}
+	}
+}
+
+// relay announces item to every peer except from that is not known to
+// have it yet.
+func (n *Node) relay(item *proto.InvItem, from *peer) {
+	hash := hex.EncodeToString(item.Hash)
+	for _, p := range n.getPeers() {
+		if p == from || !p.known.Add(hash) {
+			continue
+		}
+		n.spawn(func() { n.announce(p, item) })
+	}
+}
+
+func (n *Node) announce(p *peer, items ...*proto.InvItem) {
+	inv := &proto.Inventory{
+		From:  n.advertisedAddr(),
+		Items: items,
+	}
+	n.stats.invBytes.Add(int64(pb.Size(inv)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	if _, err := p.client.HandleInventory(ctx, inv); err != nil {
+		n.logger.Debugw("Announce error", "remoteNode", p.version.ListenAddr, "error", err)
+	}
+}
@@ -0,0 +1,267 @@
+package nodes
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/util"
+	"google.golang.org/grpc"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+func startNode(t *testing.T, bootstrapNodes []string) (*Node, string) {
+	addr := freeAddr(t)
+	n := NewNode(ServerConfig{
+		Version:        "0.0.1",
+		ListenAddr:     addr,
+		BootstrapNodes: bootstrapNodes,
+	})
+	go n.Start(context.Background())
+	t.Cleanup(n.Stop)
+
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return n, addr
+}
+
+func randomTransaction() *proto.Transaction {
+	privKey := encrypted.GeneratePrivateKey()
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{
+			{
+				PrevTxHash: util.RandomHash(),
+				PublicKey:  privKey.Public().Bytes(),
+			},
+		},
+		Outputs: []*proto.TxOutput{
+			{
+				Amount:  99,
+				Address: privKey.Public().Address().Bytes(),
+			},
+		},
+	}
+	signTx(privKey, tx)
+
+	return tx
+}
+
+func TestSeenCache(t *testing.T) {
+	cache := NewSeenCache(50 * time.Millisecond)
+
+	assert.True(t, cache.Add("a"))
+	assert.False(t, cache.Add("a"))
+	assert.True(t, cache.Has("a"))
+
+	time.Sleep(60 * time.Millisecond)
+
+	assert.False(t, cache.Has("a"))
+	assert.True(t, cache.Add("a"))
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestGossipDoesNotRelaySeenTransaction(t *testing.T) {
+	n := NewNode(ServerConfig{})
+	tx := randomTransaction()
+
+	n.processTransaction(tx, nil)
+	require.Equal(t, 1, n.mempool.Len())
+
+	n.mempool.Clear()
+	n.processTransaction(tx, nil)
+	assert.Equal(t, 0, n.mempool.Len())
+}
+
+func TestInventoryGossipSavesBandwidth(t *testing.T) {
+	const (
+		nNodes = 4
+		nTxx   = 20
+	)
+
+	var (
+		nodes []*Node
+		addrs []string
+	)
+	for i := 0; i < nNodes; i++ {
+		n, addr := startNode(t, append([]string{}, addrs...))
+		nodes = append(nodes, n)
+		addrs = append(addrs, addr)
+	}
+
+	require.Eventually(t, func() bool {
+		for _, n := range nodes {
+			if len(n.getPeerList()) != nNodes-1 {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	client, conn, err := makeNodeClient(addrs[0])
+	require.Nil(t, err)
+	defer conn.Close()
+
+	var txBytes int64
+	for i := 0; i < nTxx; i++ {
+		tx := randomTransaction()
+		txBytes += int64(pb.Size(tx))
+
+		_, err := client.HandleTransaction(context.Background(), tx)
+		require.Nil(t, err)
+	}
+
+	require.Eventually(t, func() bool {
+		for _, n := range nodes {
+			if n.mempool.Len() != nTxx {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var sent int64
+	for _, n := range nodes {
+		sent += n.GossipStats().Total()
+	}
+
+	// flooding pushes every transaction from every node to all of its peers
+	flooded := int64(nNodes*(nNodes-1)) * txBytes
+	t.Logf("flooding: %d bytes, inventory gossip: %d bytes (%.1f%% saved)",
+		flooded, sent, 100*(1-float64(sent)/float64(flooded)))
+
+	assert.Less(t, sent, flooded)
+}
+
+func TestStrippedBlockIsRejected(t *testing.T) {
+	n := NewNode(ServerConfig{
+		ListenAddr: "127.0.0.1:0",
+		PrivateKey: authorityKey,
+		Genesis:    Genesis{Allocations: map[string]int64{premineKey.Public().Address().String(): 1000}},
+	})
+	genesis := mustBlock(t, n.chain, 0)
+
+	tx := signTx(premineKey, &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{{PrevTxHash: types.HashTransaction(genesis.Transactions[0]), PublicKey: premineKey.Public().Bytes()}},
+		Outputs: []*proto.TxOutput{{Amount: 1000, Address: premineKey.Public().Address().Bytes()}},
+	})
+	block := versionBlock(t, n.chain, RulesGenesis, genesis.Header.Timestamp+1, tx)
+
+	// a relayer dropping the transactions keeps the block hash
+	stripped := pb.Clone(block).(*proto.Block)
+	stripped.Transactions = nil
+	require.Equal(t, types.HashBlock(block), types.HashBlock(stripped))
+
+	n.processBlock(context.Background(), stripped, nil)
+	assert.Equal(t, 0, n.chain.Height())
+
+	n.processBlock(context.Background(), block, nil)
+	assert.Equal(t, 1, n.chain.Height())
+}
+
+// dataClient answers GetData with data and counts the calls.
+type dataClient struct {
+	proto.NodeClient
+	data  func() *proto.Data
+	calls int
+}
+
+func (c *dataClient) GetData(ctx context.Context, inv *proto.Inventory, opts ...grpc.CallOption) (*proto.Data, error) {
+	c.calls++
+	return c.data(), nil
+}
+
+func TestHandleInventoryIdentifiesPeerByConnection(t *testing.T) {
+	var (
+		n  = NewNode(ServerConfig{ListenAddr: "127.0.0.1:0"})
+		p  = &peer{version: &proto.Version{ListenAddr: "10.0.0.1:3000"}, known: NewSeenCache(seenTTL)}
+		tx = randomTransaction()
+	)
+	n.addPeer(p)
+
+	inv := &proto.Inventory{
+		From:  "10.0.0.1:3000",
+		Items: []*proto.InvItem{{Type: proto.InvType_INV_TX, Hash: types.HashTransaction(tx)}},
+	}
+
+	// another host claiming to be the peer is ignored
+	_, err := n.HandleInventory(peerContext("10.0.0.2:4000"), inv)
+	require.Nil(t, err)
+	assert.Empty(t, n.fetches)
+	assert.Equal(t, 0, n.requested.Len())
+
+	_, err = n.HandleInventory(peerContext("10.0.0.1:4000"), inv)
+	require.Nil(t, err)
+	assert.Len(t, n.fetches, 1)
+	assert.Equal(t, 1, n.requested.Len())
+}
+
+func TestFetchForgetsMissingItems(t *testing.T) {
+	var (
+		n      = NewNode(ServerConfig{ListenAddr: "127.0.0.1:0"})
+		client = &dataClient{data: func() *proto.Data { return &proto.Data{} }}
+		p      = &peer{client: client, version: &proto.Version{ListenAddr: "10.0.0.1:3000"}, known: NewSeenCache(seenTTL)}
+		want   = &proto.Inventory{Items: []*proto.InvItem{
+			{Type: proto.InvType_INV_TX, Hash: util.RandomHash()},
+			{Type: proto.InvType_INV_BLOCK, Hash: util.RandomHash()},
+		}}
+	)
+	for _, item := range want.Items {
+		require.True(t, n.requested.Add(hex.EncodeToString(item.Hash)))
+	}
+
+	n.fetch(p, want)
+	assert.Equal(t, 1, client.calls)
+	assert.Equal(t, 0, n.requested.Len())
+}
+
+func TestProcessBlockChecksAncestorHash(t *testing.T) {
+	var (
+		n      = NewNode(ServerConfig{ListenAddr: "127.0.0.1:0"})
+		client = &dataClient{data: func() *proto.Data { return &proto.Data{Blocks: []*proto.Block{util.RandomBlock()}} }}
+		p      = &peer{client: client, version: &proto.Version{ListenAddr: "10.0.0.1:3000"}, known: NewSeenCache(seenTTL)}
+	)
+
+	// the peer answers every ancestor request with some other block
+	n.processBlock(context.Background(), util.RandomBlock(), p)
+	assert.Equal(t, 1, client.calls)
+	assert.Equal(t, 0, n.chain.Height())
+}
+
+func TestReorganizedReturnsTransactionsToMempool(t *testing.T) {
+	var (
+		n        = NewNode(ServerConfig{ListenAddr: "127.0.0.1:0"})
+		dropped  = randomTransaction()
+		included = randomTransaction()
+	)
+
+	n.reorganized(
+		[]*proto.Block{{Transactions: []*proto.Transaction{dropped, included}}},
+		[]*proto.Block{{Transactions: []*proto.Transaction{included}}},
+	)
+	assert.True(t, n.mempool.Has(dropped))
+	assert.False(t, n.mempool.Has(included))
+}
@@ -0,0 +1,132 @@
+package nodes
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/consensus"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+// swapChain is a chain under RulesHTLC whose genesis pays 1000 to owner.
+type swapChain struct {
+	*Chain
+	premine *proto.Transaction
+}
+
+func newSwapChain(t *testing.T, chainID string, owner *encrypted.PrivateKey) *swapChain {
+	genesis := Genesis{
+		ChainID:     chainID,
+		Allocations: map[string]int64{owner.Public().Address().String(): 1000},
+		Upgrades:    UpgradeSchedule{{Name: "htlc", Height: 1, Version: RulesHTLC}},
+	}
+	block, err := genesis.Block()
+	require.Nil(t, err)
+
+	chain := NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), consensus.NewSingleAuthority(authorityKey.Public()), block, genesis.Upgrades)
+	return &swapChain{Chain: chain, premine: block.Transactions[0]}
+}
+
+// mine adds a block of txx.
+func (c *swapChain) mine(t *testing.T, txx ...*proto.Transaction) {
+	require.Nil(t, c.AddBlock(versionBlock(t, c.Chain, RulesHTLC, int64(c.Height()+1), txx...)))
+}
+
+// spend returns a transaction of c moving input to a plain output of to,
+// signed by key.
+func (c *swapChain) spend(key *encrypted.PrivateKey, input *proto.TxInput, output *proto.TxOutput) *proto.Transaction {
+	return signTx(key, &proto.Transaction{
+		Version: RulesHTLC,
+		Inputs:  []*proto.TxInput{input},
+		Outputs: []*proto.TxOutput{output},
+		ChainId: c.ChainID(),
+	})
+}
+
+func TestAtomicSwap(t *testing.T) {
+	var (
+		alice    = encrypted.GeneratePrivateKey()
+		bob      = encrypted.GeneratePrivateKey()
+		alpha    = newSwapChain(t, "alpha", alice)
+		beta     = newSwapChain(t, "beta", bob)
+		preimage = make([]byte, types.HTLCPreimageLen)
+	)
+	_, err := rand.Read(preimage)
+	require.Nil(t, err)
+	hashLock := types.HashLock(preimage)
+
+	// alice locks her coins on alpha to bob, refundable to her from height
+	// 10; bob locks his on beta to alice with the same hash, timing out
+	// first so alice has to claim before she could be refunded
+	lockA := alpha.spend(alice,
+		&proto.TxInput{PrevTxHash: types.HashTransaction(alpha.premine), PublicKey: alice.Public().Bytes()},
+		types.HTLCOutput(1000, hashLock, bob.Public().Address(), alice.Public().Address(), 10))
+	alpha.mine(t, lockA)
+	lockB := beta.spend(bob,
+		&proto.TxInput{PrevTxHash: types.HashTransaction(beta.premine), PublicKey: bob.Public().Bytes()},
+		types.HTLCOutput(1000, hashLock, alice.Public().Address(), bob.Public().Address(), 5))
+	beta.mine(t, lockB)
+
+	toBob := &proto.TxOutput{Amount: 1000, Address: bob.Public().Address().Bytes()}
+	toAlice := &proto.TxOutput{Amount: 1000, Address: alice.Public().Address().Bytes()}
+
+	// bob can neither claim without the preimage nor be refunded early
+	wrong := make([]byte, types.HTLCPreimageLen)
+	claim := alpha.spend(bob, types.HTLCClaimInput(types.HashTransaction(lockA), 0, bob.Public(), wrong), toBob)
+	assert.True(t, errors.IsOf(alpha.ValidateTransaction(claim), errors.ErrUnauthorized))
+	refund := beta.spend(bob, &proto.TxInput{PrevTxHash: types.HashTransaction(lockB), PublicKey: bob.Public().Bytes()}, toBob)
+	assert.True(t, errors.IsOf(beta.ValidateTransaction(refund), errors.ErrTxNotFinal))
+
+	// only alice can use the preimage on beta
+	stolen := beta.spend(bob, types.HTLCClaimInput(types.HashTransaction(lockB), 0, bob.Public(), preimage), toBob)
+	assert.True(t, errors.IsOf(beta.ValidateTransaction(stolen), errors.ErrUnauthorized))
+
+	// alice claims on beta and reveals the preimage
+	claimB := beta.spend(alice, types.HTLCClaimInput(types.HashTransaction(lockB), 0, alice.Public(), preimage), toAlice)
+	beta.mine(t, claimB)
+
+	// bob learns it from the chain and claims on alpha
+	block, err := beta.GetBlockByHeight(beta.Height())
+	require.Nil(t, err)
+	revealed := block.Transactions[0].Inputs[0].Preimage
+
+	claimA := alpha.spend(bob, types.HTLCClaimInput(types.HashTransaction(lockA), 0, bob.Public(), revealed), toBob)
+	alpha.mine(t, claimA)
+
+	// the refund paths are gone with the claimed outputs
+	refundA := alpha.spend(alice, &proto.TxInput{PrevTxHash: types.HashTransaction(lockA), PublicKey: alice.Public().Bytes()}, toAlice)
+	assert.NotNil(t, alpha.ValidateTransaction(refundA))
+}
+
+func TestHTLCRefund(t *testing.T) {
+	var (
+		alice = encrypted.GeneratePrivateKey()
+		bob   = encrypted.GeneratePrivateKey()
+		alpha = newSwapChain(t, "alpha", alice)
+	)
+	lock := alpha.spend(alice,
+		&proto.TxInput{PrevTxHash: types.HashTransaction(alpha.premine), PublicKey: alice.Public().Bytes()},
+		types.HTLCOutput(1000, types.HashLock(make([]byte, types.HTLCPreimageLen)), bob.Public().Address(), alice.Public().Address(), 3))
+	alpha.mine(t, lock)
+
+	toAlice := &proto.TxOutput{Amount: 1000, Address: alice.Public().Address().Bytes()}
+	refund := alpha.spend(alice, &proto.TxInput{PrevTxHash: types.HashTransaction(lock), PublicKey: alice.Public().Bytes()}, toAlice)
+	assert.True(t, errors.IsOf(alpha.ValidateTransaction(refund), errors.ErrTxNotFinal))
+
+	alpha.mine(t)
+	require.Nil(t, alpha.ValidateTransaction(refund))
+
+	// the recipient cannot take the refund path
+	taken := alpha.spend(bob, &proto.TxInput{PrevTxHash: types.HashTransaction(lock), PublicKey: bob.Public().Bytes()}, toAlice)
+	assert.True(t, errors.IsOf(alpha.ValidateTransaction(taken), errors.ErrUnauthorized))
+
+	// HTLC outputs that time out before they are included are rejected
+	late := alpha.spend(alice, &proto.TxInput{PrevTxHash: types.HashTransaction(lock), PublicKey: alice.Public().Bytes()},
+		types.HTLCOutput(1000, types.HashLock(make([]byte, types.HTLCPreimageLen)), bob.Public().Address(), alice.Public().Address(), 3))
+	assert.True(t, errors.IsOf(alpha.ValidateTransaction(late), errors.ErrInvalidHeight))
+}
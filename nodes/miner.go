@@ -0,0 +1,69 @@
+package nodes
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+const (
+	// tipPollInterval is how often a miner checks whether the block it
+	// works on became stale.
+	tipPollInterval = 100 * time.Millisecond
+	// minerRetryDelay keeps a miner whose blocks fail from spinning.
+	minerRetryDelay = time.Second
+)
+
+// minerLoop keeps mining blocks on top of our tip, starting over whenever
+// the tip changes under it.
+func (n *Node) minerLoop() {
+	n.logger.Infow("Starting miner...", "publicKey", n.PrivateKey.Public().Address())
+
+	for n.ctx.Err() == nil {
+		tip := types.HashHeader(n.chain.Tip())
+
+		ctx, cancel := context.WithCancel(n.ctx)
+		n.spawn(func() { n.watchTip(ctx, cancel, tip) })
+		block, err := n.createBlock(ctx, n.Clock.Now())
+		stale := ctx.Err() != nil
+		cancel()
+
+		if stale {
+			continue
+		}
+		if err == nil {
+			n.logger.Debugw("Mined block", "height", block.Header.Height, "lenTx", len(block.Transactions))
+			if err = n.addBlock(block); err == nil {
+				n.relayBlock(block, nil)
+				continue
+			}
+		}
+
+		n.logger.Errorw("Mining block failed", "error", err)
+		select {
+		case <-n.Clock.After(minerRetryDelay):
+		case <-n.ctx.Done():
+		}
+	}
+}
+
+// watchTip calls cancel once the chain tip is no longer tip.
+func (n *Node) watchTip(ctx context.Context, cancel context.CancelFunc, tip []byte) {
+	ticker := n.Clock.NewTicker(tipPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		if !bytes.Equal(types.HashHeader(n.chain.Tip()), tip) {
+			cancel()
+			return
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/consensus"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+)
+
+func TestMinerBlocksPropagate(t *testing.T) {
+	genesis := Genesis{
+		Engine: EnginePoW,
+		Pow: consensus.PowParams{
+			LimitBits:        0x1f00ffff,
+			TargetSpacing:    time.Second,
+			RetargetInterval: 100,
+		},
+	}
+
+	minerAddr := freeAddr(t)
+	miner := NewNode(ServerConfig{
+		Version:    "0.0.1",
+		ListenAddr: minerAddr,
+		PrivateKey: encrypted.GeneratePrivateKey(),
+		Genesis:    genesis,
+	})
+	go miner.Start(context.Background())
+	t.Cleanup(miner.Stop)
+
+	follower := NewNode(ServerConfig{
+		Version:        "0.0.1",
+		ListenAddr:     freeAddr(t),
+		BootstrapNodes: []string{minerAddr},
+		Genesis:        genesis,
+	})
+	go follower.Start(context.Background())
+	t.Cleanup(follower.Stop)
+
+	require.Eventually(t, func() bool {
+		return follower.Chain().Height() >= 3
+	}, 10*time.Second, 10*time.Millisecond)
+
+	block, err := follower.Chain().GetBlockByHeight(3)
+	require.Nil(t, err)
+	assert.True(t, consensus.CheckProofOfWork(block.Header))
+	assert.Equal(t, miner.PrivateKey.Public().Bytes(), block.PublicKey)
+}
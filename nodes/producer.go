@@ -0,0 +1,125 @@
+package nodes
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"time"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+// validatorLoop proposes a block every blockTime whenever the consensus
+// engine gives us the turn.
+func (n *Node) validatorLoop() {
+	n.logger.Infow("Starting validator loop...", "publicKey", n.PrivateKey.Public().Address(), "blockTime", blockTime)
+	ticker := n.Clock.NewTicker(blockTime)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		now := n.Clock.Now()
+		if !n.isProposer(now) {
+			continue
+		}
+
+		block, err := n.createBlock(n.ctx, now)
+		if err != nil {
+			n.logger.Errorw("Proposing block failed", "error", err)
+			continue
+		}
+		n.logger.Debugw("Creating new block...", "height", block.Header.Height, "lenTx", len(block.Transactions))
+
+		if err := n.addBlock(block); err != nil {
+			n.logger.Errorw("Adding own block failed", "error", err)
+			continue
+		}
+		n.relayBlock(block, nil)
+	}
+}
+
+// isProposer reports whether the consensus engine lets us propose the next
+// block at the given time.
+func (n *Node) isProposer(now time.Time) bool {
+	proposer, err := n.Consensus.SelectProposer(n.chain, int32(n.chain.Height()+1), now.UnixNano())
+	if err != nil {
+		n.logger.Errorw("Selecting proposer failed", "error", err)
+		return false
+	}
+
+	return proposer == nil || bytes.Equal(proposer, n.PrivateKey.Public().Bytes())
+}
+
+// createBlock builds a block on top of our tip from the pending evidence and
+// the mempool transactions that are valid against the chain and has the
+// consensus engine seal it.
+func (n *Node) createBlock(ctx context.Context, now time.Time) (*proto.Block, error) {
+	rules, err := n.chain.NextRules()
+	if err != nil {
+		return nil, err
+	}
+
+	tip := n.chain.Tip()
+	block := &proto.Block{
+		Header: &proto.Header{
+			Version:   rules.Version,
+			Height:    tip.Height + 1,
+			PrevHash:  types.HashHeader(tip),
+			Timestamp: now.UnixNano(),
+			ChainId:   n.chain.ChainID(),
+		},
+		Evidence: n.pendingEvidence(),
+	}
+
+	// included transactions leave the mempool once the block is added, so
+	// they are not lost if the block never makes it into the chain
+	spent := make(map[string]bool)
+	for _, tx := range n.mempool.List() {
+		if !n.canInclude(tx, spent) {
+			continue
+		}
+		block.Transactions = append(block.Transactions, tx)
+	}
+
+	if err := n.Consensus.Propose(ctx, n.chain, block, n.PrivateKey); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+// canInclude reports whether tx is valid and does not spend an output that
+// another transaction of the block already spends.
+func (n *Node) canInclude(tx *proto.Transaction, spent map[string]bool) bool {
+	for _, input := range tx.Inputs {
+		if len(input.Signature) == 0 && input.Multisig == nil && len(input.UnlockingScript) == 0 {
+			return false
+		}
+		if spent[utxoKey(input.PrevTxHash, input.PrevOutIndex)] {
+			return false
+		}
+	}
+
+	if err := n.chain.ValidateTransaction(tx); err != nil {
+		// time locked transactions wait in the mempool until they are final
+		if errors.IsOf(err, errors.ErrTxNotFinal) {
+			return false
+		}
+		n.logger.Debugw("Dropping invalid transaction", "error", err)
+		n.mempool.Remove(hex.EncodeToString(types.HashTransaction(tx)))
+		return false
+	}
+
+	for _, input := range tx.Inputs {
+		spent[utxoKey(input.PrevTxHash, input.PrevOutIndex)] = true
+	}
+
+	return true
+}
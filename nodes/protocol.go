@@ -0,0 +1,67 @@
+package nodes
+
+import (
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// Feature flags announce optional services of a node on handshake. Peers
+// ignore flags they do not know.
+const (
+	// FeatureEvidence is set by nodes that keep an evidence pool and accept
+	// evidence of equivocating validators.
+	FeatureEvidence = "evidence"
+)
+
+// features returns the feature flags we announce.
+func (n *Node) features() []string {
+	var features []string
+	if n.evidence != nil {
+		features = append(features, FeatureEvidence)
+	}
+
+	return features
+}
+
+// negotiateProtocol returns the highest p2p protocol both local and remote
+// speak. Peers without a common protocol, or validating blocks by other
+// rules, are refused with ErrInvalidVersion.
+func negotiateProtocol(local, remote *proto.Version) (uint64, error) {
+	if remote.BlockProtocol != local.BlockProtocol {
+		return 0, errors.Wrapf(errors.ErrInvalidVersion, "peer %s uses block protocol %d instead of %d", remote.ListenAddr, remote.BlockProtocol, local.BlockProtocol)
+	}
+
+	protocol := min(local.P2PProtocol, remote.P2PProtocol)
+	if protocol < local.MinP2PProtocol || protocol < remote.MinP2PProtocol {
+		return 0, errors.Wrapf(errors.ErrInvalidVersion, "peer %s speaks p2p protocols %d-%d, we speak %d-%d",
+			remote.ListenAddr, remote.MinP2PProtocol, remote.P2PProtocol, local.MinP2PProtocol, local.P2PProtocol)
+	}
+
+	return protocol, nil
+}
+
+// checkVersion checks the version a peer sent us and returns the protocol
+// to talk to it with.
+func (n *Node) checkVersion(v *proto.Version) (uint64, error) {
+	if err := n.checkGenesis(v); err != nil {
+		return 0, err
+	}
+
+	return negotiateProtocol(n.getVersion(), v)
+}
+
+// setVersion records the version of the peer and what we negotiated with it.
+func (p *peer) setVersion(v *proto.Version, protocol uint64) {
+	p.version = v
+	p.protocol = protocol
+	p.features = make(map[string]bool, len(v.Features))
+	for _, feature := range v.Features {
+		p.features[feature] = true
+	}
+}
+
+// supports reports whether the peer announced the feature and we share a
+// protocol of at least minProtocol with it.
+func (p *peer) supports(feature string, minProtocol uint64) bool {
+	return p.protocol >= minProtocol && p.features[feature]
+}
@@ -0,0 +1,72 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+func TestNegotiateProtocol(t *testing.T) {
+	local := &proto.Version{P2PProtocol: 8, MinP2PProtocol: 7, BlockProtocol: 11}
+
+	cases := []struct {
+		name     string
+		remote   *proto.Version
+		protocol uint64
+	}{
+		{"same", &proto.Version{P2PProtocol: 8, MinP2PProtocol: 7, BlockProtocol: 11}, 8},
+		{"older", &proto.Version{P2PProtocol: 7, MinP2PProtocol: 6, BlockProtocol: 11}, 7},
+		{"newer", &proto.Version{P2PProtocol: 9, MinP2PProtocol: 8, BlockProtocol: 11}, 8},
+		{"too old", &proto.Version{P2PProtocol: 6, MinP2PProtocol: 5, BlockProtocol: 11}, 0},
+		{"too new", &proto.Version{P2PProtocol: 10, MinP2PProtocol: 9, BlockProtocol: 11}, 0},
+		{"block protocol", &proto.Version{P2PProtocol: 8, MinP2PProtocol: 7, BlockProtocol: 12}, 0},
+		{"no negotiation", &proto.Version{}, 0},
+	}
+	for _, c := range cases {
+		protocol, err := negotiateProtocol(local, c.remote)
+		if c.protocol == 0 {
+			assert.True(t, errors.IsOf(err, errors.ErrInvalidVersion), c.name)
+			continue
+		}
+		require.Nil(t, err, c.name)
+		assert.Equal(t, c.protocol, protocol, c.name)
+	}
+}
+
+func TestHandshakeNegotiatesProtocol(t *testing.T) {
+	n := NewNode(ServerConfig{ListenAddr: "127.0.0.1:0"})
+	ours := n.getVersion()
+
+	old := &proto.Version{
+		ListenAddr:     "127.0.0.1:1",
+		GenesisHash:    n.genesisHash,
+		P2PProtocol:    ours.MinP2PProtocol,
+		MinP2PProtocol: ours.MinP2PProtocol - 1,
+		BlockProtocol:  ours.BlockProtocol,
+		Features:       []string{FeatureEvidence, "unknown"},
+	}
+	reply, err := n.Handshake(context.Background(), old)
+	require.Nil(t, err)
+	assert.Equal(t, ours.P2PProtocol, reply.P2PProtocol)
+
+	p := n.getPeers()[0]
+	assert.Equal(t, ours.MinP2PProtocol, p.protocol)
+	assert.True(t, p.features[FeatureEvidence])
+	// evidence gossip needs a newer protocol than the peer speaks
+	assert.False(t, p.supports(FeatureEvidence, ours.P2PProtocol))
+
+	future := &proto.Version{
+		ListenAddr:     "127.0.0.1:2",
+		GenesisHash:    n.genesisHash,
+		P2PProtocol:    ours.P2PProtocol + 2,
+		MinP2PProtocol: ours.P2PProtocol + 1,
+		BlockProtocol:  ours.BlockProtocol,
+	}
+	_, err = n.Handshake(context.Background(), future)
+	assert.True(t, errors.IsOf(err, errors.ErrInvalidVersion))
+	assert.Len(t, n.Peers(), 1)
+}
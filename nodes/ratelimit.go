@@ -0,0 +1,189 @@
+package nodes
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcpeer "google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// bucketIdleTTL is how long an unused per-peer bucket is kept around.
+const bucketIdleTTL = 10 * time.Minute
+
+// RateLimit configures a token bucket: Rate tokens are added per second up
+// to a maximum of Burst.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// DefaultPeerRateLimits are applied per remote host when ServerConfig does
+// not set PeerRateLimits.
+var DefaultPeerRateLimits = map[string]RateLimit{
+	proto.Node_Handshake_FullMethodName:         {Rate: 1, Burst: 20},
+	proto.Node_HandleTransaction_FullMethodName: {Rate: 200, Burst: 400},
+	proto.Node_HandleInventory_FullMethodName:   {Rate: 500, Burst: 1000},
+	proto.Node_GetData_FullMethodName:           {Rate: 500, Burst: 1000},
+	proto.Node_HandleProposal_FullMethodName:    {Rate: 50, Burst: 100},
+	proto.Node_HandleVote_FullMethodName:        {Rate: 500, Burst: 1000},
+	proto.Node_HandleEvidence_FullMethodName:    {Rate: 10, Burst: 20},
+}
+
+// DefaultGlobalRateLimits are applied across all peers when ServerConfig
+// does not set GlobalRateLimits.
+var DefaultGlobalRateLimits = map[string]RateLimit{
+	proto.Node_Handshake_FullMethodName:         {Rate: 20, Burst: 100},
+	proto.Node_HandleTransaction_FullMethodName: {Rate: 2000, Burst: 4000},
+	proto.Node_HandleInventory_FullMethodName:   {Rate: 5000, Burst: 10000},
+	proto.Node_GetData_FullMethodName:           {Rate: 5000, Burst: 10000},
+	proto.Node_HandleProposal_FullMethodName:    {Rate: 500, Burst: 1000},
+	proto.Node_HandleVote_FullMethodName:        {Rate: 5000, Burst: 10000},
+	proto.Node_HandleEvidence_FullMethodName:    {Rate: 100, Burst: 200},
+}
+
+type tokenBucket struct {
+	rate     float64
+	burst    float64
+	tokens   float64
+	lastFill time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:     limit.Rate,
+		burst:    float64(limit.Burst),
+		tokens:   float64(limit.Burst),
+		lastFill: now,
+	}
+}
+
+// fill adds the tokens accrued since the last fill and reports whether the
+// bucket holds a token to take.
+func (b *tokenBucket) fill(now time.Time) bool {
+	b.tokens += now.Sub(b.lastFill).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.lastFill = now
+
+	return b.tokens >= 1
+}
+
+// RateLimiter enforces per-peer and global token buckets for every RPC
+// method that has a limit configured.
+type RateLimiter struct {
+	lock         sync.Mutex
+	peerLimits   map[string]RateLimit
+	globalLimits map[string]RateLimit
+	global       map[string]*tokenBucket
+	peers        map[string]*tokenBucket
+	lastPrune    time.Time
+}
+
+func NewRateLimiter(peerLimits, globalLimits map[string]RateLimit) *RateLimiter {
+	return &RateLimiter{
+		peerLimits:   peerLimits,
+		globalLimits: globalLimits,
+		global:       make(map[string]*tokenBucket),
+		peers:        make(map[string]*tokenBucket),
+		lastPrune:    time.Now(),
+	}
+}
+
+// Allow reports whether a call to method from the given remote host may
+// proceed. A token is only taken, from each bucket that applies, when all
+// of them hold one, so rejected calls cost nothing.
+func (r *RateLimiter) Allow(host, method string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	r.prune(now)
+
+	var buckets []*tokenBucket
+	if limit, ok := r.peerLimits[method]; ok {
+		key := host + "|" + method
+		bucket, ok := r.peers[key]
+		if !ok {
+			bucket = newTokenBucket(limit, now)
+			r.peers[key] = bucket
+		}
+		buckets = append(buckets, bucket)
+	}
+	if limit, ok := r.globalLimits[method]; ok {
+		bucket, ok := r.global[method]
+		if !ok {
+			bucket = newTokenBucket(limit, now)
+			r.global[method] = bucket
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	allowed := true
+	for _, bucket := range buckets {
+		if !bucket.fill(now) {
+			allowed = false
+		}
+	}
+	if !allowed {
+		return false
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+
+	return true
+}
+
+func (r *RateLimiter) prune(now time.Time) {
+	if now.Sub(r.lastPrune) < bucketIdleTTL {
+		return
+	}
+
+	for key, bucket := range r.peers {
+		if now.Sub(bucket.lastFill) > bucketIdleTTL {
+			delete(r.peers, key)
+		}
+	}
+	r.lastPrune = now
+}
+
+func (r *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !r.Allow(peerHost(ctx), info.FullMethod) {
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s", info.FullMethod)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (r *RateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !r.Allow(peerHost(ss.Context()), info.FullMethod) {
+			return status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s", info.FullMethod)
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func peerHost(ctx context.Context) string {
+	p, ok := grpcpeer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
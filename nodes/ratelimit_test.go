@@ -0,0 +1,88 @@
+package nodes
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcpeer "google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func peerContext(addr string) context.Context {
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	return grpcpeer.NewContext(context.Background(), &grpcpeer.Peer{Addr: tcpAddr})
+}
+
+func TestRateLimiterPerPeer(t *testing.T) {
+	limiter := NewRateLimiter(map[string]RateLimit{"/Node/Test": {Rate: 0, Burst: 2}}, nil)
+
+	assert.True(t, limiter.Allow("10.0.0.1", "/Node/Test"))
+	assert.True(t, limiter.Allow("10.0.0.1", "/Node/Test"))
+	assert.False(t, limiter.Allow("10.0.0.1", "/Node/Test"))
+
+	// other peers and methods have buckets of their own
+	assert.True(t, limiter.Allow("10.0.0.2", "/Node/Test"))
+	assert.True(t, limiter.Allow("10.0.0.1", "/Node/Other"))
+}
+
+func TestRateLimiterGlobal(t *testing.T) {
+	limiter := NewRateLimiter(nil, map[string]RateLimit{"/Node/Test": {Rate: 0, Burst: 2}})
+
+	assert.True(t, limiter.Allow("10.0.0.1", "/Node/Test"))
+	assert.True(t, limiter.Allow("10.0.0.2", "/Node/Test"))
+	assert.False(t, limiter.Allow("10.0.0.3", "/Node/Test"))
+}
+
+func TestRateLimiterRejectionCostsNoTokens(t *testing.T) {
+	limiter := NewRateLimiter(
+		map[string]RateLimit{"/Node/Test": {Rate: 0, Burst: 2}},
+		map[string]RateLimit{"/Node/Test": {Rate: 0, Burst: 1}},
+	)
+
+	require.True(t, limiter.Allow("10.0.0.1", "/Node/Test"))
+	for i := 0; i < 3; i++ {
+		assert.False(t, limiter.Allow("10.0.0.2", "/Node/Test"))
+	}
+
+	// calls the global bucket rejected left the peer bucket full
+	global := limiter.global["/Node/Test"]
+	global.burst, global.tokens = 10, 10
+	assert.True(t, limiter.Allow("10.0.0.2", "/Node/Test"))
+	assert.True(t, limiter.Allow("10.0.0.2", "/Node/Test"))
+	assert.False(t, limiter.Allow("10.0.0.2", "/Node/Test"))
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	limiter := NewRateLimiter(map[string]RateLimit{"/Node/Test": {Rate: 1000, Burst: 1}}, nil)
+
+	require.True(t, limiter.Allow("10.0.0.1", "/Node/Test"))
+	assert.Eventually(t, func() bool {
+		return limiter.Allow("10.0.0.1", "/Node/Test")
+	}, time.Second, time.Millisecond)
+}
+
+func TestRateLimiterUnaryInterceptor(t *testing.T) {
+	var (
+		limiter     = NewRateLimiter(map[string]RateLimit{"/Node/Test": {Rate: 0, Burst: 1}}, nil)
+		interceptor = limiter.UnaryServerInterceptor()
+		info        = &grpc.UnaryServerInfo{FullMethod: "/Node/Test"}
+		handler     = func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	)
+
+	resp, err := interceptor(peerContext("10.0.0.1:4000"), nil, info, handler)
+	require.Nil(t, err)
+	assert.Equal(t, "ok", resp)
+
+	// a new connection from the same host shares the bucket
+	_, err = interceptor(peerContext("10.0.0.1:4001"), nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	_, err = interceptor(peerContext("10.0.0.2:4000"), nil, info, handler)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,39 @@
+package nodes
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// RecoveryUnaryServerInterceptor turns a panic in an RPC handler into an
+// ErrPanic error, so a malformed request cannot bring the node down. The
+// panic is logged; the caller only learns which method failed.
+func RecoveryUnaryServerInterceptor(logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer recoverRPC(logger, info.FullMethod, &err)
+
+		return handler(ctx, req)
+	}
+}
+
+func RecoveryStreamServerInterceptor(logger *zap.SugaredLogger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer recoverRPC(logger, info.FullMethod, &err)
+
+		return handler(srv, ss)
+	}
+}
+
+func recoverRPC(logger *zap.SugaredLogger, method string, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	logger.Errorw("Recovered from panic in RPC handler", "method", method, "panic", r, "stack", string(debug.Stack()))
+	*err = errors.Wrapf(errors.ErrPanic, "handling %s", method)
+}
@@ -0,0 +1,51 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/util"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+func TestRecoveryInterceptor(t *testing.T) {
+	var (
+		intercept = RecoveryUnaryServerInterceptor(zap.NewNop().Sugar())
+		info      = &grpc.UnaryServerInfo{FullMethod: "/proto.Node/HandleTransaction"}
+	)
+
+	resp, err := intercept(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		panic("boom")
+	})
+	assert.Nil(t, resp)
+	assert.True(t, errors.IsOf(err, errors.ErrPanic))
+
+	resp, err = intercept(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		return &proto.Ack{}, nil
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, resp)
+}
+
+func TestHandleMalformedTransaction(t *testing.T) {
+	n := NewNode(ServerConfig{})
+
+	// a peer sending inputs without signatures or with short keys gets an
+	// error back instead of crashing the node
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{{PrevTxHash: util.RandomHash(), PublicKey: []byte{1, 2, 3}}},
+	}
+	_, err := n.HandleTransaction(context.Background(), tx)
+	assert.NotNil(t, err)
+
+	tx = randomTransaction()
+	tx.Inputs[0].Signature = tx.Inputs[0].Signature[:10]
+	_, err = n.HandleTransaction(context.Background(), tx)
+	assert.True(t, errors.IsOf(err, errors.ErrUnauthorized))
+	assert.Equal(t, 0, n.mempool.Len())
+}
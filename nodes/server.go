@@ -1,21 +1,30 @@
 package nodes
 
 import (
+	"bytes"
 	"context"
-	"crypto"
 	"encoding/hex"
-	"net"
+	"fmt"
 	"sync"
 	"time"
 
 	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/consensus"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/version"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/connectivity"
 )
 
-const blockTime = 5 * time.Second
+const (
+	blockTime = 5 * time.Second
+	// rpcTimeout bounds every outbound call so a stuck peer cannot hold up
+	// shutdown.
+	rpcTimeout = 5 * time.Second
+)
 
 type Mempool struct {
 	lock sync.RWMutex
@@ -43,6 +52,19 @@ func (m *Mempool) Clear() []*proto.Transaction {
 	return txx
 }
 
+// List returns the pending transactions without removing them.
+func (m *Mempool) List() []*proto.Transaction {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	txx := make([]*proto.Transaction, 0, len(m.txx))
+	for _, tx := range m.txx {
+		txx = append(txx, tx)
+	}
+
+	return txx
+}
+
 func (m *Mempool) Len() int {
 	m.lock.RLock()
 	defer m.lock.RUnlock()
@@ -60,6 +82,22 @@ func (m *Mempool) Has(tx *proto.Transaction) bool {
 	return ok
 }
 
+func (m *Mempool) Get(hash string) (*proto.Transaction, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	tx, ok := m.txx[hash]
+
+	return tx, ok
+}
+
+func (m *Mempool) Remove(hash string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.txx, hash)
+}
+
 func (m *Mempool) Add(tx *proto.Transaction) bool {
 	if m.Has(tx) {
 		return false
@@ -77,102 +115,331 @@ func (m *Mempool) Add(tx *proto.Transaction) bool {
 type ServerConfig struct {
 	Version    string
 	ListenAddr string
-	PrivateKey *crypto.PrivateKey
+	// AdvertiseAddr is the address peers should dial us on, for nodes that
+	// bind a wildcard address or sit behind NAT. When empty we advertise
+	// ListenAddr, learning the host from peers if it is unspecified.
+	AdvertiseAddr  string
+	BootstrapNodes []string
+	// PrivateKey makes the node produce blocks when set.
+	PrivateKey *encrypted.PrivateKey
+	Genesis    Genesis
+	// Consensus decides who proposes blocks and which blocks are valid. It
+	// defaults to proof of authority over the genesis validators, or to a
+	// single authority holding PrivateKey without any.
+	Consensus consensus.Engine
+	// Transport and Clock default to TCP and the wall clock.
+	Transport Transport
+	Clock     Clock
+	Logger    *zap.SugaredLogger
+	// PeerRateLimits and GlobalRateLimits map full RPC method names to the
+	// token bucket applied per remote host and across all peers. Methods
+	// without an entry are not limited; nil maps use the defaults.
+	PeerRateLimits   map[string]RateLimit
+	GlobalRateLimits map[string]RateLimit
+	// Breaker configures the circuit breaker kept for every outbound peer.
+	Breaker BreakerConfig
+}
+
+type peer struct {
+	client  proto.NodeClient
+	conn    *grpc.ClientConn
+	breaker *CircuitBreaker
+	version *proto.Version
+	// protocol is the highest p2p protocol we share with the peer, features
+	// the optional services it announced.
+	protocol uint64
+	features map[string]bool
+	// known holds the inventory this peer announced to us or we announced to it.
+	known *SeenCache
 }
 
 type Node struct {
 	ServerConfig
-	logger   *zap.SugaredLogger
-	peerLock sync.RWMutex
-	peers    map[proto.NodeClient]*proto.Version
-	mempool  *Mempool
+	logger    *zap.SugaredLogger
+	peerLock  sync.RWMutex
+	peers     map[string]*peer
+	mempool   *Mempool
+	chain     *Chain
+	seen      *SeenCache
+	requested *SeenCache
+	fetches   chan fetch
+	stats     gossipCounters
+	// genesisHash is the hash every peer's genesis block has to have.
+	genesisHash []byte
+
+	// bft is set when blocks are voted on; consensusMsgs feeds the votes
+	// and proposals to our consensus loop if we are a validator, and
+	// timeouts its own timeouts.
+	bft           *consensus.BFT
+	consensusMsgs chan any
+	timeouts      chan timeoutEvent
+	// evidence is set when equivocating validators can be slashed.
+	evidence *EvidencePool
+
+	// observedHost is the host we advertise, see learnObservedAddr;
+	// observedBy maps every peer host to the host it saw us on, and
+	// observedVotes every host we were seen on to those peer hosts.
+	addrLock      sync.RWMutex
+	observedHost  string
+	observedBy    map[string]string
+	observedVotes map[string]map[string]bool
+
+	// lifecycle
+	lock       sync.Mutex
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	grpcServer *grpc.Server
+	stopped    bool
+	stopOnce   sync.Once
+	// halted is why the node stopped on its own.
+	halted error
+
 	proto.UnimplementedNodeServer
 }
 
 func NewNode(cfg ServerConfig) *Node {
-	loggerConfig := zap.NewDevelopmentConfig()
-	loggerConfig.EncoderConfig.TimeKey = ""
-	logger, _ := loggerConfig.Build()
-	return &Node{
-		peers:        make(map[proto.NodeClient]*proto.Version),
-		logger:       logger.Sugar(),
-		mempool:      NewMempool(),
-		ServerConfig: cfg,
-	}
-}
-
-func (n *Node) Start(listenAddr string, bootstrapNodes []string) error {
-	n.ListenAddr = listenAddr
-	var (
-		opts       []grpc.ServerOption
-		grpcServer = grpc.NewServer(opts...)
-	)
-	ln, err := net.Listen("tcp", listenAddr)
+	if cfg.Logger == nil {
+		loggerConfig := zap.NewDevelopmentConfig()
+		loggerConfig.EncoderConfig.TimeKey = ""
+		logger, _ := loggerConfig.Build()
+		cfg.Logger = logger.Sugar()
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = TCPTransport{}
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock{}
+	}
+	if cfg.PeerRateLimits == nil {
+		cfg.PeerRateLimits = DefaultPeerRateLimits
+	}
+	if cfg.GlobalRateLimits == nil {
+		cfg.GlobalRateLimits = DefaultGlobalRateLimits
+	}
+	if cfg.Breaker.FailureThreshold == 0 {
+		cfg.Breaker = DefaultBreakerConfig
+	}
+	cfg.Genesis = cfg.Genesis.WithDefaults()
+	genesis, err := cfg.Genesis.Block()
 	if err != nil {
-		return err
+		panic(err)
+	}
+	if cfg.Consensus == nil {
+		cfg.Consensus = cfg.Genesis.engine(cfg.PrivateKey)
 	}
 
-	proto.RegisterNodeServer(grpcServer, n)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	n := &Node{
+		peers:         make(map[string]*peer),
+		logger:        cfg.Logger,
+		mempool:       NewMempool(),
+		chain:         NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), cfg.Consensus, genesis, cfg.Genesis.Upgrades),
+		genesisHash:   types.HashBlock(genesis),
+		seen:          NewSeenCache(seenTTL),
+		requested:     NewSeenCache(requestTTL),
+		fetches:       make(chan fetch, maxQueuedFetches),
+		observedBy:    make(map[string]string),
+		observedVotes: make(map[string]map[string]bool),
+		ctx:           ctx,
+		cancel:        cancel,
+		ServerConfig:  cfg,
+	}
+	n.chain.clock = cfg.Clock
+	n.chain.onReorganize = n.reorganized
+	if _, ok := cfg.Consensus.(consensus.Staking); ok {
+		n.evidence = NewEvidencePool()
+	}
+	if bft, ok := cfg.Consensus.(*consensus.BFT); ok {
+		n.bft = bft
+		if cfg.PrivateKey != nil && bft.IsValidator(cfg.PrivateKey.Public().Bytes()) {
+			n.consensusMsgs = make(chan any, 256)
+			n.timeouts = make(chan timeoutEvent, 16)
+		}
+	}
+
+	return n
+}
+
+// Start serves the node on ListenAddr and blocks until ctx is cancelled or
+// Stop is called. It returns nil after a graceful shutdown, or why the node
+// halted if it stopped on its own.
+func (n *Node) Start(ctx context.Context) error {
+	if !n.checkUpgrade() {
+		return n.haltErr()
+	}
+
+	limiter := NewRateLimiter(n.PeerRateLimits, n.GlobalRateLimits)
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(RecoveryUnaryServerInterceptor(n.logger), limiter.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(RecoveryStreamServerInterceptor(n.logger), limiter.StreamServerInterceptor()),
+	}
+
+	ln, err := n.Transport.Listen(n.ListenAddr)
+	if err != nil {
+		return err
+	}
+	// resolves port 0 to the port we actually got
+	n.ListenAddr = ln.Addr().String()
+
+	n.lock.Lock()
+	if n.stopped {
+		n.lock.Unlock()
+		ln.Close()
+		return n.haltErr()
+	}
+	n.grpcServer = grpc.NewServer(opts...)
+	proto.RegisterNodeServer(n.grpcServer, n)
+	n.lock.Unlock()
 
 	n.logger.Infow("Starting node...", "on", n.ListenAddr)
 
 	// bootstrap network with the known nodes
-	if len(bootstrapNodes) > 0 {
-		go func() {
-			err := n.bootstrapNetwork(bootstrapNodes)
-			if err != nil {
+	if len(n.BootstrapNodes) > 0 {
+		n.spawn(func() {
+			if err := n.bootstrapNetwork(n.BootstrapNodes); err != nil {
 				n.logger.Errorw("Bootstrap error", "error", err)
 			}
-		}()
+		})
 	}
 
-	if n.PrivateKey != nil {
-		go n.validatorLoop()
+	for i := 0; i < fetchWorkers; i++ {
+		n.spawn(n.fetchLoop)
 	}
 
-	return grpcServer.Serve(ln)
-}
+	// only nodes with a key produce blocks, and with BFT only validators
+	switch _, pow := n.Consensus.(*consensus.ProofOfWork); {
+	case n.PrivateKey == nil:
+	case n.consensusMsgs != nil:
+		n.spawn(n.consensusLoop)
+	case n.bft != nil:
+	case pow:
+		n.spawn(n.minerLoop)
+	default:
+		n.spawn(n.validatorLoop)
+	}
 
-func (n *Node) Handshake(ctx context.Context, v *proto.Version) (*proto.Version, error) {
-	client, err := makeNodeClient(v.ListenAddr)
-	if err != nil {
-		return nil, err
+	go func() {
+		select {
+		case <-ctx.Done():
+			n.Stop()
+		case <-n.ctx.Done():
+		}
+	}()
+
+	if err := n.grpcServer.Serve(ln); err != nil {
+		return err
 	}
 
-	n.addPeer(client, v)
+	return n.haltErr()
+}
+
+// Stop shuts the node down: it stops the validator loop, lets in-flight
+// RPCs and broadcasts finish, closes peer connections and flushes the
+// mempool and chain stores. It is safe to call more than once.
+func (n *Node) Stop() {
+	n.stopOnce.Do(func() {
+		n.lock.Lock()
+		n.stopped = true
+		grpcServer := n.grpcServer
+		n.lock.Unlock()
+
+		n.logger.Infow("Stopping node...", "on", n.ListenAddr)
+
+		n.cancel()
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+		n.wg.Wait()
 
-	return n.getVersion(), nil
+		for _, p := range n.getPeers() {
+			n.deletePeer(p.version.ListenAddr)
+			p.conn.Close()
+		}
+
+		if txx := n.mempool.Clear(); len(txx) > 0 {
+			n.logger.Debugw("Dropped mempool", "lenTx", len(txx))
+		}
+		if err := n.chain.Close(); err != nil {
+			n.logger.Errorw("Closing chain failed", "error", err)
+		}
+	})
 }
 
-func (n *Node) HandleTransaction(ctx context.Context, tx *proto.Transaction) (*proto.Ack, error) {
-	p, _ := peer.FromContext(ctx)
-	hash := hex.EncodeToString(types.HashTransaction(tx))
+// halt stops the node on its own because it cannot go on safely.
+func (n *Node) halt(err error) {
+	n.lock.Lock()
+	if n.halted == nil {
+		n.halted = err
+	}
+	n.lock.Unlock()
 
-	if n.mempool.Add(tx) {
-		n.logger.Debugw("Received transaction", "from", p.Addr, "hash", hash, "we", n.ListenAddr)
+	// Stop waits for our own goroutines, so it must not run on one of them
+	go n.Stop()
+}
 
-		go func() {
-			if err := n.broadcast(tx); err != nil {
-				n.logger.Errorw("Broadcast error", "error", err)
-			}
-		}()
+func (n *Node) haltErr() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return n.halted
+}
+
+// spawn runs f on a goroutine that Stop waits for. Nothing is started once
+// the node is stopping.
+func (n *Node) spawn(f func()) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.stopped {
+		return false
 	}
 
-	return &proto.Ack{}, nil
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		f()
+	}()
+
+	return true
 }
 
-func (n *Node) broadcast(msg any) error {
-	for p := range n.peers {
-		switch v := msg.(type) {
-		case *proto.Transaction:
-			_, err := p.HandleTransaction(context.Background(), v)
-			if err != nil {
-				return err
-			}
+func (n *Node) Handshake(ctx context.Context, v *proto.Version) (*proto.Version, error) {
+	protocol, err := n.checkVersion(v)
+	if err != nil {
+		return nil, err
+	}
+	observed := remoteAddr(ctx, v.ListenAddr)
+	v.ListenAddr = withHost(v.ListenAddr, observed)
+
+	p, err := n.dial(v.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	p.setVersion(v, protocol)
+	n.addPeer(p)
+
+	// what the peer saw us on only counts once we could dial it back
+	n.spawn(func() {
+		if n.connected(p) {
+			n.learnObservedAddr(v.ObservedAddr, observed)
 		}
+	})
+
+	reply := n.getVersion()
+	reply.ObservedAddr = observed
+
+	return reply, nil
+}
+
+func (n *Node) HandleTransaction(ctx context.Context, tx *proto.Transaction) (*proto.Ack, error) {
+	if err := n.processTransaction(tx, nil); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &proto.Ack{}, nil
 }
 
 func (n *Node) bootstrapNetwork(bootstrapNodes []string) error {
@@ -182,45 +449,50 @@ func (n *Node) bootstrapNetwork(bootstrapNodes []string) error {
 		}
 		n.logger.Debugw("Dialing remote nodes...", "ourNode", n.ListenAddr, "remoteNode", node)
 
-		client, v, err := n.dialRemoteNode(node)
+		p, err := n.dialRemoteNode(node)
 		if err != nil {
 			return err
 		}
 
-		n.addPeer(client, v)
+		n.addPeer(p)
 	}
 
 	return nil
 }
 
-func (n *Node) validatorLoop() {
-	//n.logger.Infow("Starting validator loop...", "publicKey", n.PrivateKey.Public(), "blockTime", blockTime)
-	ticker := time.NewTicker(blockTime)
-
-	for {
-		<-ticker.C
-
-		txx := n.mempool.Clear()
-
-		n.logger.Debugw("Creating new block...", "lenTx", len(txx))
-	}
+// Chain returns the chain the node keeps.
+func (n *Node) Chain() *Chain {
+	return n.chain
 }
 
-func (n *Node) addPeer(client proto.NodeClient, v *proto.Version) {
+// addPeer registers a handshaked peer. A peer we are already connected to is
+// closed again.
+func (n *Node) addPeer(p *peer) {
 	n.peerLock.Lock()
 	defer n.peerLock.Unlock()
 
-	n.peers[client] = v
+	v := p.version
+	if _, ok := n.peers[v.ListenAddr]; ok {
+		p.conn.Close()
+		return
+	}
+
+	n.lock.Lock()
+	stopped := n.stopped
+	n.lock.Unlock()
+	if stopped {
+		p.conn.Close()
+		return
+	}
+
+	n.peers[v.ListenAddr] = p
 
 	if len(v.PeerList) > 0 {
-		go func() {
-			go func() {
-				err := n.bootstrapNetwork(v.PeerList)
-				if err != nil {
-					n.logger.Errorw("Bootstrap error", "error", err)
-				}
-			}()
-		}()
+		n.spawn(func() {
+			if err := n.bootstrapNetwork(v.PeerList); err != nil {
+				n.logger.Errorw("Bootstrap error", "error", err)
+			}
+		})
 	}
 
 	n.logger.Debugw("New peer successfully connected.",
@@ -229,38 +501,126 @@ func (n *Node) addPeer(client proto.NodeClient, v *proto.Version) {
 		"height", v.Height)
 }
 
-func (n *Node) deletePeer(client proto.NodeClient) {
+func (n *Node) deletePeer(addr string) {
 	n.peerLock.Lock()
 	defer n.peerLock.Unlock()
 
-	delete(n.peers, client)
+	delete(n.peers, addr)
 }
 
-func (n *Node) dialRemoteNode(addr string) (proto.NodeClient, *proto.Version, error) {
-	client, err := makeNodeClient(addr)
+func (n *Node) getPeer(addr string) *peer {
+	n.peerLock.RLock()
+	defer n.peerLock.RUnlock()
+
+	return n.peers[addr]
+}
+
+func (n *Node) getPeers() []*peer {
+	n.peerLock.RLock()
+	defer n.peerLock.RUnlock()
+
+	peers := make([]*peer, 0, len(n.peers))
+	for _, p := range n.peers {
+		peers = append(peers, p)
+	}
+
+	return peers
+}
+
+func (n *Node) dialRemoteNode(addr string) (*peer, error) {
+	p, err := n.dial(addr)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	v, err := client.Handshake(context.Background(), n.getVersion())
+	ctx, cancel := context.WithTimeout(n.ctx, rpcTimeout)
+	defer cancel()
+
+	hello := n.getVersion()
+	hello.ObservedAddr = addr
+
+	v, err := p.client.Handshake(ctx, hello)
+	var protocol uint64
+	if err == nil {
+		protocol, err = n.checkVersion(v)
+	}
 	if err != nil {
-		return nil, nil, err
+		p.conn.Close()
+		return nil, err
 	}
+	v.ListenAddr = withHost(v.ListenAddr, addr)
+	p.setVersion(v, protocol)
+	n.learnObservedAddr(v.ObservedAddr, addr)
 
-	return client, v, nil
+	return p, nil
+}
+
+// connected reports whether the connection to p comes up within rpcTimeout.
+func (n *Node) connected(p *peer) bool {
+	ctx, cancel := context.WithTimeout(n.ctx, rpcTimeout)
+	defer cancel()
+
+	p.conn.Connect()
+	for {
+		state := p.conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return true
+		case connectivity.Shutdown:
+			return false
+		}
+		if !p.conn.WaitForStateChange(ctx, state) {
+			return false
+		}
+	}
+}
+
+// dial connects to a peer through a circuit breaker of its own.
+func (n *Node) dial(addr string) (*peer, error) {
+	breaker := NewCircuitBreaker(n.Breaker)
+	conn, err := n.Transport.Dial(addr, grpc.WithUnaryInterceptor(breaker.UnaryClientInterceptor()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &peer{
+		client:  proto.NewNodeClient(conn),
+		conn:    conn,
+		breaker: breaker,
+		known:   NewSeenCache(seenTTL),
+	}, nil
 }
 
 func (n *Node) getVersion() *proto.Version {
 	return &proto.Version{
-		Version:    "0.0.1",
-		Height:     0,
-		ListenAddr: n.ListenAddr,
-		PeerList:   n.getPeerList(),
+		Version:        version.NodeSemVer,
+		Height:         int32(n.chain.Height()),
+		ListenAddr:     n.advertisedAddr(),
+		PeerList:       n.getPeerList(),
+		GenesisHash:    n.genesisHash,
+		ChainId:        n.chain.ChainID(),
+		P2PProtocol:    version.P2PProtocol,
+		MinP2PProtocol: version.MinP2PProtocol,
+		BlockProtocol:  version.BlockProtocol,
+		Features:       n.features(),
+	}
+}
+
+// checkGenesis rejects peers of other chains and peers that started from
+// another genesis block.
+func (n *Node) checkGenesis(v *proto.Version) error {
+	if v.ChainId != n.chain.ChainID() {
+		return errors.Wrapf(errors.ErrInvalidChainID, "peer %s is on chain %q instead of %q", v.ListenAddr, v.ChainId, n.chain.ChainID())
+	}
+	if !bytes.Equal(v.GenesisHash, n.genesisHash) {
+		return fmt.Errorf("peer %s has genesis %x instead of %x", v.ListenAddr, v.GenesisHash, n.genesisHash)
 	}
+
+	return nil
 }
 
 func (n *Node) canConnectWith(addr string) bool {
-	if n.ListenAddr == addr {
+	if n.isSelf(addr) || !n.isRoutable(addr) {
 		return false
 	}
 
@@ -274,23 +634,30 @@ func (n *Node) canConnectWith(addr string) bool {
 	return true
 }
 
+// Peers returns the listen addresses of the connected peers.
+func (n *Node) Peers() []string {
+	return n.getPeerList()
+}
+
 func (n *Node) getPeerList() []string {
 	n.peerLock.RLock()
 	defer n.peerLock.RUnlock()
 
 	var peers []string
-	for _, v := range n.peers {
-		peers = append(peers, v.ListenAddr)
+	for addr := range n.peers {
+		if n.isRoutable(addr) {
+			peers = append(peers, addr)
+		}
 	}
 
 	return peers
 }
 
-func makeNodeClient(listenAddr string) (proto.NodeClient, error) {
-	conn, err := grpc.Dial(listenAddr, grpc.WithInsecure())
+func makeNodeClient(listenAddr string, opts ...grpc.DialOption) (proto.NodeClient, *grpc.ClientConn, error) {
+	conn, err := TCPTransport{}.Dial(listenAddr, opts...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return proto.NewNodeClient(conn), nil
+	return proto.NewNodeClient(conn), conn, nil
 }
@@ -0,0 +1,129 @@
+package nodes
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+// requireNoLeakedGoroutines waits for the goroutine count to drop back to
+// before, since grpc tears down transports asynchronously.
+func requireNoLeakedGoroutines(t *testing.T, before int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("leaked %d goroutines:\n%s", runtime.NumGoroutine()-before, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNodeStartReturnsOnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := NewNode(ServerConfig{ListenAddr: "127.0.0.1:0"})
+
+	errc := make(chan error)
+	go func() { errc <- n.Start(ctx) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errc:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after the context was cancelled")
+	}
+}
+
+func TestNodeStopWithoutStart(t *testing.T) {
+	n := NewNode(ServerConfig{ListenAddr: "127.0.0.1:0"})
+	n.Stop()
+	n.Stop()
+
+	assert.Nil(t, n.Start(context.Background()))
+}
+
+func TestNodeStopDoesNotLeakGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	var nodes []*Node
+	var addrs []string
+	for i := 0; i < 3; i++ {
+		n, addr := startNode(t, append([]string{}, addrs...))
+		nodes = append(nodes, n)
+		addrs = append(addrs, addr)
+	}
+
+	require.Eventually(t, func() bool {
+		for _, n := range nodes {
+			if len(n.getPeerList()) != len(nodes)-1 {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		nodes[i%len(nodes)].processTransaction(randomTransaction(), nil)
+	}
+
+	for _, n := range nodes {
+		n.Stop()
+	}
+
+	for _, n := range nodes {
+		assert.Equal(t, 0, n.mempool.Len())
+		assert.Empty(t, n.getPeerList())
+	}
+
+	requireNoLeakedGoroutines(t, before)
+}
+
+func TestValidatorLoopStops(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	n := NewNode(ServerConfig{
+		ListenAddr: "127.0.0.1:0",
+		PrivateKey: encrypted.GeneratePrivateKey(),
+	})
+	n.spawn(n.validatorLoop)
+	n.Stop()
+
+	requireNoLeakedGoroutines(t, before)
+}
+
+func TestBlockTemplatesHoldLockedTransactions(t *testing.T) {
+	genesis := Genesis{
+		Allocations: map[string]int64{premineKey.Public().Address().String(): 1000},
+		Upgrades:    UpgradeSchedule{{Name: "timelocks", Height: 1, Version: RulesTimelocks}},
+	}
+	n := NewNode(ServerConfig{ListenAddr: "127.0.0.1:0", PrivateKey: encrypted.GeneratePrivateKey(), Genesis: genesis})
+	premine := mustBlock(t, n.chain, 0).Transactions[0]
+
+	tx := signTx(premineKey, &proto.Transaction{
+		Version:  RulesTimelocks,
+		Inputs:   []*proto.TxInput{{PrevTxHash: types.HashTransaction(premine), PublicKey: premineKey.Public().Bytes()}},
+		Outputs:  []*proto.TxOutput{{Amount: 1000, Address: premineKey.Public().Address().Bytes()}},
+		ChainId:  n.chain.ChainID(),
+		LockTime: 2,
+	})
+	require.Nil(t, n.processTransaction(tx, nil))
+
+	block := randomNodeBlock(t, n)
+	assert.Empty(t, block.Transactions)
+	assert.Equal(t, 1, n.mempool.Len())
+	require.Nil(t, n.addBlock(block))
+
+	block = randomNodeBlock(t, n)
+	require.Len(t, block.Transactions, 1)
+	require.Nil(t, n.addBlock(block))
+}
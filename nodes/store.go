@@ -12,6 +12,8 @@ import (
 type UTXOStorer interface {
 	Put(*UTXO) error
 	Get(string) (*UTXO, error)
+	Delete(string) error
+	List() ([]*UTXO, error)
 }
 
 type MemoryUTXOStore struct {
@@ -47,6 +49,27 @@ func (m *MemoryUTXOStore) Get(hash string) (*UTXO, error) {
 	return utxo, nil
 }
 
+func (m *MemoryUTXOStore) Delete(hash string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.data, hash)
+
+	return nil
+}
+
+func (m *MemoryUTXOStore) List() ([]*UTXO, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	utxos := make([]*UTXO, 0, len(m.data))
+	for _, utxo := range m.data {
+		utxos = append(utxos, utxo)
+	}
+
+	return utxos, nil
+}
+
 type TXStorer interface {
 	Put(*proto.Transaction) error
 	Get(string) (*proto.Transaction, error)
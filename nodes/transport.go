@@ -0,0 +1,270 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const memoryBufferSize = 1 << 20
+
+// Transport is how a node listens for and connects to peers.
+type Transport interface {
+	Listen(addr string) (net.Listener, error)
+	Dial(addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error)
+}
+
+// TCPTransport connects nodes over the network.
+type TCPTransport struct{}
+
+func (TCPTransport) Listen(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+func (TCPTransport) Dial(addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	return grpc.Dial(addr, opts...)
+}
+
+// Call is a call from one address to another over a MemoryNetwork.
+type Call struct {
+	From    string
+	To      string
+	Method  string
+	Request any
+}
+
+// LinkFunc is consulted before every call. It may block to model latency;
+// returning an error drops the call.
+type LinkFunc func(ctx context.Context, call Call) error
+
+// MemoryNetwork connects nodes in-process over buffered pipes. Every node
+// gets its own view of the network from Transport, so calls know which
+// address they come from.
+type MemoryNetwork struct {
+	lock      sync.RWMutex
+	listeners map[string]*memoryListener
+	link      LinkFunc
+	pending   int64
+	events    uint64
+}
+
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		listeners: make(map[string]*memoryListener),
+	}
+}
+
+// SetLink installs the function deciding the fate of every call.
+func (m *MemoryNetwork) SetLink(link LinkFunc) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.link = link
+}
+
+// InFlight returns the number of calls that have not completed yet.
+func (m *MemoryNetwork) InFlight() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return int(m.pending)
+}
+
+// Events counts calls started and completed, so callers can tell whether
+// the network is still busy.
+func (m *MemoryNetwork) Events() uint64 {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.events
+}
+
+func (m *MemoryNetwork) Listening(addr string) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	_, ok := m.listeners[addr]
+
+	return ok
+}
+
+func (m *MemoryNetwork) Transport(addr string) Transport {
+	return &memoryTransport{network: m, addr: addr}
+}
+
+func (m *MemoryNetwork) track(delta int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.pending += delta
+	m.events++
+}
+
+func (m *MemoryNetwork) getLink() LinkFunc {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.link
+}
+
+type memoryTransport struct {
+	network *MemoryNetwork
+	addr    string
+}
+
+// Listen binds addr. A wildcard host binds the host of the transport's own
+// address, like listening on all interfaces of a machine.
+func (t *memoryTransport) Listen(addr string) (net.Listener, error) {
+	bind := withHost(addr, t.addr)
+
+	t.network.lock.Lock()
+	defer t.network.lock.Unlock()
+
+	if _, ok := t.network.listeners[bind]; ok {
+		return nil, fmt.Errorf("address %s already in use", bind)
+	}
+
+	ln := &memoryListener{
+		Listener: bufconn.Listen(memoryBufferSize),
+		network:  t.network,
+		addr:     memoryAddr(addr),
+		bind:     bind,
+	}
+	t.network.listeners[bind] = ln
+
+	return ln, nil
+}
+
+func (t *memoryTransport) Dial(addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	dialer := func(ctx context.Context, target string) (net.Conn, error) {
+		t.network.lock.RLock()
+		ln, ok := t.network.listeners[target]
+		t.network.lock.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("no node listening on %s", target)
+		}
+
+		conn, err := ln.DialContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// tell the listener who is calling, the way a TCP peer address would
+		if _, err := conn.Write(append([]byte{byte(len(t.addr))}, t.addr...)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return &memoryConn{Conn: conn, local: memoryAddr(t.addr), remote: memoryAddr(target)}, nil
+	}
+
+	opts = append(opts,
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(t.interceptor(addr)),
+	)
+
+	return grpc.Dial(addr, opts...)
+}
+
+func (t *memoryTransport) interceptor(to string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		t.network.track(1)
+		defer t.network.track(-1)
+
+		if link := t.network.getLink(); link != nil {
+			if err := link(ctx, Call{From: t.addr, To: to, Method: method, Request: req}); err != nil {
+				return status.Error(codes.Unavailable, err.Error())
+			}
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+type memoryListener struct {
+	*bufconn.Listener
+	network *MemoryNetwork
+	addr    memoryAddr
+	bind    string
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		from, err := readPreamble(conn)
+		if err != nil {
+			conn.Close()
+			continue
+		}
+
+		return &memoryConn{Conn: conn, local: l.addr, remote: memoryAddr(from)}, nil
+	}
+}
+
+func (l *memoryListener) Close() error {
+	l.network.lock.Lock()
+	if l.network.listeners[l.bind] == l {
+		delete(l.network.listeners, l.bind)
+	}
+	l.network.lock.Unlock()
+
+	return l.Listener.Close()
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return l.addr
+}
+
+func readPreamble(conn net.Conn) (string, error) {
+	size := make([]byte, 1)
+	if _, err := conn.Read(size); err != nil {
+		return "", err
+	}
+
+	from := make([]byte, size[0])
+	for read := 0; read < len(from); {
+		n, err := conn.Read(from[read:])
+		if err != nil {
+			return "", err
+		}
+		read += n
+	}
+
+	return string(from), nil
+}
+
+type memoryConn struct {
+	net.Conn
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *memoryConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *memoryConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+type memoryAddr string
+
+func (a memoryAddr) Network() string {
+	return "memory"
+}
+
+func (a memoryAddr) String() string {
+	return string(a)
+}
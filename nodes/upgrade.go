@@ -0,0 +1,140 @@
+package nodes
+
+import (
+	"fmt"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// Versions of the consensus rules. Blocks declare the version in force at
+// their height in Header.Version, transactions may declare any version up
+// to it.
+const (
+	RulesGenesis int32 = 1
+	// RulesStrictTransactions rejects transactions that spend an output more
+	// than once or create outputs without a positive amount.
+	RulesStrictTransactions int32 = 2
+	// RulesMultisig allows m-of-n multisig outputs.
+	RulesMultisig int32 = 3
+	// RulesTimelocks enforces transaction lock times and relative locks of
+	// inputs.
+	RulesTimelocks int32 = 4
+	// RulesHTLC allows hash time-locked outputs.
+	RulesHTLC int32 = 5
+	// RulesScript allows outputs locked by scripts.
+	RulesScript int32 = 6
+
+	// MaxRules is the newest rules version this node implements.
+	MaxRules = RulesScript
+)
+
+// Rules are the consensus rules of one version.
+type Rules struct {
+	Version            int32
+	StrictTransactions bool
+	Multisig           bool
+	Timelocks          bool
+	HTLC               bool
+	Script             bool
+}
+
+func rulesOf(version int32) Rules {
+	return Rules{
+		Version:            version,
+		StrictTransactions: version >= RulesStrictTransactions,
+		Multisig:           version >= RulesMultisig,
+		Timelocks:          version >= RulesTimelocks,
+		HTLC:               version >= RulesHTLC,
+		Script:             version >= RulesScript,
+	}
+}
+
+// Upgrade activates the rules of Version from Height on.
+type Upgrade struct {
+	Name    string `json:"name"`
+	Height  int32  `json:"height"`
+	Version int32  `json:"version"`
+}
+
+// UpgradeSchedule lists the upgrades of a chain by height. Blocks below the
+// first upgrade follow RulesGenesis.
+type UpgradeSchedule []Upgrade
+
+// Validate checks that heights and versions strictly increase.
+func (s UpgradeSchedule) Validate() error {
+	var (
+		height  int32
+		version = RulesGenesis
+	)
+	for _, u := range s {
+		if u.Height <= height {
+			return errors.Wrapf(errors.ErrInvalidHeight, "upgrade %q at height %d does not follow height %d", u.Name, u.Height, height)
+		}
+		if u.Version <= version {
+			return errors.Wrapf(errors.ErrInvalidVersion, "upgrade %q to rules %d does not follow rules %d", u.Name, u.Version, version)
+		}
+		height, version = u.Height, u.Version
+	}
+
+	return nil
+}
+
+// Rules returns the rules in force at height. Once an upgrade to rules this
+// node does not implement activates, it fails with ErrNotSupported.
+func (s UpgradeSchedule) Rules(height int32) (Rules, error) {
+	version := RulesGenesis
+	for _, u := range s {
+		if u.Height > height {
+			break
+		}
+		if u.Version > MaxRules {
+			return Rules{}, errors.Wrapf(errors.ErrNotSupported, "upgrade %q to rules %d at height %d", u.Name, u.Version, u.Height)
+		}
+		version = u.Version
+	}
+
+	return rulesOf(version), nil
+}
+
+// checkStrictTransaction applies the checks of RulesStrictTransactions.
+func checkStrictTransaction(tx *proto.Transaction, hash string) error {
+	spent := make(map[string]bool, len(tx.Inputs))
+	for i, input := range tx.Inputs {
+		key := utxoKey(input.PrevTxHash, input.PrevOutIndex)
+		if spent[key] {
+			return fmt.Errorf("input %d of transaction %s spends an output twice", i, hash)
+		}
+		spent[key] = true
+	}
+	for i, output := range tx.Outputs {
+		if output.Amount <= 0 {
+			return fmt.Errorf("output %d of transaction %s has no positive amount", i, hash)
+		}
+	}
+
+	return nil
+}
+
+// addBlock adds a block to the chain and halts the node once the next block
+// needs rules it does not implement.
+func (n *Node) addBlock(block *proto.Block) error {
+	if err := n.chain.AddBlock(block); err != nil {
+		return err
+	}
+	n.checkUpgrade()
+
+	return nil
+}
+
+// checkUpgrade halts the node and returns false if the block extending the
+// tip needs an upgrade this node does not implement.
+func (n *Node) checkUpgrade() bool {
+	if _, err := n.chain.NextRules(); err != nil {
+		n.logger.Errorw("Halting node, it does not support the next upgrade", "height", n.chain.Height()+1, "error", err)
+		n.halt(err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,106 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/consensus"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+)
+
+func TestUpgradeSchedule(t *testing.T) {
+	schedule := UpgradeSchedule{
+		{Name: "strict", Height: 10, Version: RulesStrictTransactions},
+		{Name: "future", Height: 20, Version: MaxRules + 1},
+	}
+	require.Nil(t, schedule.Validate())
+
+	rules, err := schedule.Rules(9)
+	require.Nil(t, err)
+	assert.Equal(t, rulesOf(RulesGenesis), rules)
+
+	rules, err = schedule.Rules(10)
+	require.Nil(t, err)
+	assert.True(t, rules.StrictTransactions)
+
+	_, err = schedule.Rules(20)
+	assert.True(t, errors.IsOf(err, errors.ErrNotSupported))
+
+	assert.NotNil(t, UpgradeSchedule{{Height: 0, Version: 2}}.Validate())
+	assert.NotNil(t, UpgradeSchedule{{Height: 5, Version: 2}, {Height: 5, Version: 3}}.Validate())
+	assert.NotNil(t, UpgradeSchedule{{Height: 5, Version: 3}, {Height: 6, Version: 2}}.Validate())
+}
+
+func TestChainFollowsUpgrades(t *testing.T) {
+	var (
+		upgrades = UpgradeSchedule{{Name: "strict", Height: 2, Version: RulesStrictTransactions}}
+		chain    = NewChain(NewMemoryBlockStore(), NewMemoryTXStore(), consensus.NewSingleAuthority(authorityKey.Public()), testGenesis(Genesis{}), upgrades)
+		genesis  = mustBlock(t, chain, 0)
+		prev     = genesis.Transactions[0]
+	)
+
+	// spends the premine twice in one transaction
+	tx := &proto.Transaction{
+		Version: RulesGenesis,
+		Inputs: []*proto.TxInput{
+			{PrevTxHash: types.HashTransaction(prev), PublicKey: premineKey.Public().Bytes()},
+			{PrevTxHash: types.HashTransaction(prev), PublicKey: premineKey.Public().Bytes()},
+		},
+		Outputs: []*proto.TxOutput{{Amount: 2000, Address: premineKey.Public().Address().Bytes()}},
+	}
+	signTx(premineKey, tx)
+
+	rules, err := chain.NextRules()
+	require.Nil(t, err)
+	assert.False(t, rules.StrictTransactions)
+
+	require.Nil(t, chain.AddBlock(randomBlock(t, chain)))
+	rules, err = chain.NextRules()
+	require.Nil(t, err)
+	assert.True(t, rules.StrictTransactions)
+	assert.NotNil(t, chain.ValidateTransaction(tx))
+
+	// blocks past the upgrade have to declare its rules
+	block := randomBlock(t, chain)
+	assert.True(t, errors.IsOf(chain.AddBlock(block), errors.ErrInvalidVersion))
+
+	block.Header.Version = RulesStrictTransactions
+	types.SignBlock(authorityKey, block)
+	require.Nil(t, chain.AddBlock(block))
+
+	tx.Version = RulesStrictTransactions + 1
+	assert.True(t, errors.IsOf(chain.ValidateTransaction(tx), errors.ErrInvalidVersion))
+}
+
+func TestNodeHaltsAtUnsupportedUpgrade(t *testing.T) {
+	upgrades := UpgradeSchedule{{Name: "future", Height: 2, Version: MaxRules + 1}}
+	n := NewNode(ServerConfig{ListenAddr: "127.0.0.1:0", PrivateKey: encrypted.GeneratePrivateKey(), Genesis: Genesis{Upgrades: upgrades}})
+
+	require.Nil(t, n.addBlock(randomNodeBlock(t, n)))
+	err := n.haltErr()
+	assert.True(t, errors.IsOf(err, errors.ErrNotSupported))
+
+	// a halted node does not start again
+	assert.Equal(t, err, n.Start(context.Background()))
+}
+
+func mustBlock(t *testing.T, chain *Chain, height int) *proto.Block {
+	block, err := chain.GetBlockByHeight(height)
+	require.Nil(t, err)
+
+	return block
+}
+
+// randomNodeBlock returns a block extending the tip of n, sealed by its own
+// key as the single authority.
+func randomNodeBlock(t *testing.T, n *Node) *proto.Block {
+	block, err := n.createBlock(context.Background(), n.Clock.Now())
+	require.Nil(t, err)
+
+	return block
+}
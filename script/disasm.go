@@ -0,0 +1,91 @@
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// Disassemble returns script as text for debugging: opcodes by name and
+// pushed data in hex. A script that does not parse is disassembled up to
+// the error, followed by "[error]", and the error is returned as well.
+func Disassemble(script []byte) (string, error) {
+	instructions, err := parse(script)
+
+	words := make([]string, 0, len(instructions)+1)
+	for _, in := range instructions {
+		switch {
+		case in.op > Op0 && in.op <= OpPushData1:
+			words = append(words, hex.EncodeToString(in.data))
+		default:
+			words = append(words, in.op.String())
+		}
+	}
+	if err != nil {
+		words = append(words, "[error]")
+	}
+
+	return strings.Join(words, " "), err
+}
+
+// Builder builds a script from opcodes and data, choosing the push opcode
+// for each element.
+type Builder struct {
+	script []byte
+	err    error
+}
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// AddOp appends op.
+func (b *Builder) AddOp(op Opcode) *Builder {
+	b.script = append(b.script, byte(op))
+	return b
+}
+
+// AddData appends a push of data.
+func (b *Builder) AddData(data []byte) *Builder {
+	switch {
+	case len(data) > MaxElementSize:
+		b.err = errors.Wrapf(errors.ErrScript, "push of %d bytes, at most %d are allowed", len(data), MaxElementSize)
+		return b
+	case len(data) == 0:
+		b.script = append(b.script, byte(Op0))
+	case len(data) < int(OpPushData1):
+		b.script = append(b.script, byte(len(data)))
+	default:
+		b.script = append(b.script, byte(OpPushData1), byte(len(data)))
+	}
+	b.script = append(b.script, data...)
+
+	return b
+}
+
+// AddNumber appends a push of n, with Op1 to Op16 for small numbers.
+func (b *Builder) AddNumber(n int64) *Builder {
+	if n >= 1 && n <= 16 {
+		return b.AddOp(Op1 + Opcode(n-1))
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	data := buf[:]
+	for len(data) > 0 && data[0] == 0 {
+		data = data[1:]
+	}
+
+	return b.AddData(data)
+}
+
+// Script returns the script built so far and checks it like Check.
+func (b *Builder) Script() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	return b.script, Check(b.script)
+}
@@ -0,0 +1,27 @@
+package script
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisassemble(t *testing.T) {
+	locking := build(t, NewBuilder().
+		AddOp(OpSHA256).AddData([]byte{0xab, 0xcd}).AddOp(OpEqualVerify).
+		AddNumber(2).AddNumber(1000).AddOp(OpCheckLockTimeVerify).AddOp(OpCheckMultisig))
+
+	text, err := Disassemble(locking)
+	require.Nil(t, err)
+	assert.Equal(t, "OP_SHA256 abcd OP_EQUALVERIFY OP_2 03e8 OP_CHECKLOCKTIMEVERIFY OP_CHECKMULTISIG", text)
+
+	// a push past the end disassembles up to it
+	text, err = Disassemble([]byte{byte(OpDup), 0x05, 0x01})
+	assert.NotNil(t, err)
+	assert.Equal(t, "OP_DUP [error]", text)
+
+	text, err = Disassemble([]byte{0xff})
+	require.Nil(t, err)
+	assert.Equal(t, "OP_UNKNOWN_0xff", text)
+}
@@ -0,0 +1,350 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// Limits keep the cost of running a script small and predictable.
+const (
+	// MaxScriptSize is the largest locking or unlocking script.
+	MaxScriptSize = 1024
+	// MaxElementSize is the largest element a script can push, the most
+	// OpPushData1 can encode.
+	MaxElementSize = 255
+	// MaxOps is the most opcodes other than pushes a locking and unlocking
+	// script can run together.
+	MaxOps = 64
+	// MaxStackSize is the most elements the stack can hold.
+	MaxStackSize = 100
+	// MaxMultisigKeys is the most public keys of an OpCheckMultisig.
+	MaxMultisigKeys = 16
+)
+
+// Checker gives a script access to the transaction spending the output it
+// locks.
+type Checker interface {
+	// CheckSig reports whether signature of publicKey signs the spending
+	// input.
+	CheckSig(publicKey, signature []byte) bool
+	// CheckLockTime reports whether the spending transaction is locked
+	// until at least lockTime.
+	CheckLockTime(lockTime int64) bool
+}
+
+// instruction is a parsed opcode with the data it pushes.
+type instruction struct {
+	op   Opcode
+	data []byte
+}
+
+// parse splits script into instructions, checking its size. On error it also returns the instructions before the
+// one that failed.
+func parse(script []byte) ([]instruction, error) {
+	if len(script) > MaxScriptSize {
+		return nil, errors.Wrapf(errors.ErrScript, "script of %d bytes, at most %d are allowed", len(script), MaxScriptSize)
+	}
+
+	var instructions []instruction
+	for i := 0; i < len(script); {
+		op := Opcode(script[i])
+		i++
+
+		var n int
+		switch {
+		case op > Op0 && op < OpPushData1:
+			n = int(op)
+		case op == OpPushData1:
+			if i >= len(script) {
+				return instructions, errors.Wrap(errors.ErrScript, "OP_PUSHDATA1 without length")
+			}
+			n = int(script[i])
+			i++
+		}
+		if i+n > len(script) {
+			return instructions, errors.Wrapf(errors.ErrScript, "%s past the end of the script", op)
+		}
+
+		instructions = append(instructions, instruction{op: op, data: script[i : i+n]})
+		i += n
+	}
+
+	return instructions, nil
+}
+
+// Check checks that script parses within the limits and uses only known
+// opcodes.
+func Check(script []byte) error {
+	instructions, err := parse(script)
+	if err != nil {
+		return err
+	}
+	for _, in := range instructions {
+		if _, ok := opcodeNames[in.op]; !ok && !in.op.isPush() {
+			return errors.Wrapf(errors.ErrScript, "unknown opcode %s", in.op)
+		}
+	}
+
+	return nil
+}
+
+// Execute runs unlocking, which may only push data, and then locking on the
+// stack it leaves. It succeeds if locking ends with a true element on top
+// of the stack, and wraps ErrScript otherwise.
+func Execute(unlocking, locking []byte, checker Checker) error {
+	e := &engine{checker: checker}
+
+	instructions, err := parse(unlocking)
+	if err != nil {
+		return errors.Wrap(err, "unlocking script")
+	}
+	for _, in := range instructions {
+		if !in.op.isPush() {
+			return errors.Wrapf(errors.ErrScript, "unlocking script runs %s, it may only push data", in.op)
+		}
+	}
+	if err := e.run(instructions); err != nil {
+		return errors.Wrap(err, "unlocking script")
+	}
+
+	instructions, err = parse(locking)
+	if err != nil {
+		return errors.Wrap(err, "locking script")
+	}
+	if err := e.run(instructions); err != nil {
+		return errors.Wrap(err, "locking script")
+	}
+
+	if len(e.stack) == 0 || !isTrue(e.stack[len(e.stack)-1]) {
+		return errors.Wrap(errors.ErrScript, "script ends without true on the stack")
+	}
+
+	return nil
+}
+
+type engine struct {
+	checker Checker
+	stack   [][]byte
+	ops     int
+}
+
+func (e *engine) run(instructions []instruction) error {
+	for _, in := range instructions {
+		if !in.op.isPush() {
+			e.ops++
+			if e.ops > MaxOps {
+				return errors.Wrapf(errors.ErrScript, "more than %d opcodes", MaxOps)
+			}
+		}
+		if err := e.step(in); err != nil {
+			return err
+		}
+		if len(e.stack) > MaxStackSize {
+			return errors.Wrapf(errors.ErrScript, "stack of more than %d elements", MaxStackSize)
+		}
+	}
+
+	return nil
+}
+
+func (e *engine) step(in instruction) error {
+	switch op := in.op; {
+	case op < OpPushData1 || op == OpPushData1:
+		e.push(in.data)
+	case op >= Op1 && op <= Op16:
+		e.push([]byte{byte(op - Op1 + 1)})
+
+	case op == OpVerify:
+		return e.verify(op)
+	case op == OpDrop:
+		_, err := e.pop(op)
+		return err
+	case op == OpDup:
+		top, err := e.pop(op)
+		if err != nil {
+			return err
+		}
+		e.push(top)
+		e.push(top)
+	case op == OpEqual || op == OpEqualVerify:
+		a, err := e.pop(op)
+		if err != nil {
+			return err
+		}
+		b, err := e.pop(op)
+		if err != nil {
+			return err
+		}
+		return e.result(op, bytes.Equal(a, b), OpEqualVerify)
+	case op == OpSHA256:
+		top, err := e.pop(op)
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(top)
+		e.push(hash[:])
+	case op == OpCheckSig || op == OpCheckSigVerify:
+		publicKey, err := e.pop(op)
+		if err != nil {
+			return err
+		}
+		signature, err := e.pop(op)
+		if err != nil {
+			return err
+		}
+		return e.result(op, e.checker.CheckSig(publicKey, signature), OpCheckSigVerify)
+	case op == OpCheckMultisig || op == OpCheckMultisigVerify:
+		ok, err := e.checkMultisig(op)
+		if err != nil {
+			return err
+		}
+		return e.result(op, ok, OpCheckMultisigVerify)
+	case op == OpCheckLockTimeVerify:
+		lockTime, err := e.popNumber(op)
+		if err != nil {
+			return err
+		}
+		if !e.checker.CheckLockTime(lockTime) {
+			return errors.Wrapf(errors.ErrScript, "transaction is not locked until %d", lockTime)
+		}
+
+	default:
+		return errors.Wrapf(errors.ErrScript, "unknown opcode %s", op)
+	}
+
+	return nil
+}
+
+// checkMultisig matches the signatures to the keys in order, so every key
+// is tried against one signature at most.
+func (e *engine) checkMultisig(op Opcode) (bool, error) {
+	n, err := e.popNumber(op)
+	if err != nil {
+		return false, err
+	}
+	if n < 1 || n > MaxMultisigKeys {
+		return false, errors.Wrapf(errors.ErrScript, "%s of %d keys", op, n)
+	}
+	keys, err := e.popN(op, int(n))
+	if err != nil {
+		return false, err
+	}
+	m, err := e.popNumber(op)
+	if err != nil {
+		return false, err
+	}
+	if m < 1 || m > n {
+		return false, errors.Wrapf(errors.ErrScript, "%s of %d signatures for %d keys", op, m, n)
+	}
+	signatures, err := e.popN(op, int(m))
+	if err != nil {
+		return false, err
+	}
+
+	for len(signatures) > 0 {
+		if len(keys) < len(signatures) {
+			return false, nil
+		}
+		if e.checker.CheckSig(keys[0], signatures[0]) {
+			signatures = signatures[1:]
+		}
+		keys = keys[1:]
+	}
+
+	return true, nil
+}
+
+// result pushes ok, or checks it right away for the verify variant of op.
+func (e *engine) result(op Opcode, ok bool, verifyOp Opcode) error {
+	if op != verifyOp {
+		e.push(boolElement(ok))
+		return nil
+	}
+	if !ok {
+		return errors.Wrapf(errors.ErrScript, "%s failed", op)
+	}
+
+	return nil
+}
+
+func (e *engine) verify(op Opcode) error {
+	top, err := e.pop(op)
+	if err != nil {
+		return err
+	}
+	if !isTrue(top) {
+		return errors.Wrapf(errors.ErrScript, "%s failed", op)
+	}
+
+	return nil
+}
+
+func (e *engine) push(element []byte) {
+	e.stack = append(e.stack, element)
+}
+
+func (e *engine) pop(op Opcode) ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, errors.Wrapf(errors.ErrScript, "%s on an empty stack", op)
+	}
+	top := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+
+	return top, nil
+}
+
+// popN pops n elements and returns them in the order they were pushed.
+func (e *engine) popN(op Opcode, n int) ([][]byte, error) {
+	if len(e.stack) < n {
+		return nil, errors.Wrapf(errors.ErrScript, "%s needs %d elements, the stack has %d", op, n, len(e.stack))
+	}
+	elements := make([][]byte, n)
+	copy(elements, e.stack[len(e.stack)-n:])
+	e.stack = e.stack[:len(e.stack)-n]
+
+	return elements, nil
+}
+
+// popNumber pops a number, an unsigned big-endian integer of at most 8
+// bytes that fits an int64.
+func (e *engine) popNumber(op Opcode) (int64, error) {
+	top, err := e.pop(op)
+	if err != nil {
+		return 0, err
+	}
+	if len(top) > 8 {
+		return 0, errors.Wrapf(errors.ErrScript, "%s on a number of %d bytes", op, len(top))
+	}
+
+	var b [8]byte
+	copy(b[8-len(top):], top)
+	n := binary.BigEndian.Uint64(b[:])
+	if n > 1<<63-1 {
+		return 0, errors.Wrapf(errors.ErrScript, "%s on a number out of range", op)
+	}
+
+	return int64(n), nil
+}
+
+// isTrue reports whether element is true, which it is unless empty or all
+// zero bytes.
+func isTrue(element []byte) bool {
+	for _, b := range element {
+		if b != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func boolElement(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+
+	return nil
+}
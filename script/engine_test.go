@@ -0,0 +1,107 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// testChecker accepts a signature that equals the public key it is
+// checked against with a "sig" prefix.
+type testChecker struct {
+	lockTime int64
+}
+
+func (c testChecker) CheckSig(publicKey, signature []byte) bool {
+	return bytes.Equal(signature, append([]byte("sig"), publicKey...))
+}
+
+func (c testChecker) CheckLockTime(lockTime int64) bool {
+	return c.lockTime >= lockTime
+}
+
+func sig(key string) []byte {
+	return []byte("sig" + key)
+}
+
+func build(t *testing.T, b *Builder) []byte {
+	script, err := b.Script()
+	require.Nil(t, err)
+
+	return script
+}
+
+func TestExecute(t *testing.T) {
+	preimage := []byte("preimage")
+	hash := sha256.Sum256(preimage)
+
+	var (
+		payToKey = build(t, NewBuilder().AddData([]byte("alice")).AddOp(OpCheckSig))
+		hashLock = build(t, NewBuilder().AddOp(OpSHA256).AddData(hash[:]).AddOp(OpEqualVerify).AddData([]byte("bob")).AddOp(OpCheckSig))
+		multisig = build(t, NewBuilder().AddNumber(2).AddData([]byte("a")).AddData([]byte("b")).AddData([]byte("c")).AddNumber(3).AddOp(OpCheckMultisig))
+		timeLock = build(t, NewBuilder().AddNumber(100).AddOp(OpCheckLockTimeVerify).AddData([]byte("alice")).AddOp(OpCheckSig))
+	)
+
+	tests := []struct {
+		name      string
+		unlocking *Builder
+		locking   []byte
+		lockTime  int64
+		ok        bool
+	}{
+		{"key", NewBuilder().AddData(sig("alice")), payToKey, 0, true},
+		{"wrong key", NewBuilder().AddData(sig("bob")), payToKey, 0, false},
+		{"hash lock", NewBuilder().AddData(sig("bob")).AddData(preimage), hashLock, 0, true},
+		{"wrong preimage", NewBuilder().AddData(sig("bob")).AddData([]byte("guess")), hashLock, 0, false},
+		{"multisig", NewBuilder().AddData(sig("a")).AddData(sig("c")), multisig, 0, true},
+		{"multisig out of order", NewBuilder().AddData(sig("c")).AddData(sig("a")), multisig, 0, false},
+		{"multisig below threshold", NewBuilder().AddData(sig("a")).AddData(sig("x")), multisig, 0, false},
+		{"time lock", NewBuilder().AddData(sig("alice")), timeLock, 100, true},
+		{"time lock early", NewBuilder().AddData(sig("alice")), timeLock, 99, false},
+		{"empty stack", NewBuilder(), build(t, NewBuilder().AddOp(OpVerify)), 0, false},
+		{"false on top", NewBuilder().AddData([]byte{0, 0}), nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Execute(build(t, tt.unlocking), tt.locking, testChecker{lockTime: tt.lockTime})
+			if tt.ok {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.IsOf(err, errors.ErrScript), "%v", err)
+			}
+		})
+	}
+}
+
+func TestExecuteLimits(t *testing.T) {
+	checker := testChecker{}
+
+	// unlocking scripts only push data
+	unlocking := build(t, NewBuilder().AddNumber(1).AddOp(OpDup))
+	assert.NotNil(t, Execute(unlocking, nil, checker))
+
+	// too many opcodes
+	b := NewBuilder().AddNumber(1)
+	for i := 0; i < MaxOps+1; i++ {
+		b.AddOp(OpDup).AddOp(OpDrop)
+	}
+	assert.NotNil(t, Execute(nil, b.script, checker))
+
+	// too many elements
+	b = NewBuilder()
+	for i := 0; i < MaxStackSize+1; i++ {
+		b.AddNumber(1)
+	}
+	assert.NotNil(t, Execute(build(t, b), nil, checker))
+
+	// too long, too large elements and unknown opcodes
+	assert.NotNil(t, Execute(nil, make([]byte, MaxScriptSize+1), checker))
+	_, err := NewBuilder().AddData(make([]byte, MaxElementSize+1)).Script()
+	assert.NotNil(t, err)
+	assert.NotNil(t, Check([]byte{0xff}))
+	assert.NotNil(t, Execute(build(t, NewBuilder().AddNumber(1)), []byte{0xff}, checker))
+}
@@ -0,0 +1,83 @@
+// Package script implements the script language that locks outputs of type
+// OUTPUT_SCRIPT. A script is a sequence of opcodes run on a stack of byte
+// strings. It has no jumps or loops, so every script runs at most once
+// through and its cost is bounded by its size.
+package script
+
+import "fmt"
+
+// Opcode is a single script instruction. Opcodes follow the numbering of
+// the Bitcoin opcodes they mirror.
+type Opcode byte
+
+const (
+	// Op0 pushes an empty element, which is false.
+	Op0 Opcode = 0x00
+	// OpPushData1 pushes the number of bytes given by the next byte. Opcodes
+	// 0x01 to 0x4b push that many bytes.
+	OpPushData1 Opcode = 0x4c
+	// Op1 to Op16 push the numbers 1 to 16.
+	Op1  Opcode = 0x51
+	Op16 Opcode = 0x60
+
+	// OpVerify pops the top element and fails unless it is true.
+	OpVerify Opcode = 0x69
+	// OpDrop pops the top element.
+	OpDrop Opcode = 0x75
+	// OpDup pushes a copy of the top element.
+	OpDup Opcode = 0x76
+	// OpEqual pops two elements and pushes whether they are equal.
+	OpEqual Opcode = 0x87
+	// OpEqualVerify is OpEqual followed by OpVerify.
+	OpEqualVerify Opcode = 0x88
+	// OpSHA256 replaces the top element with its SHA256.
+	OpSHA256 Opcode = 0xa8
+	// OpCheckSig pops a public key and a signature below it and pushes
+	// whether the signature signs the spending input.
+	OpCheckSig Opcode = 0xac
+	// OpCheckSigVerify is OpCheckSig followed by OpVerify.
+	OpCheckSigVerify Opcode = 0xad
+	// OpCheckMultisig pops n, n public keys, m and m signatures and pushes
+	// whether the signatures are valid for m of the keys, in key order.
+	OpCheckMultisig Opcode = 0xae
+	// OpCheckMultisigVerify is OpCheckMultisig followed by OpVerify.
+	OpCheckMultisigVerify Opcode = 0xaf
+	// OpCheckLockTimeVerify pops a lock time and fails unless the spending
+	// transaction is locked at least until then, see types.LockTimeThreshold.
+	OpCheckLockTimeVerify Opcode = 0xb1
+)
+
+var opcodeNames = map[Opcode]string{
+	Op0:                   "OP_0",
+	OpPushData1:           "OP_PUSHDATA1",
+	OpVerify:              "OP_VERIFY",
+	OpDrop:                "OP_DROP",
+	OpDup:                 "OP_DUP",
+	OpEqual:               "OP_EQUAL",
+	OpEqualVerify:         "OP_EQUALVERIFY",
+	OpSHA256:              "OP_SHA256",
+	OpCheckSig:            "OP_CHECKSIG",
+	OpCheckSigVerify:      "OP_CHECKSIGVERIFY",
+	OpCheckMultisig:       "OP_CHECKMULTISIG",
+	OpCheckMultisigVerify: "OP_CHECKMULTISIGVERIFY",
+	OpCheckLockTimeVerify: "OP_CHECKLOCKTIMEVERIFY",
+}
+
+func (op Opcode) String() string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+	if op >= Op1 && op <= Op16 {
+		return fmt.Sprintf("OP_%d", op-Op1+1)
+	}
+	if op > Op0 && op < OpPushData1 {
+		return fmt.Sprintf("OP_DATA_%d", op)
+	}
+
+	return fmt.Sprintf("OP_UNKNOWN_%#02x", byte(op))
+}
+
+// isPush reports whether op only pushes data.
+func (op Opcode) isPush() bool {
+	return op <= Op16 && (op <= OpPushData1 || op >= Op1)
+}
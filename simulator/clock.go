@@ -0,0 +1,115 @@
+package simulator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/nodes"
+)
+
+// ManualClock is a nodes.Clock that only moves when Advance is called.
+type ManualClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*waiter
+}
+
+type waiter struct {
+	at     time.Time
+	period time.Duration
+	ch     chan time.Time
+}
+
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	w := &waiter{at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.ch <- c.now
+		return w.ch
+	}
+	c.waiters = append(c.waiters, w)
+
+	return w.ch
+}
+
+func (c *ManualClock) NewTicker(d time.Duration) nodes.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	w := &waiter{at: c.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+
+	return &manualTicker{clock: c, w: w}
+}
+
+// Advance moves the clock forward by d and fires every timer that is due.
+// Like time.Ticker, a ticker whose receiver is not keeping up drops ticks.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+
+		select {
+		case w.ch <- c.now:
+		default:
+		}
+
+		if w.period > 0 {
+			for !w.at.After(c.now) {
+				w.at = w.at.Add(w.period)
+			}
+			pending = append(pending, w)
+		}
+	}
+	c.waiters = pending
+}
+
+func (c *ManualClock) remove(w *waiter) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i, other := range c.waiters {
+		if other == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+type manualTicker struct {
+	clock *ManualClock
+	w     *waiter
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.w.ch
+}
+
+func (t *manualTicker) Stop() {
+	t.clock.remove(t.w)
+}
@@ -0,0 +1,423 @@
+// Package simulator runs a network of nodes in-process over a memory
+// transport, with a manual clock and configurable latency, packet loss and
+// partitions.
+//
+// Calls between nodes are held until the network is idle, then their fate
+// is drawn from the seeded random source one call at a time, in the order
+// of their sender, receiver, method and request, and they are delivered
+// once the manual clock reaches their arrival. Runs with the same seed
+// therefore see the same losses and arrival times.
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/nodes"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/types"
+	"go.uber.org/zap"
+	pb "google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultStep = 100 * time.Millisecond
+	// the network is idle once every call in flight is held by the
+	// simulator for settlePolls polls in a row; settleTimeout only guards
+	// against a node that never goes idle.
+	settlePolls   = 3
+	settleTimeout = 10 * time.Second
+)
+
+var (
+	errPartitioned = errors.New("link partitioned")
+	errDropped     = errors.New("packet dropped")
+	errStopped     = errors.New("simulator stopped")
+)
+
+type Config struct {
+	// Nodes is the number of nodes.
+	Nodes int
+	// Validators is the number of nodes, starting at node 0, that take
+	// turns producing blocks; defaults to 1.
+	Validators int
+	// Engine is the consensus engine of the genesis, see nodes.EnginePoA.
+	Engine string
+	// Latency delays every call between two nodes.
+	Latency time.Duration
+	// PacketLoss is the probability in [0, 1] that a call is dropped.
+	PacketLoss float64
+	// Seed makes packet loss reproducible.
+	Seed int64
+	// Step is how far the clock moves between checks; defaults to 100ms.
+	Step time.Duration
+	// Logger defaults to a no-op logger.
+	Logger *zap.SugaredLogger
+}
+
+type Simulator struct {
+	Clock   *ManualClock
+	Network *nodes.MemoryNetwork
+	Nodes   []*nodes.Node
+
+	cfg    Config
+	addrs  []string
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	done   chan struct{}
+
+	lock       sync.Mutex
+	rng        *rand.Rand
+	conditions bool
+	groups     map[string]int
+	// held are the calls waiting for their fate to be drawn, scheduled
+	// those waiting for the clock to reach their arrival.
+	held      []*delivery
+	scheduled []*delivery
+}
+
+// delivery is a call held by the simulator.
+type delivery struct {
+	call nodes.Call
+	key  string
+	at   time.Time
+	// result receives the fate of the call; abandoned is set once the
+	// caller gave up on it.
+	result    chan error
+	abandoned bool
+}
+
+func New(cfg Config) *Simulator {
+	if cfg.Validators == 0 {
+		cfg.Validators = 1
+	}
+	if cfg.Step == 0 {
+		cfg.Step = defaultStep
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop().Sugar()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Simulator{
+		Clock:   NewManualClock(time.Unix(0, 0)),
+		Network: nodes.NewMemoryNetwork(),
+		cfg:     cfg,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		rng:     rand.New(rand.NewSource(cfg.Seed)),
+	}
+	s.Network.SetLink(s.link)
+
+	return s
+}
+
+func (s *Simulator) Addr(i int) string {
+	return s.addrs[i]
+}
+
+// Start brings up all nodes over ideal links and waits until every node is
+// connected to every other one. Latency and loss apply from then on.
+func (s *Simulator) Start() error {
+	var (
+		keys    []*encrypted.PrivateKey
+		genesis = nodes.Genesis{Engine: s.cfg.Engine}
+	)
+	for i := 0; i < s.cfg.Validators; i++ {
+		key := encrypted.GeneratePrivateKey()
+		keys = append(keys, key)
+		genesis.Validators = append(genesis.Validators, key.Public())
+	}
+
+	for i := 0; i < s.cfg.Nodes; i++ {
+		addr := fmt.Sprintf("10.0.0.%d:3000", i+1)
+		cfg := nodes.ServerConfig{
+			Version:        "0.0.1",
+			ListenAddr:     addr,
+			BootstrapNodes: append([]string{}, s.addrs...),
+			Transport:      s.Network.Transport(addr),
+			Clock:          s.Clock,
+			Genesis:        genesis,
+			Logger:         s.cfg.Logger.With("node", i),
+			// lost calls should not cut peers off for long
+			Breaker: nodes.BreakerConfig{FailureThreshold: 5, Cooldown: 10 * time.Millisecond},
+		}
+		if i < len(keys) {
+			cfg.PrivateKey = keys[i]
+		}
+
+		n := nodes.NewNode(cfg)
+		s.Nodes = append(s.Nodes, n)
+		s.addrs = append(s.addrs, addr)
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := n.Start(s.ctx); err != nil {
+				s.cfg.Logger.Errorw("Node failed", "addr", addr, "error", err)
+			}
+		}()
+
+		if err := s.waitFor(func() bool { return s.Network.Listening(addr) }); err != nil {
+			return fmt.Errorf("node %s did not start: %w", addr, err)
+		}
+	}
+
+	err := s.waitFor(func() bool {
+		for _, n := range s.Nodes {
+			if len(n.Peers()) != len(s.Nodes)-1 {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("nodes did not connect: %w", err)
+	}
+
+	s.lock.Lock()
+	s.conditions = true
+	s.lock.Unlock()
+
+	return nil
+}
+
+func (s *Simulator) Stop() {
+	close(s.done)
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Run advances the clock by d in steps, letting the nodes react after each.
+func (s *Simulator) Run(d time.Duration) {
+	for elapsed := time.Duration(0); elapsed < d; elapsed += s.cfg.Step {
+		s.step()
+	}
+}
+
+// RunUntilConverged runs until all nodes agree on the chain tip, for at
+// most max of simulated time.
+func (s *Simulator) RunUntilConverged(max time.Duration) error {
+	for elapsed := time.Duration(0); elapsed < max; elapsed += s.cfg.Step {
+		if s.Converged() {
+			return nil
+		}
+		s.step()
+	}
+
+	if s.Converged() {
+		return nil
+	}
+
+	return fmt.Errorf("nodes did not converge within %s: heights %v", max, s.Heights())
+}
+
+// Partition splits the network: nodes can only reach nodes of their own
+// group. Nodes not listed in any group can only reach each other.
+func (s *Simulator) Partition(groups ...[]int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.groups = make(map[string]int)
+	for g, group := range groups {
+		for _, i := range group {
+			s.groups[s.addrs[i]] = g + 1
+		}
+	}
+}
+
+func (s *Simulator) Heal() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.groups = nil
+}
+
+func (s *Simulator) Heights() []int {
+	heights := make([]int, len(s.Nodes))
+	for i, n := range s.Nodes {
+		heights[i] = n.Chain().Height()
+	}
+
+	return heights
+}
+
+func (s *Simulator) Tips() [][]byte {
+	tips := make([][]byte, len(s.Nodes))
+	for i, n := range s.Nodes {
+		tips[i] = types.HashHeader(n.Chain().Tip())
+	}
+
+	return tips
+}
+
+// Converged reports whether every node has the same chain tip.
+func (s *Simulator) Converged() bool {
+	tips := s.Tips()
+	for _, tip := range tips[1:] {
+		if !bytes.Equal(tip, tips[0]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Simulator) step() {
+	s.Clock.Advance(s.cfg.Step)
+	s.settle()
+}
+
+// settle delivers the calls due by now until the network is idle with no
+// call due, so the next step starts from a quiet network.
+func (s *Simulator) settle() {
+	var (
+		quiet    = 0
+		last     = s.Network.Events()
+		deadline = time.Now().Add(settleTimeout)
+	)
+	for quiet < settlePolls {
+		if time.Now().After(deadline) {
+			s.cfg.Logger.Warnw("Network did not settle", "inFlight", s.Network.InFlight())
+			return
+		}
+		time.Sleep(time.Millisecond)
+
+		events := s.Network.Events()
+		if events != last || !s.idle() {
+			quiet = 0
+			last = events
+			continue
+		}
+
+		quiet++
+		if quiet == settlePolls && s.release() {
+			quiet = 0
+		}
+	}
+}
+
+// idle reports whether every call in flight is held by the simulator.
+func (s *Simulator) idle() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	held := 0
+	for _, d := range append(s.held, s.scheduled...) {
+		if !d.abandoned {
+			held++
+		}
+	}
+
+	return s.Network.InFlight() <= held
+}
+
+// release draws the fate of the held calls and delivers the calls due by
+// now, and reports whether it let any call go.
+func (s *Simulator) release() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var (
+		now      = s.Clock.Now()
+		released = false
+	)
+
+	sort.SliceStable(s.held, func(i, j int) bool { return s.held[i].key < s.held[j].key })
+	for _, d := range s.held {
+		// one draw per call whatever its fate, so partitions do not shift
+		// the draws of the calls after it
+		lost := s.rng.Float64() < s.cfg.PacketLoss
+
+		switch {
+		case s.groups != nil && s.groups[d.call.From] != s.groups[d.call.To]:
+			d.result <- errPartitioned
+			released = true
+		case lost:
+			d.result <- errDropped
+			released = true
+		default:
+			d.at = now.Add(s.cfg.Latency)
+			s.scheduled = append(s.scheduled, d)
+		}
+	}
+	s.held = nil
+
+	sort.SliceStable(s.scheduled, func(i, j int) bool {
+		if !s.scheduled[i].at.Equal(s.scheduled[j].at) {
+			return s.scheduled[i].at.Before(s.scheduled[j].at)
+		}
+		return s.scheduled[i].key < s.scheduled[j].key
+	})
+	due := 0
+	for due < len(s.scheduled) && !s.scheduled[due].at.After(now) {
+		s.scheduled[due].result <- nil
+		due++
+		released = true
+	}
+	s.scheduled = s.scheduled[due:]
+
+	return released
+}
+
+func (s *Simulator) waitFor(cond func() bool) error {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return errors.New("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return nil
+}
+
+// link holds every call until release lets it go, once conditions apply.
+func (s *Simulator) link(ctx context.Context, call nodes.Call) error {
+	s.lock.Lock()
+	if !s.conditions {
+		s.lock.Unlock()
+		return nil
+	}
+	d := &delivery{call: call, key: callKey(call), result: make(chan error, 1)}
+	s.held = append(s.held, d)
+	s.lock.Unlock()
+
+	select {
+	case err := <-d.result:
+		return err
+	case <-ctx.Done():
+		s.abandon(d)
+		return ctx.Err()
+	case <-s.done:
+		return errStopped
+	}
+}
+
+func (s *Simulator) abandon(d *delivery) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	d.abandoned = true
+}
+
+// callKey orders calls by sender, receiver, method and request.
+func callKey(call nodes.Call) string {
+	var hash [sha256.Size]byte
+	if msg, ok := call.Request.(pb.Message); ok {
+		b, _ := pb.MarshalOptions{Deterministic: true}.Marshal(msg)
+		hash = sha256.Sum256(b)
+	}
+
+	return fmt.Sprintf("%s/%s/%s/%s", call.From, call.To, call.Method, hex.EncodeToString(hash[:]))
+}
@@ -0,0 +1,234 @@
+package simulator
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/consensus"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/nodes"
+)
+
+func startSimulator(t *testing.T, cfg Config) *Simulator {
+	sim := New(cfg)
+	require.Nil(t, sim.Start())
+	t.Cleanup(sim.Stop)
+
+	return sim
+}
+
+func TestManualClock(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	after := clock.After(time.Second)
+	ticker := clock.NewTicker(2 * time.Second)
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Len(t, after, 0)
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Len(t, after, 1)
+	assert.Len(t, ticker.C(), 0)
+
+	clock.Advance(time.Second)
+	require.Len(t, ticker.C(), 1)
+	assert.Equal(t, time.Unix(2, 0), <-ticker.C())
+
+	ticker.Stop()
+	clock.Advance(2 * time.Second)
+	assert.Len(t, ticker.C(), 0)
+}
+
+func TestConvergence(t *testing.T) {
+	sim := startSimulator(t, Config{Nodes: 4, Latency: 50 * time.Millisecond})
+
+	sim.Run(30 * time.Second)
+	require.Nil(t, sim.RunUntilConverged(10*time.Second))
+
+	assert.GreaterOrEqual(t, sim.Heights()[0], 5)
+}
+
+func TestConvergenceWithPacketLoss(t *testing.T) {
+	sim := startSimulator(t, Config{
+		Nodes:      4,
+		Latency:    20 * time.Millisecond,
+		PacketLoss: 0.2,
+		Seed:       42,
+	})
+
+	sim.Run(30 * time.Second)
+	require.Nil(t, sim.RunUntilConverged(30*time.Second))
+
+	assert.GreaterOrEqual(t, sim.Heights()[0], 5)
+}
+
+func TestConvergenceAfterPartition(t *testing.T) {
+	sim := startSimulator(t, Config{Nodes: 4, Latency: 20 * time.Millisecond})
+
+	sim.Partition([]int{0, 1}, []int{2, 3})
+	sim.Run(30 * time.Second)
+
+	heights := sim.Heights()
+	assert.GreaterOrEqual(t, heights[1], 5)
+	assert.Equal(t, 0, heights[2])
+	assert.Equal(t, 0, heights[3])
+
+	sim.Heal()
+	require.Nil(t, sim.RunUntilConverged(30*time.Second))
+
+	assert.GreaterOrEqual(t, sim.Heights()[3], heights[0])
+}
+
+func TestProofOfAuthorityRotation(t *testing.T) {
+	sim := startSimulator(t, Config{Nodes: 4, Validators: 3, Latency: 20 * time.Millisecond})
+
+	sim.Run(30 * time.Second)
+	require.Nil(t, sim.RunUntilConverged(10*time.Second))
+
+	chain := sim.Nodes[3].Chain()
+	require.GreaterOrEqual(t, chain.Height(), 3)
+
+	signers := make(map[string]bool)
+	for height := 1; height <= chain.Height(); height++ {
+		block, err := chain.GetBlockByHeight(height)
+		require.Nil(t, err)
+		signers[string(block.PublicKey)] = true
+	}
+	assert.Len(t, signers, 3)
+}
+
+func TestProofOfAuthorityAbsentProposer(t *testing.T) {
+	sim := startSimulator(t, Config{Nodes: 4, Validators: 3, Latency: 20 * time.Millisecond})
+
+	sim.Run(10 * time.Second)
+	require.Nil(t, sim.RunUntilConverged(10*time.Second))
+	before := sim.Heights()[0]
+
+	// cut off validator 1; the others take its turns after the timeout
+	sim.Partition([]int{1}, []int{0, 2, 3})
+	sim.Run(90 * time.Second)
+
+	heights := sim.Heights()
+	assert.GreaterOrEqual(t, heights[3], before+6)
+	assert.Equal(t, heights[0], heights[3])
+}
+
+func TestProofOfStake(t *testing.T) {
+	sim := startSimulator(t, Config{Nodes: 4, Validators: 3, Engine: nodes.EnginePoS, Latency: 20 * time.Millisecond})
+
+	sim.Run(30 * time.Second)
+	require.Nil(t, sim.RunUntilConverged(10*time.Second))
+
+	chain := sim.Nodes[3].Chain()
+	require.GreaterOrEqual(t, chain.Height(), 3)
+
+	// every block is signed by a validator with bonded stake
+	for height := 1; height <= chain.Height(); height++ {
+		block, err := chain.GetBlockByHeight(height)
+		require.Nil(t, err)
+		set, err := chain.ValidatorSet(int32(height))
+		require.Nil(t, err)
+		assert.Positive(t, set.Power(block.PublicKey), "height %d", height)
+	}
+}
+
+func requireCommitted(t *testing.T, sim *Simulator, node int) {
+	chain := sim.Nodes[node].Chain()
+	engine := sim.Nodes[node].Consensus.(*consensus.BFT)
+
+	for height := 1; height <= chain.Height(); height++ {
+		block, err := chain.GetBlockByHeight(height)
+		require.Nil(t, err)
+		require.Nil(t, engine.VerifyCommit(block), "height %d", height)
+	}
+}
+
+func TestBFTFinality(t *testing.T) {
+	sim := startSimulator(t, Config{
+		Nodes:      5,
+		Validators: 4,
+		Engine:     nodes.EngineBFT,
+		Latency:    20 * time.Millisecond,
+	})
+
+	sim.Run(30 * time.Second)
+	require.Nil(t, sim.RunUntilConverged(10*time.Second))
+	assert.GreaterOrEqual(t, sim.Heights()[4], 3)
+	requireCommitted(t, sim, 4)
+
+	// one faulty validator out of four does not stop the others
+	before := sim.Heights()[0]
+	sim.Partition([]int{3}, []int{0, 1, 2, 4})
+	sim.Run(60 * time.Second)
+	assert.Greater(t, sim.Heights()[0], before+2)
+
+	sim.Heal()
+	require.Nil(t, sim.RunUntilConverged(30*time.Second))
+	requireCommitted(t, sim, 3)
+}
+
+func TestBFTHaltsWithoutQuorum(t *testing.T) {
+	sim := startSimulator(t, Config{
+		Nodes:      4,
+		Validators: 4,
+		Engine:     nodes.EngineBFT,
+		Latency:    20 * time.Millisecond,
+	})
+
+	sim.Run(15 * time.Second)
+	require.Nil(t, sim.RunUntilConverged(10*time.Second))
+	before := sim.Tips()[0]
+	height := sim.Heights()[0]
+
+	// neither half has the votes to commit, so no side can fork off
+	sim.Partition([]int{0, 1}, []int{2, 3})
+	sim.Run(30 * time.Second)
+	for _, h := range sim.Heights() {
+		assert.Equal(t, height, h)
+	}
+	assert.Equal(t, before, sim.Tips()[3])
+
+	sim.Heal()
+	sim.Run(30 * time.Second)
+	require.Nil(t, sim.RunUntilConverged(30*time.Second))
+	assert.Greater(t, sim.Heights()[0], height)
+}
+
+func TestCallFatesDoNotDependOnArrivalOrder(t *testing.T) {
+	var calls []nodes.Call
+	for i := 0; i < 20; i++ {
+		calls = append(calls, nodes.Call{From: fmt.Sprintf("10.0.0.%d:3000", i%4+1), To: "10.0.0.9:3000", Method: fmt.Sprintf("/Node/%d", i)})
+	}
+
+	fates := func(order []int) map[string]error {
+		sim := New(Config{Latency: 20 * time.Millisecond, PacketLoss: 0.5, Seed: 7})
+		sim.conditions = true
+
+		var held []*delivery
+		for _, i := range order {
+			d := &delivery{call: calls[i], key: callKey(calls[i]), result: make(chan error, 1)}
+			sim.held = append(sim.held, d)
+			held = append(held, d)
+		}
+		sim.release()
+		// the calls not lost arrive once the latency has passed
+		sim.Clock.Advance(20 * time.Millisecond)
+		sim.release()
+
+		fates := make(map[string]error)
+		for _, d := range held {
+			require.Len(t, d.result, 1)
+			fates[d.key] = <-d.result
+		}
+
+		return fates
+	}
+
+	var forward, backward []int
+	for i := range calls {
+		forward = append(forward, i)
+		backward = append(backward, len(calls)-1-i)
+	}
+	assert.Equal(t, fates(forward), fates(backward))
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/cbergoon/merkletree"
 	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
-	pb "google.golang.org/protobuf/proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
 )
 
 type TxHash struct {
@@ -36,9 +36,12 @@ func SignBlock(pk *encrypted.PrivateKey, block *proto.Block) *encrypted.Signatur
 
 		block.Header.RootHash = tree.MerkleRoot()
 	}
+	if len(block.Evidence) > 0 {
+		block.Header.EvidenceHash = HashEvidenceList(block.Evidence)
+	}
 
 	hash := HashBlock(block)
-	signature := pk.Sign(hash)
+	signature := pk.Sign(signingHash(domainBlock, hash))
 	block.PublicKey = pk.Public().Bytes()
 	block.Signature = signature.Bytes()
 
@@ -50,41 +53,57 @@ func HashBlock(block *proto.Block) []byte {
 	return HashHeader(block.Header)
 }
 
+// HashHeader returns SHA256 of the canonical encoding of the header.
 func HashHeader(header *proto.Header) []byte {
-	b, err := pb.Marshal(header)
-	if err != nil {
-		panic(err)
-	}
-
-	hash := sha256.Sum256(b)
+	hash := sha256.Sum256(EncodeHeader(header))
 
 	return hash[:]
 }
 
+// VerifyBlock reports whether CheckBlock accepts block.
 func VerifyBlock(block *proto.Block) bool {
-	if len(block.Transactions) > 0 {
-		if !VerifyRootHash(block) {
-			return false
-		}
+	return CheckBlock(block) == nil
+}
+
+// CheckBlock checks the merkle root, the evidence hash and the signature of
+// block.
+func CheckBlock(block *proto.Block) error {
+	if block.Header == nil {
+		return errors.Wrap(errors.ErrTxDecode, "block without header")
 	}
 
-	if len(block.PublicKey) != encrypted.PublicKeyLen {
-		return false
+	if !VerifyRootHash(block) {
+		return errors.Wrap(errors.ErrUnauthorized, "invalid merkle root")
 	}
-	if len(block.Signature) != encrypted.SignatureLen {
-		return false
+
+	if !bytes.Equal(block.Header.EvidenceHash, HashEvidenceList(block.Evidence)) {
+		return errors.Wrap(errors.ErrUnauthorized, "invalid evidence hash")
 	}
 
-	var (
-		signature = encrypted.SignatureFromBytes(block.Signature)
-		publicKey = encrypted.PublicKeyFromBytes(block.PublicKey)
-		hash      = HashBlock(block)
-	)
+	signature, err := encrypted.ParseSignature(block.Signature)
+	if err != nil {
+		return err
+	}
+	publicKey, err := encrypted.ParsePublicKey(block.PublicKey)
+	if err != nil {
+		return err
+	}
 
-	return signature.Verify(publicKey, hash)
+	if !signature.Verify(publicKey, signingHash(domainBlock, HashBlock(block))) {
+		return errors.Wrapf(errors.ErrUnauthorized, "invalid signature of block %d", block.Header.Height)
+	}
+
+	return nil
 }
 
+// VerifyRootHash reports whether the header commits to the transactions of
+// block. A block without transactions has no root, so its body cannot be
+// stripped without changing its hash.
 func VerifyRootHash(block *proto.Block) bool {
+	if len(block.Transactions) == 0 {
+		return len(block.Header.RootHash) == 0
+	}
+
 	tree, err := GetMerkleTree(block)
 	if err != nil {
 		return false
@@ -105,7 +124,7 @@ func VerifyRootHash(block *proto.Block) bool {
 func GetMerkleTree(block *proto.Block) (*merkletree.MerkleTree, error) {
 	list := make([]merkletree.Content, len(block.Transactions))
 	for i := 0; i < len(block.Transactions); i++ {
-		list[i] = NewTxHash(HashTransaction(block.Transactions[i]))
+		list[i] = NewTxHash(HashTransactionWitness(block.Transactions[i]))
 	}
 
 	tree, err := merkletree.NewTree(list)
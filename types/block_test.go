@@ -19,7 +19,7 @@ func TestVerifyBlock(t *testing.T) {
 	signature := SignBlock(privateKey, block)
 
 	assert.Equal(t, 64, len(signature.Bytes()))
-	assert.True(t, signature.Verify(publicKey, HashBlock(block)))
+	assert.True(t, signature.Verify(publicKey, signingHash(domainBlock, HashBlock(block))))
 
 	assert.Equal(t, block.PublicKey, publicKey.Bytes())
 	assert.Equal(t, block.Signature, signature.Bytes())
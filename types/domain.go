@@ -0,0 +1,22 @@
+package types
+
+import "crypto/sha256"
+
+// Domain tags prefix every signed message, so a signature made over one
+// kind of message is never valid for another kind with the same hash.
+const (
+	domainBlock       = "blocker/block"
+	domainTransaction = "blocker/tx"
+	domainVote        = "blocker/vote"
+)
+
+// signingHash returns what is actually signed for a message of domain with
+// the given hash.
+func signingHash(domain string, hash []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(domain))
+	h.Write([]byte{0})
+	h.Write(hash)
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,228 @@
+package types
+
+import (
+	"encoding/binary"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+)
+
+// EncodingVersion is the version of the canonical encoding, written as the
+// first byte of every encoded message.
+//
+// Hashes and signatures are computed over the canonical encoding rather than
+// the protobuf wire format, which is not guaranteed to be byte-stable and
+// carries unknown fields. The encoding writes every field of its version in
+// declaration order, skipping none:
+//
+//   - integers as fixed-width big-endian, signed ones in two's complement
+//     (int32, uint32 and enums in 4 bytes, int64 and uint64 in 8)
+//   - bytes and strings as a uint32 length followed by their content
+//   - repeated fields as a uint32 count followed by every element
+//   - nested messages as their encoding without the version byte
+//
+// Transactions have two encodings: EncodeTransaction omits the input
+// witness, that is signatures, HTLC preimages and unlocking scripts, and
+// gives the transaction ID, EncodeTransactionWitness includes it.
+//
+// testdata/encoding_vectors.json holds test vectors for other
+// implementations.
+const EncodingVersion byte = 1
+
+// EncodingVersionUpgrades is the version of transactions that set a field
+// added by a rules upgrade: a multisig policy, a relative or absolute lock
+// time, a hash lock, an HTLC preimage or a script. It adds those fields in
+// declaration order, a multisig policy like a repeated field of at most one
+// element. Other transactions keep EncodingVersion, so their encoding and
+// ID do not change; the witness fields only decide the version of the
+// witness encoding.
+const EncodingVersionUpgrades byte = 2
+
+// EncodeHeader returns the canonical encoding of header.
+func EncodeHeader(header *proto.Header) []byte {
+	e := newEncoder()
+	e.header(header)
+
+	return e.buf
+}
+
+// EncodeTransaction returns the canonical encoding of tx without its input
+// witness.
+func EncodeTransaction(tx *proto.Transaction) []byte {
+	return encodeTransaction(tx, false)
+}
+
+// EncodeTransactionWitness returns the canonical encoding of tx including
+// its input witness.
+func EncodeTransactionWitness(tx *proto.Transaction) []byte {
+	return encodeTransaction(tx, true)
+}
+
+func encodeTransaction(tx *proto.Transaction, witness bool) []byte {
+	upgrades := usesUpgrades(tx, witness)
+
+	e := newEncoder()
+	if upgrades {
+		e.buf[0] = EncodingVersionUpgrades
+	}
+	e.int32(tx.Version)
+	e.uint32(uint32(len(tx.Inputs)))
+	for _, input := range tx.Inputs {
+		e.bytes(input.PrevTxHash)
+		e.uint32(input.PrevOutIndex)
+		e.bytes(input.PublicKey)
+		if witness {
+			e.bytes(input.Signature)
+		}
+		e.uint32(input.SigHash)
+		if upgrades {
+			e.multisig(input.Multisig, witness)
+			e.uint32(input.RelativeLock)
+			if witness {
+				e.bytes(input.Preimage)
+				e.bytes(input.UnlockingScript)
+			}
+		}
+	}
+	e.uint32(uint32(len(tx.Outputs)))
+	for _, output := range tx.Outputs {
+		e.int64(output.Amount)
+		e.bytes(output.Address)
+		e.uint32(uint32(output.Type))
+		e.bytes(output.Validator)
+		e.int32(output.UnlockHeight)
+		if upgrades {
+			e.bytes(output.HashLock)
+			e.bytes(output.RefundAddress)
+			e.bytes(output.LockingScript)
+		}
+	}
+	e.string(tx.ChainId)
+	if upgrades {
+		e.int64(tx.LockTime)
+	}
+
+	return e.buf
+}
+
+// usesUpgrades reports whether tx sets a field EncodingVersion cannot
+// encode, looking at the witness fields only if witness is set. A multisig
+// policy counts once present, even empty, so the encoding tells it apart
+// from none.
+func usesUpgrades(tx *proto.Transaction, witness bool) bool {
+	if tx.LockTime != 0 {
+		return true
+	}
+	for _, input := range tx.Inputs {
+		if input.Multisig != nil || input.RelativeLock != 0 {
+			return true
+		}
+		if witness && (len(input.Preimage) != 0 || len(input.UnlockingScript) != 0) {
+			return true
+		}
+	}
+	for _, output := range tx.Outputs {
+		if len(output.HashLock) != 0 || len(output.RefundAddress) != 0 || len(output.LockingScript) != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EncodeVote returns the canonical encoding of vote.
+func EncodeVote(vote *proto.Vote) []byte {
+	e := newEncoder()
+	e.uint32(uint32(vote.Type))
+	e.int32(vote.Height)
+	e.int32(vote.Round)
+	e.bytes(vote.BlockHash)
+	e.bytes(vote.PublicKey)
+	e.bytes(vote.Signature)
+
+	return e.buf
+}
+
+// EncodeEvidence returns the canonical encoding of evidence.
+func EncodeEvidence(evidence *proto.Evidence) []byte {
+	e := newEncoder()
+	e.bytes(evidence.PublicKey)
+	e.header(evidence.HeaderA)
+	e.bytes(evidence.SignatureA)
+	e.header(evidence.HeaderB)
+	e.bytes(evidence.SignatureB)
+
+	return e.buf
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func newEncoder() *encoder {
+	return &encoder{buf: []byte{EncodingVersion}}
+}
+
+// header encodes a missing header like an empty one.
+func (e *encoder) header(header *proto.Header) {
+	if header == nil {
+		header = &proto.Header{}
+	}
+
+	e.int32(header.Version)
+	e.int32(header.Height)
+	e.bytes(header.PrevHash)
+	e.bytes(header.RootHash)
+	e.int64(header.Timestamp)
+	e.uint64(header.Nonce)
+	e.uint32(header.Bits)
+	e.bytes(header.EvidenceHash)
+	e.string(header.ChainId)
+}
+
+// multisig encodes a multisig like a repeated field of at most one element,
+// so a missing one differs from an empty one, its signatures only if
+// witness is set.
+func (e *encoder) multisig(multisig *proto.Multisig, witness bool) {
+	if multisig == nil {
+		e.uint32(0)
+		return
+	}
+
+	e.uint32(1)
+	e.uint32(multisig.Threshold)
+	e.uint32(uint32(len(multisig.PublicKeys)))
+	for _, key := range multisig.PublicKeys {
+		e.bytes(key)
+	}
+	if witness {
+		e.uint32(uint32(len(multisig.Signatures)))
+		for _, sig := range multisig.Signatures {
+			e.bytes(sig)
+		}
+	}
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) int32(v int32) {
+	e.uint32(uint32(v))
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+}
+
+func (e *encoder) int64(v int64) {
+	e.uint64(uint64(v))
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint32(uint32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(s string) {
+	e.bytes([]byte(s))
+}
@@ -0,0 +1,232 @@
+package types
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	pb "google.golang.org/protobuf/proto"
+)
+
+var update = flag.Bool("update", false, "rewrite the encoding test vectors")
+
+const vectorsPath = "testdata/encoding_vectors.json"
+
+// encodingVector is one entry of the test vectors: a message in protobuf
+// JSON, its canonical encoding and its hash, both in hex. Transactions also
+// have their witness encoding and hash.
+type encodingVector struct {
+	Name            string          `json:"name"`
+	Type            string          `json:"type"`
+	Value           json.RawMessage `json:"value"`
+	Encoding        string          `json:"encoding"`
+	Hash            string          `json:"hash"`
+	WitnessEncoding string          `json:"witnessEncoding,omitempty"`
+	WitnessHash     string          `json:"witnessHash,omitempty"`
+}
+
+func fill(n int, b byte) []byte {
+	return bytes.Repeat([]byte{b}, n)
+}
+
+var vectorMessages = []struct {
+	name string
+	msg  pb.Message
+}{
+	{"empty header", &proto.Header{}},
+	{"header", &proto.Header{
+		Version:      2,
+		Height:       -1,
+		PrevHash:     fill(32, 0x11),
+		RootHash:     fill(32, 0x22),
+		Timestamp:    1704067200000000000,
+		Nonce:        0xdeadbeef,
+		Bits:         0x207fffff,
+		EvidenceHash: fill(32, 0x33),
+		ChainId:      "testnet",
+	}},
+	{"transaction", &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{
+			{PrevTxHash: fill(32, 0x44), PrevOutIndex: 1, PublicKey: fill(32, 0x55), Signature: fill(64, 0x66)},
+			{PrevTxHash: fill(32, 0x77), PublicKey: fill(32, 0x88), Signature: fill(64, 0x99), SigHash: uint32(SigHashSingle | SigHashAnyoneCanPay)},
+		},
+		Outputs: []*proto.TxOutput{
+			{Amount: 100, Address: fill(20, 0xaa)},
+			{Amount: 50, Address: fill(20, 0xbb), Type: proto.OutputType_OUTPUT_UNBONDING, Validator: fill(32, 0xcc), UnlockHeight: 42},
+		},
+		ChainId: "testnet",
+	}},
+	{"vote", &proto.Vote{
+		Type:      proto.VoteType_VOTE_PRECOMMIT,
+		Height:    7,
+		Round:     1,
+		BlockHash: fill(32, 0xdd),
+		PublicKey: fill(32, 0xee),
+	}},
+	{"evidence", &proto.Evidence{
+		PublicKey:  fill(32, 0x01),
+		HeaderA:    &proto.Header{Version: 1, Height: 5, ChainId: "testnet"},
+		SignatureA: fill(64, 0x02),
+		HeaderB:    &proto.Header{Version: 1, Height: 5, Timestamp: 1, ChainId: "testnet"},
+		SignatureB: fill(64, 0x03),
+	}},
+	{"multisig transaction", &proto.Transaction{
+		Version: 3,
+		Inputs: []*proto.TxInput{
+			{PrevTxHash: fill(32, 0x45), Multisig: &proto.Multisig{
+				Threshold:  2,
+				PublicKeys: [][]byte{fill(32, 0x56), fill(32, 0x57), fill(32, 0x58)},
+				Signatures: [][]byte{fill(64, 0x67), nil, fill(64, 0x68)},
+			}},
+		},
+		Outputs: []*proto.TxOutput{
+			{Amount: 100, Address: fill(20, 0xab), Type: proto.OutputType_OUTPUT_MULTISIG},
+		},
+		ChainId: "testnet",
+	}},
+	{"time locked transaction", &proto.Transaction{
+		Version: 4,
+		Inputs: []*proto.TxInput{
+			{PrevTxHash: fill(32, 0x46), PublicKey: fill(32, 0x59), Signature: fill(64, 0x69), RelativeLock: 144},
+		},
+		Outputs:  []*proto.TxOutput{{Amount: 100, Address: fill(20, 0xac)}},
+		ChainId:  "testnet",
+		LockTime: 1704067200000000000,
+	}},
+	{"htlc transaction", &proto.Transaction{
+		Version: 5,
+		Inputs: []*proto.TxInput{
+			{PrevTxHash: fill(32, 0x47), PublicKey: fill(32, 0x5a), Signature: fill(64, 0x6a), Preimage: fill(32, 0x7a)},
+		},
+		Outputs: []*proto.TxOutput{
+			{Amount: 100, Address: fill(20, 0xad), Type: proto.OutputType_OUTPUT_HTLC, UnlockHeight: 144, HashLock: fill(32, 0xbd), RefundAddress: fill(20, 0xcd)},
+		},
+		ChainId: "testnet",
+	}},
+	{"script transaction", &proto.Transaction{
+		Version: 6,
+		Inputs: []*proto.TxInput{
+			{PrevTxHash: fill(32, 0x48), UnlockingScript: append([]byte{0x40}, fill(64, 0x6b)...)},
+		},
+		Outputs: []*proto.TxOutput{
+			{Amount: 100, Type: proto.OutputType_OUTPUT_SCRIPT, LockingScript: append(append([]byte{0x20}, fill(32, 0x5b)...), 0xac)},
+		},
+		ChainId: "testnet",
+	}},
+}
+
+func encodeMessage(msg pb.Message) ([]byte, []byte) {
+	switch m := msg.(type) {
+	case *proto.Header:
+		return EncodeHeader(m), HashHeader(m)
+	case *proto.Transaction:
+		return EncodeTransaction(m), HashTransaction(m)
+	case *proto.Vote:
+		return EncodeVote(m), HashVote(m)
+	case *proto.Evidence:
+		return EncodeEvidence(m), HashEvidence(m)
+	}
+	panic("no canonical encoding")
+}
+
+func TestEncodingVectors(t *testing.T) {
+	if *update {
+		var vectors []encodingVector
+		for _, v := range vectorMessages {
+			value, err := protojson.Marshal(v.msg)
+			require.Nil(t, err)
+			encoding, hash := encodeMessage(v.msg)
+
+			vector := encodingVector{
+				Name:     v.name,
+				Type:     string(v.msg.ProtoReflect().Descriptor().Name()),
+				Value:    value,
+				Encoding: hex.EncodeToString(encoding),
+				Hash:     hex.EncodeToString(hash),
+			}
+			if tx, ok := v.msg.(*proto.Transaction); ok {
+				vector.WitnessEncoding = hex.EncodeToString(EncodeTransactionWitness(tx))
+				vector.WitnessHash = hex.EncodeToString(HashTransactionWitness(tx))
+			}
+			vectors = append(vectors, vector)
+		}
+		b, err := json.MarshalIndent(vectors, "", "  ")
+		require.Nil(t, err)
+		require.Nil(t, os.WriteFile(filepath.FromSlash(vectorsPath), append(b, '\n'), 0o644))
+	}
+
+	b, err := os.ReadFile(filepath.FromSlash(vectorsPath))
+	require.Nil(t, err)
+	var vectors []encodingVector
+	require.Nil(t, json.Unmarshal(b, &vectors))
+	require.Len(t, vectors, len(vectorMessages))
+
+	for i, v := range vectors {
+		msg := vectorMessages[i].msg.ProtoReflect().New().Interface()
+		require.Equal(t, v.Type, string(msg.ProtoReflect().Descriptor().Name()), v.Name)
+		require.Nil(t, protojson.Unmarshal(v.Value, msg), v.Name)
+
+		encoding, hash := encodeMessage(msg)
+		assert.Equal(t, v.Encoding, hex.EncodeToString(encoding), v.Name)
+		assert.Equal(t, v.Hash, hex.EncodeToString(hash), v.Name)
+		if tx, ok := msg.(*proto.Transaction); ok {
+			assert.Equal(t, v.WitnessEncoding, hex.EncodeToString(EncodeTransactionWitness(tx)), v.Name)
+			assert.Equal(t, v.WitnessHash, hex.EncodeToString(HashTransactionWitness(tx)), v.Name)
+		}
+	}
+}
+
+func TestEncodeHeaderLayout(t *testing.T) {
+	header := &proto.Header{Version: 1, Height: 2, Timestamp: -1, Bits: 3, PrevHash: []byte{0xab}, ChainId: "x"}
+
+	want := "01" + // encoding version
+		"00000001" + "00000002" + // version, height
+		"00000001ab" + "00000000" + // prevHash, rootHash
+		"ffffffffffffffff" + "0000000000000000" + "00000003" + // timestamp, nonce, bits
+		"00000000" + "0000000178" // evidenceHash, chainId
+	assert.Equal(t, want, hex.EncodeToString(EncodeHeader(header)))
+}
+
+func TestEncodeTransactionVersion(t *testing.T) {
+	tx := pb.Clone(vectorMessages[2].msg).(*proto.Transaction)
+	assert.Equal(t, EncodingVersion, EncodeTransaction(tx)[0])
+	assert.Equal(t, EncodingVersion, EncodeTransactionWitness(tx)[0])
+
+	// a witness field of an upgrade leaves the transaction ID alone
+	id := HashTransaction(tx)
+	tx.Inputs[0].Preimage = fill(32, 0x7a)
+	assert.Equal(t, id, HashTransaction(tx))
+	assert.Equal(t, EncodingVersionUpgrades, EncodeTransactionWitness(tx)[0])
+
+	// an empty multisig policy is not the same as none
+	tx.Inputs[0].Multisig = &proto.Multisig{Threshold: 1}
+	assert.Equal(t, EncodingVersionUpgrades, EncodeTransaction(tx)[0])
+	encoding := EncodeTransaction(tx)
+	tx.Inputs[1].Multisig = &proto.Multisig{}
+	assert.NotEqual(t, encoding, EncodeTransaction(tx))
+}
+
+func TestHashIgnoresUnknownFields(t *testing.T) {
+	header := vectorMessages[1].msg.(*proto.Header)
+	b, err := pb.Marshal(header)
+	require.Nil(t, err)
+
+	// a field a newer version of the protocol might add
+	b = protowire.AppendTag(b, 99, protowire.BytesType)
+	b = protowire.AppendBytes(b, []byte("future"))
+
+	decoded := &proto.Header{}
+	require.Nil(t, pb.Unmarshal(b, decoded))
+	assert.NotEmpty(t, decoded.ProtoReflect().GetUnknown())
+	assert.Equal(t, HashHeader(header), HashHeader(decoded))
+}
@@ -0,0 +1,96 @@
+package types
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// NewEvidence returns the evidence of two blocks signed by the same key at
+// the same height. The headers are ordered by hash, so both orders of the
+// blocks give the same evidence.
+func NewEvidence(a, b *proto.Block) *proto.Evidence {
+	if bytes.Compare(HashBlock(a), HashBlock(b)) > 0 {
+		a, b = b, a
+	}
+
+	return &proto.Evidence{
+		PublicKey:  a.PublicKey,
+		HeaderA:    a.Header,
+		SignatureA: a.Signature,
+		HeaderB:    b.Header,
+		SignatureB: b.Signature,
+	}
+}
+
+// HashEvidence returns SHA256 of the evidence.
+func HashEvidence(evidence *proto.Evidence) []byte {
+	hash := sha256.Sum256(EncodeEvidence(evidence))
+
+	return hash[:]
+}
+
+// HashEvidenceList returns the hash a header commits its block's evidence
+// with, nil if there is none.
+func HashEvidenceList(evidence []*proto.Evidence) []byte {
+	if len(evidence) == 0 {
+		return nil
+	}
+
+	h := sha256.New()
+	for _, e := range evidence {
+		h.Write(HashEvidence(e))
+	}
+
+	return h.Sum(nil)
+}
+
+// VerifyEvidence reports whether CheckEvidence accepts evidence.
+func VerifyEvidence(evidence *proto.Evidence) bool {
+	return CheckEvidence(evidence) == nil
+}
+
+// CheckEvidence checks that the evidence holds two different headers of the
+// same chain at the same height, both signed by its public key. The chain
+// checks that it is its own.
+func CheckEvidence(evidence *proto.Evidence) error {
+	if evidence.HeaderA == nil || evidence.HeaderB == nil {
+		return errors.Wrap(errors.ErrTxDecode, "evidence without headers")
+	}
+	if evidence.HeaderA.ChainId != evidence.HeaderB.ChainId {
+		return errors.Wrapf(errors.ErrInvalidChainID, "evidence headers of chains %q and %q", evidence.HeaderA.ChainId, evidence.HeaderB.ChainId)
+	}
+	if evidence.HeaderA.Height != evidence.HeaderB.Height {
+		return errors.Wrapf(errors.ErrInvalidHeight, "evidence headers at heights %d and %d", evidence.HeaderA.Height, evidence.HeaderB.Height)
+	}
+
+	publicKey, err := encrypted.ParsePublicKey(evidence.PublicKey)
+	if err != nil {
+		return err
+	}
+	signatureA, err := encrypted.ParseSignature(evidence.SignatureA)
+	if err != nil {
+		return err
+	}
+	signatureB, err := encrypted.ParseSignature(evidence.SignatureB)
+	if err != nil {
+		return err
+	}
+
+	var (
+		hashA = HashHeader(evidence.HeaderA)
+		hashB = HashHeader(evidence.HeaderB)
+	)
+	if bytes.Equal(hashA, hashB) {
+		return errors.Wrap(errors.ErrInvalidRequest, "evidence of a single header")
+	}
+
+	if !signatureA.Verify(publicKey, signingHash(domainBlock, hashA)) || !signatureB.Verify(publicKey, signingHash(domainBlock, hashB)) {
+		return errors.Wrap(errors.ErrUnauthorized, "invalid evidence signature")
+	}
+
+	return nil
+}
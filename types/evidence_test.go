@@ -0,0 +1,66 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/util"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestVerifyEvidence(t *testing.T) {
+	var (
+		privateKey = encrypted.GeneratePrivateKey()
+		a          = util.RandomBlock()
+		b          = pb.Clone(a).(*proto.Block)
+	)
+	b.Header.Timestamp++
+	SignBlock(privateKey, a)
+	SignBlock(privateKey, b)
+
+	evidence := NewEvidence(a, b)
+	assert.True(t, VerifyEvidence(evidence))
+	assert.Equal(t, HashEvidence(evidence), HashEvidence(NewEvidence(b, a)))
+
+	// the same header twice is no equivocation
+	assert.False(t, VerifyEvidence(NewEvidence(a, a)))
+
+	// both headers have to be at the same height
+	c := pb.Clone(a).(*proto.Block)
+	c.Header.Height++
+	SignBlock(privateKey, c)
+	assert.False(t, VerifyEvidence(NewEvidence(a, c)))
+
+	// of the same chain
+	d := pb.Clone(a).(*proto.Block)
+	d.Header.ChainId = "other"
+	SignBlock(privateKey, d)
+	assert.False(t, VerifyEvidence(NewEvidence(a, d)))
+
+	// and signed by the same key
+	SignBlock(encrypted.GeneratePrivateKey(), b)
+	evidence = NewEvidence(a, b)
+	evidence.PublicKey = privateKey.Public().Bytes()
+	assert.False(t, VerifyEvidence(evidence))
+}
+
+func TestVerifyBlockCoversEvidence(t *testing.T) {
+	var (
+		privateKey = encrypted.GeneratePrivateKey()
+		a          = util.RandomBlock()
+		b          = pb.Clone(a).(*proto.Block)
+		block      = util.RandomBlock()
+	)
+	b.Header.Timestamp++
+	SignBlock(privateKey, a)
+	SignBlock(privateKey, b)
+
+	block.Evidence = []*proto.Evidence{NewEvidence(a, b)}
+	SignBlock(privateKey, block)
+	assert.True(t, VerifyBlock(block))
+
+	block.Evidence = nil
+	assert.False(t, VerifyBlock(block))
+}
@@ -0,0 +1,73 @@
+package types
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// HTLCPreimageLen is the length of HTLC preimages. Fixing it keeps one side
+// of a swap from accepting a preimage the other side rejects.
+const HTLCPreimageLen = 32
+
+// HashLock returns the hash lock of preimage.
+func HashLock(preimage []byte) []byte {
+	hash := sha256.Sum256(preimage)
+	return hash[:]
+}
+
+// HTLCOutput returns a hash time-locked output of amount. recipient can
+// spend it by revealing the preimage of hashLock, refund from height
+// timeout on.
+func HTLCOutput(amount int64, hashLock []byte, recipient, refund encrypted.Address, timeout int32) *proto.TxOutput {
+	return &proto.TxOutput{
+		Amount:        amount,
+		Address:       recipient.Bytes(),
+		Type:          proto.OutputType_OUTPUT_HTLC,
+		UnlockHeight:  timeout,
+		HashLock:      hashLock,
+		RefundAddress: refund.Bytes(),
+	}
+}
+
+// HTLCClaimInput returns an unsigned input claiming output prevOutIndex of
+// prevTxHash, an HTLC output paying to the address of key, with preimage.
+// Inputs refunding an HTLC output are plain inputs.
+func HTLCClaimInput(prevTxHash []byte, prevOutIndex uint32, key *encrypted.PublicKey, preimage []byte) *proto.TxInput {
+	return &proto.TxInput{
+		PrevTxHash:   prevTxHash,
+		PrevOutIndex: prevOutIndex,
+		PublicKey:    key.Bytes(),
+		Preimage:     preimage,
+	}
+}
+
+// CheckHTLCOutput checks the hash lock and addresses of an HTLC output.
+func CheckHTLCOutput(output *proto.TxOutput) error {
+	if len(output.HashLock) != sha256.Size {
+		return errors.Wrapf(errors.ErrInvalidRequest, "hash lock of %d bytes", len(output.HashLock))
+	}
+	if _, err := encrypted.ParseAddress(output.Address); err != nil {
+		return err
+	}
+	if _, err := encrypted.ParseAddress(output.RefundAddress); err != nil {
+		return errors.Wrap(err, "refund address")
+	}
+
+	return nil
+}
+
+// CheckPreimage checks that preimage opens hashLock.
+func CheckPreimage(hashLock, preimage []byte) error {
+	if len(preimage) != HTLCPreimageLen {
+		return errors.Wrapf(errors.ErrUnauthorized, "preimage of %d bytes instead of %d", len(preimage), HTLCPreimageLen)
+	}
+	if !bytes.Equal(HashLock(preimage), hashLock) {
+		return errors.Wrap(errors.ErrUnauthorized, "preimage does not open the hash lock")
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+)
+
+func TestHTLCOutput(t *testing.T) {
+	var (
+		preimage  = make([]byte, HTLCPreimageLen)
+		recipient = encrypted.GeneratePrivateKey().Public().Address()
+		refund    = encrypted.GeneratePrivateKey().Public().Address()
+		output    = HTLCOutput(100, HashLock(preimage), recipient, refund, 10)
+	)
+	assert.Nil(t, CheckHTLCOutput(output))
+	assert.Nil(t, CheckPreimage(output.HashLock, preimage))
+
+	assert.NotNil(t, CheckPreimage(output.HashLock, append(preimage, 0)))
+	preimage[0] = 1
+	assert.NotNil(t, CheckPreimage(output.HashLock, preimage))
+
+	output.RefundAddress = nil
+	assert.NotNil(t, CheckHTLCOutput(output))
+	output.HashLock = output.HashLock[:16]
+	assert.NotNil(t, CheckHTLCOutput(output))
+}
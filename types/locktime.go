@@ -0,0 +1,43 @@
+package types
+
+import (
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// LockTimeThreshold separates the two meanings of Transaction.LockTime.
+// Lock times below it are block heights, lock times from it on are
+// timestamps in the unit of Header.Timestamp.
+const LockTimeThreshold int64 = 500_000_000
+
+// CheckLockTime checks that the lock time of tx has passed for a block at
+// height extending a tip with median time past medianTime. Timestamps are
+// compared to the median of the tip and its ancestors rather than to a
+// single header, so no block producer can move it forward at will.
+func CheckLockTime(tx *proto.Transaction, height int32, medianTime int64) error {
+	switch {
+	case tx.LockTime <= 0:
+		return nil
+	case tx.LockTime < LockTimeThreshold && tx.LockTime > int64(height):
+		return errors.Wrapf(errors.ErrTxNotFinal, "locked until height %d", tx.LockTime)
+	case tx.LockTime >= LockTimeThreshold && tx.LockTime > medianTime:
+		return errors.Wrapf(errors.ErrTxNotFinal, "locked until time %d", tx.LockTime)
+	}
+
+	return nil
+}
+
+// HasTimelocks reports whether tx sets a lock time or a relative lock on
+// any input.
+func HasTimelocks(tx *proto.Transaction) bool {
+	if tx.LockTime != 0 {
+		return true
+	}
+	for _, input := range tx.Inputs {
+		if input.RelativeLock != 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,155 @@
+package types
+
+import (
+	"bytes"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// MaxMultisigKeys is the most public keys a multisig output can name.
+const MaxMultisigKeys = 16
+
+const domainMultisig = "blocker/multisig"
+
+// MultisigAddress returns the address of the policy requiring threshold
+// signatures of keys, in this order. Multisig outputs pay to it, so the
+// keys are only revealed by the input spending them.
+func MultisigAddress(threshold uint32, keys []*encrypted.PublicKey) encrypted.Address {
+	return encrypted.AddressFromBytes(multisigAddress(threshold, publicKeyBytes(keys)))
+}
+
+func multisigAddress(threshold uint32, keys [][]byte) []byte {
+	e := newEncoder()
+	e.uint32(threshold)
+	e.uint32(uint32(len(keys)))
+	for _, key := range keys {
+		e.bytes(key)
+	}
+
+	return signingHash(domainMultisig, e.buf)[:encrypted.AddressLen]
+}
+
+// MultisigOutput returns an output of amount spendable by threshold
+// signatures of keys.
+func MultisigOutput(amount int64, threshold uint32, keys []*encrypted.PublicKey) *proto.TxOutput {
+	return &proto.TxOutput{
+		Amount:  amount,
+		Address: MultisigAddress(threshold, keys).Bytes(),
+		Type:    proto.OutputType_OUTPUT_MULTISIG,
+	}
+}
+
+// MultisigInput returns an unsigned input spending output prevOutIndex of
+// prevTxHash, a multisig output of the same threshold and keys. Each key
+// holder adds their signature with CoSignTransaction.
+func MultisigInput(prevTxHash []byte, prevOutIndex uint32, threshold uint32, keys []*encrypted.PublicKey) *proto.TxInput {
+	return &proto.TxInput{
+		PrevTxHash:   prevTxHash,
+		PrevOutIndex: prevOutIndex,
+		Multisig: &proto.Multisig{
+			Threshold:  threshold,
+			PublicKeys: publicKeyBytes(keys),
+			Signatures: make([][]byte, len(keys)),
+		},
+	}
+}
+
+// CoSignTransaction signs multisig input index of tx with pk and stores the
+// signature next to the public key of pk. Unlike SignTransaction it
+// modifies tx.
+func CoSignTransaction(pk *encrypted.PrivateKey, tx *proto.Transaction, index int) error {
+	signature, err := SignTransaction(pk, tx, index)
+	if err != nil {
+		return err
+	}
+
+	multisig := tx.Inputs[index].Multisig
+	if multisig == nil {
+		return errors.Wrapf(errors.ErrInvalidRequest, "input %d is not a multisig input", index)
+	}
+	if len(multisig.Signatures) != len(multisig.PublicKeys) {
+		return errors.Wrapf(errors.ErrInvalidRequest, "input %d has %d signatures for %d keys", index, len(multisig.Signatures), len(multisig.PublicKeys))
+	}
+
+	publicKey := pk.Public().Bytes()
+	for i, key := range multisig.PublicKeys {
+		if bytes.Equal(key, publicKey) {
+			multisig.Signatures[i] = signature.Bytes()
+			return nil
+		}
+	}
+
+	return errors.Wrapf(errors.ErrorInvalidSigner, "key %x is not part of input %d", publicKey, index)
+}
+
+// CheckMultisig checks that policy requires between 1 and all of at most
+// MaxMultisigKeys valid public keys, and holds a signature slot per key.
+func CheckMultisig(policy *proto.Multisig) error {
+	n := len(policy.PublicKeys)
+	switch {
+	case n == 0 || n > MaxMultisigKeys:
+		return errors.Wrapf(errors.ErrInvalidPubKey, "multisig of %d keys, at most %d are allowed", n, MaxMultisigKeys)
+	case policy.Threshold == 0 || int(policy.Threshold) > n:
+		return errors.Wrapf(errors.ErrInvalidRequest, "multisig threshold %d of %d keys", policy.Threshold, n)
+	case len(policy.Signatures) != n:
+		return errors.Wrapf(errors.ErrInvalidRequest, "multisig has %d signatures for %d keys", len(policy.Signatures), n)
+	}
+
+	seen := make(map[string]bool, n)
+	for _, key := range policy.PublicKeys {
+		if _, err := encrypted.ParsePublicKey(key); err != nil {
+			return err
+		}
+		if seen[string(key)] {
+			return errors.Wrapf(errors.ErrInvalidPubKey, "multisig names key %x twice", key)
+		}
+		seen[string(key)] = true
+	}
+
+	return nil
+}
+
+// MultisigAddressOf returns the address policy is spendable from.
+func MultisigAddressOf(policy *proto.Multisig) []byte {
+	return multisigAddress(policy.Threshold, policy.PublicKeys)
+}
+
+// checkMultisigInput checks that input index of the transaction of hasher
+// carries at least the threshold of valid signatures and no invalid one.
+func checkMultisigInput(hasher *sigHasher, index int, cache *SigCache) error {
+	multisig := hasher.tx.Inputs[index].Multisig
+	if err := CheckMultisig(multisig); err != nil {
+		return errors.Wrapf(err, "input %d", index)
+	}
+	hash, err := hasher.hash(index)
+	if err != nil {
+		return errors.Wrap(errors.ErrUnauthorized, err.Error())
+	}
+
+	var signed uint32
+	for i, sig := range multisig.Signatures {
+		if len(sig) == 0 {
+			continue
+		}
+		if err := checkSignature(hash, multisig.PublicKeys[i], sig, cache); err != nil {
+			return errors.Wrapf(err, "input %d key %d", index, i)
+		}
+		signed++
+	}
+	if signed < multisig.Threshold {
+		return errors.Wrapf(errors.ErrUnauthorized, "input %d has %d of %d required signatures", index, signed, multisig.Threshold)
+	}
+
+	return nil
+}
+
+func publicKeyBytes(keys []*encrypted.PublicKey) [][]byte {
+	b := make([][]byte, len(keys))
+	for i, key := range keys {
+		b[i] = key.Bytes()
+	}
+
+	return b
+}
@@ -0,0 +1,62 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+func multisigTx(threshold uint32, keys []*encrypted.PublicKey) *proto.Transaction {
+	return &proto.Transaction{
+		Version: 3,
+		Inputs:  []*proto.TxInput{MultisigInput(make([]byte, 32), 0, threshold, keys)},
+		Outputs: []*proto.TxOutput{MultisigOutput(100, threshold, keys)},
+	}
+}
+
+func TestMultisigThreshold(t *testing.T) {
+	var (
+		signers = []*encrypted.PrivateKey{encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey()}
+		keys    = []*encrypted.PublicKey{signers[0].Public(), signers[1].Public(), signers[2].Public()}
+		tx      = multisigTx(2, keys)
+		txid    = HashTransaction(tx)
+	)
+
+	require.Nil(t, CoSignTransaction(signers[1], tx, 0))
+	assert.True(t, errors.IsOf(CheckTransaction(tx), errors.ErrUnauthorized))
+
+	// co-signatures are witness data, signers sign the same digest
+	require.Nil(t, CoSignTransaction(signers[2], tx, 0))
+	assert.Nil(t, CheckTransaction(tx))
+	assert.Equal(t, txid, HashTransaction(tx))
+
+	// any invalid signature fails the input, even above the threshold
+	require.Nil(t, CoSignTransaction(signers[0], tx, 0))
+	tx.Inputs[0].Multisig.Signatures[0][0] ^= 1
+	assert.NotNil(t, CheckTransaction(tx))
+
+	// keys outside the policy cannot co-sign
+	assert.NotNil(t, CoSignTransaction(encrypted.GeneratePrivateKey(), tx, 0))
+}
+
+func TestCheckMultisig(t *testing.T) {
+	key := encrypted.GeneratePrivateKey().Public()
+
+	assert.Nil(t, CheckMultisig(multisigTx(1, []*encrypted.PublicKey{key}).Inputs[0].Multisig))
+	assert.NotNil(t, CheckMultisig(multisigTx(0, []*encrypted.PublicKey{key}).Inputs[0].Multisig))
+	assert.NotNil(t, CheckMultisig(multisigTx(2, []*encrypted.PublicKey{key}).Inputs[0].Multisig))
+	assert.NotNil(t, CheckMultisig(multisigTx(1, []*encrypted.PublicKey{key, key}).Inputs[0].Multisig))
+
+	keys := make([]*encrypted.PublicKey, MaxMultisigKeys+1)
+	for i := range keys {
+		keys[i] = encrypted.GeneratePrivateKey().Public()
+	}
+	assert.NotNil(t, CheckMultisig(multisigTx(1, keys).Inputs[0].Multisig))
+
+	assert.NotEqual(t, MultisigAddress(1, keys[:2]), MultisigAddress(2, keys[:2]))
+	assert.NotEqual(t, MultisigAddress(1, keys[:2]), MultisigAddress(1, []*encrypted.PublicKey{keys[1], keys[0]}))
+}
@@ -0,0 +1,63 @@
+package types
+
+import (
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/script"
+)
+
+// ScriptOutput returns an output of amount locked by locking.
+func ScriptOutput(amount int64, locking []byte) *proto.TxOutput {
+	return &proto.TxOutput{
+		Amount:        amount,
+		Type:          proto.OutputType_OUTPUT_SCRIPT,
+		LockingScript: locking,
+	}
+}
+
+// CheckScriptInput runs the unlocking script of input index of tx against
+// locking, the locking script of the output it spends. Signatures checked
+// by the scripts go through cache. Script inputs carry nothing but their
+// unlocking script.
+func CheckScriptInput(tx *proto.Transaction, index int, locking []byte, cache *SigCache) error {
+	input := tx.Inputs[index]
+	if len(input.UnlockingScript) == 0 {
+		return errors.Wrapf(errors.ErrScript, "input %d spends a script output without unlocking script", index)
+	}
+	if len(input.PublicKey) != 0 || len(input.Signature) != 0 || input.Multisig != nil || len(input.Preimage) != 0 {
+		return errors.Wrapf(errors.ErrScript, "script input %d carries other spending data", index)
+	}
+
+	hash, err := SignatureHash(tx, index)
+	if err != nil {
+		return errors.Wrap(errors.ErrUnauthorized, err.Error())
+	}
+	checker := scriptChecker{hash: hash, lockTime: tx.LockTime, cache: cache}
+	if err := script.Execute(input.UnlockingScript, locking, checker); err != nil {
+		return errors.Wrapf(err, "input %d", index)
+	}
+
+	return nil
+}
+
+// scriptChecker checks the signatures and lock times of scripts of one
+// input.
+type scriptChecker struct {
+	hash     []byte
+	lockTime int64
+	cache    *SigCache
+}
+
+func (c scriptChecker) CheckSig(publicKey, signature []byte) bool {
+	return checkSignature(c.hash, publicKey, signature, c.cache) == nil
+}
+
+// CheckLockTime compares lock times of the same kind only, heights to
+// heights and timestamps to timestamps.
+func (c scriptChecker) CheckLockTime(lockTime int64) bool {
+	if (lockTime < LockTimeThreshold) != (c.lockTime < LockTimeThreshold) {
+		return false
+	}
+
+	return c.lockTime >= lockTime
+}
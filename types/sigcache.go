@@ -0,0 +1,131 @@
+package types
+
+import (
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSigCacheSize is the number of signatures a SigCache made by
+// NewChain holds, about 3MB.
+const DefaultSigCacheSize = 100_000
+
+// SigCache remembers input signatures found valid, so a transaction
+// verified when it entered the mempool is not verified again when a block
+// includes it. Entries are keyed by the signed digest, the public key and
+// the signature, so a hit means that exact signature over that exact
+// message was valid. Once full, the oldest entries are evicted first. It
+// is safe for concurrent use; a nil cache caches nothing.
+type SigCache struct {
+	lock    sync.RWMutex
+	entries map[[32]byte]struct{}
+	// order holds the keys in insertion order as a ring, next is where the
+	// next key goes.
+	order [][32]byte
+	next  int
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// SigCacheStats counts the lookups of a SigCache.
+type SigCacheStats struct {
+	Hits   int64
+	Misses int64
+	Size   int
+}
+
+// HitRate returns the share of lookups that hit, 0 without any lookups.
+func (s SigCacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(total)
+}
+
+func NewSigCache(size int) *SigCache {
+	return &SigCache{
+		entries: make(map[[32]byte]struct{}, size),
+		order:   make([][32]byte, 0, size),
+	}
+}
+
+func sigCacheKey(hash, publicKey, signature []byte) [32]byte {
+	h := sha256.New()
+	h.Write(hash)
+	h.Write(publicKey)
+	h.Write(signature)
+
+	var key [32]byte
+	h.Sum(key[:0])
+
+	return key
+}
+
+// Has reports whether the signature over hash was found valid before.
+func (c *SigCache) Has(hash, publicKey, signature []byte) bool {
+	if c == nil {
+		return false
+	}
+
+	key := sigCacheKey(hash, publicKey, signature)
+	c.lock.RLock()
+	_, ok := c.entries[key]
+	c.lock.RUnlock()
+
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+
+	return ok
+}
+
+// Add records a signature over hash that was found valid.
+func (c *SigCache) Add(hash, publicKey, signature []byte) {
+	if c == nil || cap(c.order) == 0 {
+		return
+	}
+
+	key := sigCacheKey(hash, publicKey, signature)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	if len(c.order) < cap(c.order) {
+		c.order = append(c.order, key)
+	} else {
+		delete(c.entries, c.order[c.next])
+		c.order[c.next] = key
+		c.next = (c.next + 1) % len(c.order)
+	}
+	c.entries[key] = struct{}{}
+}
+
+func (c *SigCache) Len() int {
+	if c == nil {
+		return 0
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return len(c.entries)
+}
+
+func (c *SigCache) Stats() SigCacheStats {
+	if c == nil {
+		return SigCacheStats{}
+	}
+
+	return SigCacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   c.Len(),
+	}
+}
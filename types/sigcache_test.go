@@ -0,0 +1,55 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/util"
+)
+
+func TestSigCacheEvictsOldest(t *testing.T) {
+	var (
+		cache  = NewSigCache(2)
+		hashes = [][]byte{util.RandomHash(), util.RandomHash(), util.RandomHash()}
+		key    = []byte("key")
+		sig    = []byte("sig")
+	)
+	for _, hash := range hashes {
+		cache.Add(hash, key, sig)
+	}
+	assert.Equal(t, 2, cache.Len())
+
+	assert.False(t, cache.Has(hashes[0], key, sig))
+	assert.True(t, cache.Has(hashes[1], key, sig))
+	assert.True(t, cache.Has(hashes[2], key, sig))
+	assert.False(t, cache.Has(hashes[2], key, []byte("other")))
+
+	stats := cache.Stats()
+	assert.Equal(t, SigCacheStats{Hits: 2, Misses: 2, Size: 2}, stats)
+	assert.Equal(t, 0.5, stats.HitRate())
+
+	var none *SigCache
+	none.Add(hashes[0], key, sig)
+	assert.False(t, none.Has(hashes[0], key, sig))
+}
+
+func TestCheckTransactionsUsesSigCache(t *testing.T) {
+	var (
+		cache = NewSigCache(DefaultSigCacheSize)
+		txx   = signedTransactions(t, 10)
+	)
+	require.Nil(t, CheckTransactions(txx[:5], 1, cache))
+	assert.Equal(t, 10, cache.Len())
+
+	require.Nil(t, CheckTransactions(txx, 4, cache))
+	stats := cache.Stats()
+	assert.Equal(t, int64(10), stats.Hits)
+	assert.Equal(t, int64(20), stats.Misses)
+	assert.Equal(t, 20, stats.Size)
+
+	// a cached signature does not vouch for another message
+	txx[0].Outputs[0].Amount++
+	assert.NotNil(t, CheckTransactions([]*proto.Transaction{txx[0]}, 1, cache))
+}
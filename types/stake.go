@@ -0,0 +1,37 @@
+package types
+
+import (
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+)
+
+// StakeOutput bonds amount to validator. The stake stays owned by address
+// and can only be spent by an unbonding transaction.
+func StakeOutput(amount int64, address encrypted.Address, validator *encrypted.PublicKey) *proto.TxOutput {
+	return &proto.TxOutput{
+		Amount:    amount,
+		Address:   address.Bytes(),
+		Type:      proto.OutputType_OUTPUT_STAKE,
+		Validator: validator.Bytes(),
+	}
+}
+
+// NewUnbondingTransaction spends the stake outputs referenced by inputs,
+// all bonded to validator, into a single output to address, frozen until
+// unlockHeight. The output stays bonded to validator, so the stake can be
+// slashed until it unlocks. The inputs still have to be signed.
+func NewUnbondingTransaction(inputs []*proto.TxInput, amount int64, address encrypted.Address, validator *encrypted.PublicKey, unlockHeight int32) *proto.Transaction {
+	return &proto.Transaction{
+		Version: 1,
+		Inputs:  inputs,
+		Outputs: []*proto.TxOutput{
+			{
+				Amount:       amount,
+				Address:      address.Bytes(),
+				Type:         proto.OutputType_OUTPUT_UNBONDING,
+				Validator:    validator.Bytes(),
+				UnlockHeight: unlockHeight,
+			},
+		},
+	}
+}
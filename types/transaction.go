@@ -2,39 +2,230 @@ package types
 
 import (
 	"crypto/sha256"
+	"fmt"
+	"sync"
 
 	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
-	pb "google.golang.org/protobuf/proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
 )
 
-func SignTransaction(pk *encrypted.PrivateKey, tx *proto.Transaction) *encrypted.Signature {
-	return pk.Sign(HashTransaction(tx))
-}
+// MaxTransactionInputs and MaxTransactionOutputs bound the size of a
+// transaction, see CheckTransactionSize.
+const (
+	MaxTransactionInputs  = 500
+	MaxTransactionOutputs = 500
+)
 
-func HashTransaction(tx *proto.Transaction) []byte {
-	b, err := pb.Marshal(tx)
+// SigHashType selects the parts of a transaction an input signature commits
+// to. Inputs carry it in their SigHash field, which is signed as well.
+type SigHashType uint32
+
+const (
+	// SigHashAll commits to all inputs and outputs.
+	SigHashAll SigHashType = 0
+	// SigHashSingle commits to all inputs and only the output at the index
+	// of the signed input, so other outputs can still be added.
+	SigHashSingle SigHashType = 1
+	// SigHashAnyoneCanPay is combined with the modes above to commit to the
+	// signed input only, so other inputs can still be added.
+	SigHashAnyoneCanPay SigHashType = 0x80
+)
+
+// SignTransaction signs input index of tx with the sighash mode set on the
+// input. It does not modify tx.
+func SignTransaction(pk *encrypted.PrivateKey, tx *proto.Transaction, index int) (*encrypted.Signature, error) {
+	hash, err := SignatureHash(tx, index)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	return pk.Sign(hash), nil
+}
+
+// SignatureHash returns the digest input index of tx is signed over. It
+// never covers input signatures, so the inputs of a transaction can be
+// signed in any order.
+func SignatureHash(tx *proto.Transaction, index int) ([]byte, error) {
+	if index < 0 || index >= len(tx.Inputs) {
+		return nil, fmt.Errorf("transaction has no input %d", index)
+	}
+
+	var (
+		hashType = SigHashType(tx.Inputs[index].SigHash)
+		signed   = &proto.Transaction{
+			Version:  tx.Version,
+			ChainId:  tx.ChainId,
+			LockTime: tx.LockTime,
+		}
+	)
+
+	inputs := tx.Inputs
+	if hashType&SigHashAnyoneCanPay != 0 {
+		inputs = inputs[index : index+1]
+	}
+	for _, input := range inputs {
+		signed.Inputs = append(signed.Inputs, &proto.TxInput{
+			PrevTxHash:   input.PrevTxHash,
+			PrevOutIndex: input.PrevOutIndex,
+			PublicKey:    input.PublicKey,
+			SigHash:      input.SigHash,
+			Multisig:     unsignedMultisig(input.Multisig),
+			RelativeLock: input.RelativeLock,
+		})
+	}
+
+	switch hashType &^ SigHashAnyoneCanPay {
+	case SigHashAll:
+		signed.Outputs = tx.Outputs
+	case SigHashSingle:
+		if index >= len(tx.Outputs) {
+			return nil, fmt.Errorf("input %d signs a single output the transaction does not have", index)
+		}
+		signed.Outputs = tx.Outputs[index : index+1]
+	default:
+		return nil, fmt.Errorf("input %d has unknown sighash type %#x", index, uint32(hashType))
+	}
+
+	return signingHash(domainTransaction, HashTransaction(signed)), nil
+}
+
+// sigHasher computes the signature hashes of the inputs of one transaction.
+// Every SigHashAll input signs the same digest, which it computes only once,
+// so checking a transaction does not take time quadratic in its inputs.
+type sigHasher struct {
+	tx   *proto.Transaction
+	once sync.Once
+	all  []byte
+	err  error
+}
+
+func newSigHasher(tx *proto.Transaction) *sigHasher {
+	return &sigHasher{tx: tx}
+}
+
+// hash returns SignatureHash(tx, index).
+func (h *sigHasher) hash(index int) ([]byte, error) {
+	if index < 0 || index >= len(h.tx.Inputs) || SigHashType(h.tx.Inputs[index].SigHash) != SigHashAll {
+		return SignatureHash(h.tx, index)
 	}
-	hash := sha256.Sum256(b)
+
+	h.once.Do(func() {
+		h.all, h.err = SignatureHash(h.tx, index)
+	})
+
+	return h.all, h.err
+}
+
+// unsignedMultisig returns the policy of multisig without its signatures.
+func unsignedMultisig(multisig *proto.Multisig) *proto.Multisig {
+	if multisig == nil {
+		return nil
+	}
+
+	return &proto.Multisig{
+		Threshold:  multisig.Threshold,
+		PublicKeys: multisig.PublicKeys,
+	}
+}
+
+// HashTransaction returns the transaction ID, SHA256 of the canonical
+// encoding of tx without its signatures. Relaying a transaction cannot
+// change it, so outputs are referenced by it.
+func HashTransaction(tx *proto.Transaction) []byte {
+	hash := sha256.Sum256(EncodeTransaction(tx))
+	return hash[:]
+}
+
+// HashTransactionWitness returns the witness ID, SHA256 of the canonical
+// encoding of tx including its signatures. Blocks commit to it, so the
+// signatures they carry cannot be swapped.
+func HashTransactionWitness(tx *proto.Transaction) []byte {
+	hash := sha256.Sum256(EncodeTransactionWitness(tx))
 	return hash[:]
 }
 
-func VerifyTransaction(tx *proto.Transaction) bool{
-	for _, input := range tx.Inputs{
-		if len(input.Signature) == 0{
-			panic("Transaction with no signature")
+// VerifyTransaction reports whether CheckTransaction accepts tx.
+func VerifyTransaction(tx *proto.Transaction) bool {
+	return CheckTransaction(tx) == nil
+}
+
+// CheckTransaction checks the size and the signature of every input of tx,
+// except the unlocking scripts CheckScriptInput runs. It does not modify tx.
+func CheckTransaction(tx *proto.Transaction) error {
+	if err := CheckTransactionSize(tx); err != nil {
+		return err
+	}
+
+	hasher := newSigHasher(tx)
+	for i := range tx.Inputs {
+		if err := checkInput(hasher, i, nil); err != nil {
+			return err
 		}
-		var(
-			signature = encrypted.SignatureFromBytes(input.Signature)
-			publicKey = encrypted.PublicKeyFromBytes(input.PublicKey)
-		)
-
-		input.Signature = nil
-		if !signature.Verify(publicKey, HashTransaction(tx)){
-			return false
+	}
+	return nil
+}
+
+// CheckTransactionSize checks that tx has at most MaxTransactionInputs
+// inputs and MaxTransactionOutputs outputs. The modes other than SigHashAll
+// hash a copy of the transaction per input, which the limits keep cheap.
+func CheckTransactionSize(tx *proto.Transaction) error {
+	if len(tx.Inputs) > MaxTransactionInputs {
+		return errors.Wrapf(errors.ErrTxTooLarge, "%d inputs, at most %d are allowed", len(tx.Inputs), MaxTransactionInputs)
+	}
+	if len(tx.Outputs) > MaxTransactionOutputs {
+		return errors.Wrapf(errors.ErrTxTooLarge, "%d outputs, at most %d are allowed", len(tx.Outputs), MaxTransactionOutputs)
+	}
+
+	return nil
+}
+
+// checkInput checks the signatures of input index of the transaction of
+// hasher, skipping those cache has seen valid before. Inputs with an
+// unlocking script are left to CheckScriptInput, which needs the locking
+// script they spend.
+func checkInput(hasher *sigHasher, index int, cache *SigCache) error {
+	input := hasher.tx.Inputs[index]
+	if len(input.UnlockingScript) != 0 {
+		return nil
+	}
+	if input.Multisig != nil {
+		if len(input.PublicKey) != 0 || len(input.Signature) != 0 {
+			return errors.Wrapf(errors.ErrUnauthorized, "multisig input %d carries a single signature", index)
 		}
+		return checkMultisigInput(hasher, index, cache)
+	}
+
+	hash, err := hasher.hash(index)
+	if err != nil {
+		return errors.Wrap(errors.ErrUnauthorized, err.Error())
+	}
+	if err := checkSignature(hash, input.PublicKey, input.Signature, cache); err != nil {
+		return errors.Wrapf(err, "input %d", index)
 	}
-	return true
-}
\ No newline at end of file
+
+	return nil
+}
+
+// checkSignature checks sig of publicKey over hash, skipping the check if
+// cache has seen the signature valid before.
+func checkSignature(hash, publicKey, sig []byte, cache *SigCache) error {
+	signature, err := encrypted.ParseSignature(sig)
+	if err != nil {
+		return err
+	}
+	key, err := encrypted.ParsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	if cache.Has(hash, publicKey, sig) {
+		return nil
+	}
+	if !signature.Verify(key, hash) {
+		return errors.Wrap(errors.ErrUnauthorized, "invalid signature")
+	}
+	cache.Add(hash, publicKey, sig)
+
+	return nil
+}
@@ -1,13 +1,17 @@
 package types
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
 	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/util"
+	pb "google.golang.org/protobuf/proto"
 )
 
 func TestNewTransaction(t *testing.T) {
@@ -38,9 +42,222 @@ func TestNewTransaction(t *testing.T) {
 		Outputs: []*proto.TxOutput{output1, output2},
 	}
 
-	signature := SignTransaction(fromPrivateKey, tx)
+	signature, err := SignTransaction(fromPrivateKey, tx, 0)
+	assert.Nil(t, err)
 	input.Signature = signature.Bytes()
 
 	assert.True(t, VerifyTransaction(tx))
 	fmt.Printf("%v\n", tx)
 }
+
+func TestTransactionSignatureBindsChainID(t *testing.T) {
+	privKey := encrypted.GeneratePrivateKey()
+	input := &proto.TxInput{
+		PrevTxHash: util.RandomHash(),
+		PublicKey:  privKey.Public().Bytes(),
+	}
+	tx := &proto.Transaction{
+		Version: 1,
+		ChainId: "mainnet",
+		Inputs:  []*proto.TxInput{input},
+		Outputs: []*proto.TxOutput{{Amount: 10, Address: privKey.Public().Address().Bytes()}},
+	}
+	sig, err := SignTransaction(privKey, tx, 0)
+	require.Nil(t, err)
+
+	// the same signature must not be accepted for a raw hash or another chain
+	assert.False(t, sig.Verify(privKey.Public(), HashTransaction(tx)))
+
+	input.Signature = sig.Bytes()
+	replayed := &proto.Transaction{
+		Version: tx.Version,
+		ChainId: "testnet",
+		Inputs:  []*proto.TxInput{{PrevTxHash: input.PrevTxHash, PublicKey: input.PublicKey, Signature: sig.Bytes()}},
+		Outputs: tx.Outputs,
+	}
+	assert.False(t, VerifyTransaction(replayed))
+	assert.True(t, VerifyTransaction(tx))
+}
+
+// multiInputTx returns a transaction spending one output of every key.
+func multiInputTx(keys ...*encrypted.PrivateKey) *proto.Transaction {
+	tx := &proto.Transaction{Version: 1, ChainId: "testnet"}
+	for _, key := range keys {
+		tx.Inputs = append(tx.Inputs, &proto.TxInput{PrevTxHash: util.RandomHash(), PublicKey: key.Public().Bytes()})
+		tx.Outputs = append(tx.Outputs, &proto.TxOutput{Amount: 10, Address: key.Public().Address().Bytes()})
+	}
+
+	return tx
+}
+
+func signInput(t *testing.T, key *encrypted.PrivateKey, tx *proto.Transaction, index int) {
+	sig, err := SignTransaction(key, tx, index)
+	require.Nil(t, err)
+	tx.Inputs[index].Signature = sig.Bytes()
+}
+
+func TestVerifyTransactionMultipleInputs(t *testing.T) {
+	var (
+		a  = encrypted.GeneratePrivateKey()
+		b  = encrypted.GeneratePrivateKey()
+		tx = multiInputTx(a, b, a)
+	)
+
+	// inputs can be signed in any order
+	signInput(t, a, tx, 2)
+	signInput(t, b, tx, 1)
+	assert.False(t, VerifyTransaction(tx))
+	signInput(t, a, tx, 0)
+
+	signed := pb.Clone(tx)
+	assert.True(t, VerifyTransaction(tx))
+	assert.True(t, pb.Equal(signed, tx), "verification must not modify the transaction")
+	assert.True(t, VerifyTransaction(tx))
+
+	// a signature of one key does not sign the input of another
+	tx.Inputs[1].Signature = tx.Inputs[0].Signature
+	assert.False(t, VerifyTransaction(tx))
+	signInput(t, b, tx, 1)
+
+	tx.Outputs[1].Amount++
+	assert.False(t, VerifyTransaction(tx))
+	tx.Outputs[1].Amount--
+
+	tx.Inputs[1].Signature = nil
+	assert.False(t, VerifyTransaction(tx))
+
+	_, err := SignTransaction(a, tx, 3)
+	assert.NotNil(t, err)
+}
+
+func TestSigHashSingle(t *testing.T) {
+	var (
+		a  = encrypted.GeneratePrivateKey()
+		b  = encrypted.GeneratePrivateKey()
+		tx = multiInputTx(a, b)
+	)
+	tx.Inputs[0].SigHash = uint32(SigHashSingle)
+	signInput(t, a, tx, 0)
+	signInput(t, b, tx, 1)
+	require.True(t, VerifyTransaction(tx))
+
+	// b signed every output, a only the first one
+	tx.Outputs[1].Amount++
+	signInput(t, b, tx, 1)
+	assert.True(t, VerifyTransaction(tx))
+
+	tx.Outputs[0].Amount++
+	assert.False(t, VerifyTransaction(tx))
+	tx.Outputs[0].Amount--
+
+	// the mode is signed as well
+	tx.Inputs[0].SigHash = uint32(SigHashAll)
+	assert.False(t, VerifyTransaction(tx))
+
+	tx.Inputs[1].SigHash = uint32(SigHashSingle)
+	tx.Outputs = tx.Outputs[:1]
+	_, err := SignTransaction(b, tx, 1)
+	assert.NotNil(t, err)
+}
+
+func TestSigHashAnyoneCanPay(t *testing.T) {
+	var (
+		a  = encrypted.GeneratePrivateKey()
+		b  = encrypted.GeneratePrivateKey()
+		tx = multiInputTx(a)
+	)
+	tx.Inputs[0].SigHash = uint32(SigHashAll | SigHashAnyoneCanPay)
+	signInput(t, a, tx, 0)
+	require.True(t, VerifyTransaction(tx))
+
+	// b adds an input without invalidating the signature of a
+	tx.Inputs = append([]*proto.TxInput{{PrevTxHash: util.RandomHash(), PublicKey: b.Public().Bytes()}}, tx.Inputs...)
+	signInput(t, b, tx, 0)
+	assert.True(t, VerifyTransaction(tx))
+
+	// but may not change the outputs a signed
+	tx.Outputs = append(tx.Outputs, &proto.TxOutput{Amount: 5, Address: b.Public().Address().Bytes()})
+	signInput(t, b, tx, 0)
+	assert.False(t, VerifyTransaction(tx))
+
+	tx.Inputs[1].SigHash = 0x40
+	_, err := SignTransaction(a, tx, 1)
+	assert.NotNil(t, err)
+}
+
+func TestCheckTransactionRejectsMalformedInputs(t *testing.T) {
+	privKey := encrypted.GeneratePrivateKey()
+	tx := multiInputTx(privKey)
+
+	// no signature at all
+	assert.NotNil(t, CheckTransaction(tx))
+
+	signInput(t, privKey, tx, 0)
+	require.Nil(t, CheckTransaction(tx))
+
+	tx.Inputs[0].PublicKey = tx.Inputs[0].PublicKey[1:]
+	assert.NotNil(t, CheckTransaction(tx))
+	assert.False(t, VerifyTransaction(tx))
+}
+
+func TestTransactionIDIgnoresSignatures(t *testing.T) {
+	privKey := encrypted.GeneratePrivateKey()
+	tx := multiInputTx(privKey)
+	unsigned := HashTransaction(tx)
+
+	signInput(t, privKey, tx, 0)
+	assert.Equal(t, unsigned, HashTransaction(tx))
+	witness := HashTransactionWitness(tx)
+	assert.NotEqual(t, unsigned, witness)
+
+	// a relayer swapping the signature changes the witness ID only
+	tx.Inputs[0].Signature = bytes.Repeat([]byte{1}, encrypted.SignatureLen)
+	assert.Equal(t, unsigned, HashTransaction(tx))
+	assert.NotEqual(t, witness, HashTransactionWitness(tx))
+}
+
+func TestCheckLockTime(t *testing.T) {
+	tx := &proto.Transaction{}
+	assert.Nil(t, CheckLockTime(tx, 1, 0))
+
+	tx.LockTime = 10
+	assert.True(t, errors.IsOf(CheckLockTime(tx, 9, LockTimeThreshold*2), errors.ErrTxNotFinal))
+	assert.Nil(t, CheckLockTime(tx, 10, 0))
+
+	tx.LockTime = LockTimeThreshold
+	assert.True(t, errors.IsOf(CheckLockTime(tx, 1<<30, LockTimeThreshold-1), errors.ErrTxNotFinal))
+	assert.Nil(t, CheckLockTime(tx, 1, LockTimeThreshold))
+}
+
+func TestCheckTransactionSize(t *testing.T) {
+	tx := &proto.Transaction{Version: 1, ChainId: "testnet"}
+	for i := 0; i < MaxTransactionInputs; i++ {
+		tx.Inputs = append(tx.Inputs, &proto.TxInput{PrevTxHash: util.RandomHash()})
+	}
+	assert.Nil(t, CheckTransactionSize(tx))
+
+	tx.Inputs = append(tx.Inputs, &proto.TxInput{PrevTxHash: util.RandomHash()})
+	assert.True(t, errors.IsOf(CheckTransaction(tx), errors.ErrTxTooLarge))
+	assert.True(t, errors.IsOf(CheckTransactions([]*proto.Transaction{tx}, 1, nil), errors.ErrTxTooLarge))
+
+	tx.Inputs = tx.Inputs[:1]
+	for i := 0; i <= MaxTransactionOutputs; i++ {
+		tx.Outputs = append(tx.Outputs, &proto.TxOutput{Amount: 1})
+	}
+	assert.True(t, errors.IsOf(CheckTransactionSize(tx), errors.ErrTxTooLarge))
+}
+
+func TestSigHasherMatchesSignatureHash(t *testing.T) {
+	tx := multiInputTx(encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey())
+	tx.Inputs[1].SigHash = uint32(SigHashSingle)
+	tx.Inputs[2].SigHash = uint32(SigHashAll | SigHashAnyoneCanPay)
+
+	hasher := newSigHasher(tx)
+	for i := range tx.Inputs {
+		want, err := SignatureHash(tx, i)
+		require.Nil(t, err)
+		got, err := hasher.hash(i)
+		require.Nil(t, err)
+		assert.Equal(t, want, got, "input %d", i)
+	}
+}
@@ -0,0 +1,101 @@
+package types
+
+import (
+	"runtime"
+	"sync"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// minParallelInputs is the number of inputs below which spreading the
+// signature checks over workers costs more than it saves.
+const minParallelInputs = 16
+
+// inputRef points at one input of a list of transactions.
+type inputRef struct {
+	tx    int
+	input int
+}
+
+// CheckTransactions checks the input signatures of every transaction of
+// txx like CheckTransaction, spread over workers goroutines, or GOMAXPROCS
+// of them if workers is not positive. It stops at the first invalid
+// signature and returns its error. Signatures found in cache are not
+// checked again, valid ones are added to it; cache may be nil.
+func CheckTransactions(txx []*proto.Transaction, workers int, cache *SigCache) error {
+	var (
+		refs    []inputRef
+		hashers = make([]*sigHasher, len(txx))
+	)
+	for i, tx := range txx {
+		if err := CheckTransactionSize(tx); err != nil {
+			return errors.Wrapf(err, "transaction %d", i)
+		}
+		hashers[i] = newSigHasher(tx)
+		for j := range tx.Inputs {
+			refs = append(refs, inputRef{tx: i, input: j})
+		}
+	}
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(refs))
+	if workers <= 1 || len(refs) < minParallelInputs {
+		for _, ref := range refs {
+			if err := checkRef(hashers, ref, cache); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		jobs = make(chan inputRef)
+		done = make(chan struct{})
+		once sync.Once
+		wg   sync.WaitGroup
+		err  error
+	)
+	fail := func(e error) {
+		once.Do(func() {
+			err = e
+			close(done)
+		})
+	}
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for ref := range jobs {
+				if e := checkRef(hashers, ref, cache); e != nil {
+					fail(e)
+					return
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, ref := range refs {
+		select {
+		case jobs <- ref:
+		case <-done:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return err
+}
+
+func checkRef(hashers []*sigHasher, ref inputRef, cache *SigCache) error {
+	if err := checkInput(hashers[ref.tx], ref.input, cache); err != nil {
+		return errors.Wrapf(err, "transaction %d", ref.tx)
+	}
+
+	return nil
+}
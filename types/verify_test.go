@@ -0,0 +1,79 @@
+package types
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// signedTransactions returns n transactions of two inputs each, signed by
+// their own keys.
+func signedTransactions(t testing.TB, n int) []*proto.Transaction {
+	txx := make([]*proto.Transaction, n)
+	for i := range txx {
+		a, b := encrypted.GeneratePrivateKey(), encrypted.GeneratePrivateKey()
+		tx := multiInputTx(a, b)
+		for j, key := range []*encrypted.PrivateKey{a, b} {
+			sig, err := SignTransaction(key, tx, j)
+			require.Nil(t, err)
+			tx.Inputs[j].Signature = sig.Bytes()
+		}
+		txx[i] = tx
+	}
+
+	return txx
+}
+
+func TestCheckTransactions(t *testing.T) {
+	txx := signedTransactions(t, 50)
+
+	for _, workers := range []int{0, 1, 4, 1000} {
+		assert.Nil(t, CheckTransactions(txx, workers, nil), "workers=%d", workers)
+	}
+	assert.Nil(t, CheckTransactions(nil, 0, nil))
+
+	// a single bad signature anywhere fails the whole list
+	for _, i := range []int{0, 25, 49} {
+		sig := txx[i].Inputs[1].Signature
+		txx[i].Inputs[1].Signature = txx[i].Inputs[0].Signature
+
+		for _, workers := range []int{1, 4} {
+			err := CheckTransactions(txx, workers, nil)
+			assert.True(t, errors.IsOf(err, errors.ErrUnauthorized), "tx=%d workers=%d", i, workers)
+		}
+		txx[i].Inputs[1].Signature = sig
+	}
+}
+
+func BenchmarkCheckTransactions(b *testing.B) {
+	for _, n := range []int{100, 1000} {
+		txx := signedTransactions(b, n)
+
+		for _, workers := range benchWorkers() {
+			b.Run(fmt.Sprintf("txs=%d/workers=%d", n, workers), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if err := CheckTransactions(txx, workers, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(b.N*2*n)/b.Elapsed().Seconds(), "inputs/s")
+			})
+		}
+	}
+}
+
+// benchWorkers returns powers of two up to GOMAXPROCS, and GOMAXPROCS.
+func benchWorkers() []int {
+	var workers []int
+	for w := 1; w < runtime.GOMAXPROCS(0); w *= 2 {
+		workers = append(workers, w)
+	}
+
+	return append(workers, runtime.GOMAXPROCS(0))
+}
@@ -0,0 +1,57 @@
+package types
+
+import (
+	"crypto/sha256"
+
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/errors"
+)
+
+// SignVote signs the vote with pk and stores the public key and signature
+// in it.
+func SignVote(pk *encrypted.PrivateKey, vote *proto.Vote) *encrypted.Signature {
+	vote.PublicKey = pk.Public().Bytes()
+	signature := pk.Sign(signingHash(domainVote, HashVote(vote)))
+	vote.Signature = signature.Bytes()
+
+	return signature
+}
+
+// HashVote returns SHA256 of the vote without its signature.
+func HashVote(vote *proto.Vote) []byte {
+	unsigned := &proto.Vote{
+		Type:      vote.Type,
+		Height:    vote.Height,
+		Round:     vote.Round,
+		BlockHash: vote.BlockHash,
+		PublicKey: vote.PublicKey,
+	}
+
+	hash := sha256.Sum256(EncodeVote(unsigned))
+
+	return hash[:]
+}
+
+// VerifyVote reports whether CheckVote accepts vote.
+func VerifyVote(vote *proto.Vote) bool {
+	return CheckVote(vote) == nil
+}
+
+// CheckVote checks the signature of vote.
+func CheckVote(vote *proto.Vote) error {
+	signature, err := encrypted.ParseSignature(vote.Signature)
+	if err != nil {
+		return err
+	}
+	publicKey, err := encrypted.ParsePublicKey(vote.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	if !signature.Verify(publicKey, signingHash(domainVote, HashVote(vote))) {
+		return errors.Wrap(errors.ErrUnauthorized, "invalid vote signature")
+	}
+
+	return nil
+}
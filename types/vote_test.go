@@ -0,0 +1,33 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	proto "github.com/zacksfF/gRPC-P2P-UTXO-Blocker/Proto"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/encrypted"
+	"github.com/zacksfF/gRPC-P2P-UTXO-Blocker/util"
+)
+
+func TestVerifyVote(t *testing.T) {
+	var (
+		privateKey = encrypted.GeneratePrivateKey()
+		vote       = &proto.Vote{
+			Type:      proto.VoteType_VOTE_PRECOMMIT,
+			Height:    3,
+			Round:     1,
+			BlockHash: util.RandomHash(),
+		}
+	)
+
+	SignVote(privateKey, vote)
+	assert.Equal(t, privateKey.Public().Bytes(), vote.PublicKey)
+	assert.True(t, VerifyVote(vote))
+
+	vote.Round++
+	assert.False(t, VerifyVote(vote))
+
+	vote.Round--
+	vote.PublicKey = encrypted.GeneratePrivateKey().Public().Bytes()
+	assert.False(t, VerifyVote(vote))
+}
@@ -21,7 +21,6 @@ func RandomBlock() *proto.Block {
 		Version:   1,
 		Height:    int32(rand.Intn(1000)),
 		PrevHash:  RandomHash(),
-		RootHash:  RandomHash(),
 		Timestamp: time.Now().UnixNano(),
 	}
 
@@ -10,6 +10,9 @@ const (
 	ABCISemVer = "0.17.0"
 
 	ABCIVersion = ABCISemVer
+
+	// NodeSemVer is the software version nodes announce on handshake.
+	NodeSemVer = "0.0.1"
 )
 
 var (
@@ -17,6 +20,14 @@ var (
 	// This includes proposer selection.
 	P2PProtocol uint64 = 8
 
+	// MinP2PProtocol is the oldest p2p protocol we still speak, so nodes one
+	// release apart can talk using the highest protocol they share.
+	MinP2PProtocol uint64 = 7
+
+	// EvidenceP2PProtocol is the first p2p protocol gossiping evidence of
+	// equivocating validators.
+	EvidenceP2PProtocol uint64 = 8
+
 	// BlockProtocol versions all block data structures and processing.
 	// This includes validity of blocks and state updates.
 	BlockProtocol uint64 = 11